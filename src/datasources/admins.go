@@ -0,0 +1,101 @@
+package datasources
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+const defaultAdminName = "Administrator"
+
+// GetAdminTokenInfo resolves the token of an administrator. Administrators are kept apart from
+// GetTokenInfo, so their tokens are only accepted by the endpoints meant for them.
+func GetAdminTokenInfo(session neo4j.Session, token string) (repositories.TokenInfo, error) {
+	query := `
+		MATCH (a:Admin) 
+		WHERE a.token = $token 
+		RETURN a.ID
+	`
+
+	adminID, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"token": token})
+		if err != nil {
+			return 0, err
+		}
+		if !records.Next() {
+			return 0, fmt.Errorf("'adminID' not found")
+		}
+
+		return helpers.GetIntParameterFromQuery(records.Record(), "a.ID", true, true)
+	})
+	if err != nil {
+		return repositories.TokenInfo{}, err
+	}
+
+	return repositories.TokenInfo{ID: adminID.(int), Label: repositories.AdminLabel}, nil
+}
+
+// EnsureAdmin creates the administrator configured for the server, or resets its password to the configured one.
+func EnsureAdmin(session neo4j.Session, email string, password string) error {
+	nextID, err := getNextNodeID(session, "Admin", "ID")
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MERGE (a:Admin {email:$email}) 
+		ON CREATE SET a.ID = $nextID, a.firstName = $name, a.lastName = $empty 
+		SET a.password = $password
+	`
+	params := map[string]interface{}{
+		"email":    email,
+		"nextID":   nextID,
+		"name":     defaultAdminName,
+		"empty":    helpers.EmptyStringParameter,
+		"password": password,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func getAdmin(session neo4j.Session, tokenInfo repositories.TokenInfo, token string) (interface{}, error) {
+	query := `
+		MATCH (a:Admin) 
+		WHERE a.ID = $ID 
+		RETURN a.ID, a.email, a.firstName, a.lastName
+	`
+
+	admin, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"ID": tokenInfo.ID})
+		if err != nil {
+			return repositories.User{}, err
+		}
+		if !records.Next() {
+			return repositories.User{}, fmt.Errorf("administrator %d not found", tokenInfo.ID)
+		}
+
+		user, err := getUserFromQuery(records.Record(), "a")
+		if err != nil {
+			return repositories.User{}, err
+		}
+		user.Token = token
+		user.Type = repositories.AdminType
+		user.EmailVerified = true
+
+		return user, nil
+	})
+	if err != nil {
+		return repositories.User{}, err
+	}
+
+	return admin, nil
+}
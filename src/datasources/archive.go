@@ -0,0 +1,218 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	purgedTeacherFirstName = "Deleted"
+	purgedTeacherLastName  = "teacher"
+)
+
+// GetArchivedTests lists the tests a teacher deleted which can still be restored, most recently deleted first.
+func GetArchivedTests(session neo4j.Session, path string, token string) ([]repositories.ArchivedTest, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return []repositories.ArchivedTest{}, helpers.InvalidTokenError(path, err)
+	}
+
+	query := `
+		MATCH (t:Test)-[:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
+		WHERE coalesce(t.archived, false) 
+		OPTIONAL MATCH (t)-[:BELONGS_TO]->(subj:Subject) 
+		RETURN t.testID, t.name, subj.name, t.archivedAt 
+		ORDER BY t.archivedAt DESC
+	`
+
+	tests, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := []repositories.ArchivedTest{}
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"teacherID": tokenInfo.ID})
+		if err != nil {
+			return []repositories.ArchivedTest{}, err
+		}
+		for records.Next() {
+			test, err := getArchivedTestFromQuery(records.Record())
+			if err != nil {
+				return []repositories.ArchivedTest{}, err
+			}
+
+			results = append(results, test)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.ArchivedTest{}, err
+	}
+
+	return tests.([]repositories.ArchivedTest), nil
+}
+
+// RestoreTest brings back a test the teacher deleted, along with the grades of the students who took it.
+func RestoreTest(session neo4j.Session, path string, token string, testID int) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	query := `
+		MATCH (t:Test {testID:$testID})-[:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
+		WHERE coalesce(t.archived, false) 
+		OPTIONAL MATCH (t)-[:BELONGS_TO]->(subj:Subject) 
+		WITH t, t.name + ' (' + coalesce(subj.name, '') + ')' AS name 
+		REMOVE t.archived, t.archivedAt 
+		RETURN name
+	`
+	params := map[string]interface{}{
+		"testID":    testID,
+		"teacherID": tokenInfo.ID,
+	}
+
+	restored, err := writeAudited(session, tokenInfo, query, params, func(name string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionTestRestore,
+			EntityType: helpers.AuditEntityTest,
+			EntityID:   testID,
+			Details:    name,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("test %d is not a deleted test of this teacher", testID)
+	}
+
+	return nil
+}
+
+// RestoreUser brings back an account its user deleted. The user logs in again to get a new token. Accounts
+// which have been purged are gone, even when a placeholder is left.
+func RestoreUser(session neo4j.Session, path string, token string, userType string, userID int) error {
+	tokenInfo, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	label, err := checkManagedUser(session, userType, userID)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		WHERE coalesce(n.archived, false) AND n.purgedAt IS NULL 
+		REMOVE n.archived, n.archivedAt 
+		RETURN n.email
+	`, label)
+	params := map[string]interface{}{
+		"userID": userID,
+	}
+
+	restored, err := writeAudited(session, tokenInfo, query, params, func(email string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionUserRestore,
+			EntityType: helpers.AuditEntityUser,
+			EntityID:   userID,
+			Details:    email,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("%s %d is not deleted or has been purged", label, userID)
+	}
+
+	return nil
+}
+
+// PurgeArchived removes the tests and accounts which have been deleted for longer than the retention period
+// for good, along with the notifications, devices and objectives of the accounts. Teachers whose tests are
+// still around are kept as anonymous placeholders instead, since students see their grades for those tests
+// through them. It is run periodically in the background.
+func PurgeArchived(session neo4j.Session, retention time.Duration) error {
+	params := map[string]interface{}{
+		"before":    time.Now().Add(-retention).Unix(),
+		"now":       time.Now().Unix(),
+		"firstName": purgedTeacherFirstName,
+		"lastName":  purgedTeacherLastName,
+	}
+
+	err := helpers.WriteTX(session, `
+		MATCH (t:Test) 
+		WHERE coalesce(t.archived, false) AND t.archivedAt < $before 
+		DETACH DELETE t
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	err = helpers.WriteTX(session, `
+		MATCH (n) 
+		WHERE (n:Student OR n:Teacher) AND coalesce(n.archived, false) AND n.archivedAt < $before 
+		OPTIONAL MATCH (n)-[:HAS_NOTIFICATION]->(notification:Notification) 
+		WITH n, collect(notification) AS notifications 
+		OPTIONAL MATCH (n)-[:HAS_DEVICE]->(d:Device) 
+		WHERE size((d)<-[:HAS_DEVICE]-()) = 1 
+		WITH n, notifications, collect(d) AS devices 
+		OPTIONAL MATCH (n)-[:HAS_OBJECTIVE]->(o) 
+		WITH notifications + devices + collect(o) AS owned 
+		FOREACH (node IN owned | DETACH DELETE node)
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	err = helpers.WriteTX(session, `
+		MATCH (n:Teacher) 
+		WHERE coalesce(n.archived, false) AND n.archivedAt < $before AND exists((:Test)-[:ADDED_BY]->(n)) 
+		SET n.email = '', n.firstName = $firstName, n.lastName = $lastName, n.purgedAt = coalesce(n.purgedAt, $now) 
+		REMOVE n.password, n.token, n.emailMode, n.emailMutedTypes, n.passwordResetHash, n.passwordResetExpiresAt, 
+			n.oidcIssuer, n.oidcSubject
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteTX(session, `
+		MATCH (n) 
+		WHERE (n:Student OR n:Teacher) AND coalesce(n.archived, false) AND n.archivedAt < $before 
+			AND NOT exists((:Test)-[:ADDED_BY]->(n)) 
+		DETACH DELETE n
+	`, params)
+}
+
+func getArchivedTestFromQuery(record neo4j.Record) (repositories.ArchivedTest, error) {
+	ID, err := helpers.GetIntParameterFromQuery(record, "t.testID", true, true)
+	if err != nil {
+		return repositories.ArchivedTest{}, err
+	}
+	name, err := helpers.GetStringParameterFromQuery(record, "t.name", true, false)
+	if err != nil {
+		return repositories.ArchivedTest{}, err
+	}
+	subject, err := helpers.GetStringParameterFromQuery(record, "subj.name", true, false)
+	if err != nil {
+		return repositories.ArchivedTest{}, err
+	}
+	archivedAt, err := helpers.GetIntParameterFromQuery(record, "t.archivedAt", true, false)
+	if err != nil {
+		return repositories.ArchivedTest{}, err
+	}
+
+	return repositories.ArchivedTest{
+		ID:         ID,
+		Name:       name,
+		Subject:    subject,
+		ArchivedAt: archivedAt,
+	}, nil
+}
@@ -0,0 +1,231 @@
+package datasources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// GetAuditLog lists the audit log for administrators, newest first, optionally only what an actor did, what
+// was done to an entity, or what happened in a time range.
+func GetAuditLog(session neo4j.Session, path string, token string, filter repositories.AuditFilter) ([]repositories.AuditEntry, error) {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return []repositories.AuditEntry{}, helpers.InvalidTokenError(path, err)
+	}
+
+	conditions := " e.createdAt >= $from "
+	if filter.To != 0 {
+		conditions += " AND e.createdAt <= $to "
+	}
+	if filter.ActorType != helpers.EmptyStringParameter {
+		conditions += " AND e.actorType = $actorType "
+	}
+	if filter.ActorID != 0 {
+		conditions += " AND e.actorID = $actorID "
+	}
+	if filter.EntityType != helpers.EmptyStringParameter {
+		if !helpers.IsAuditEntityType(filter.EntityType) {
+			return []repositories.AuditEntry{}, fmt.Errorf("unknown entity type '%s'", filter.EntityType)
+		}
+		conditions += " AND e.entityType = $entityType "
+	}
+	if filter.EntityID != 0 {
+		conditions += " AND e.entityID = $entityID "
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (e:AuditEntry) 
+		WHERE %s 
+		RETURN e.action, e.actorType, e.actorID, e.actorEmail, e.entityType, e.entityID, e.studentID, e.before, e.after, 
+			e.details, e.createdAt 
+		ORDER BY e.createdAt DESC
+	`, conditions)
+	params := map[string]interface{}{
+		"from":       filter.From,
+		"to":         filter.To,
+		"actorType":  filter.ActorType,
+		"actorID":    filter.ActorID,
+		"entityType": filter.EntityType,
+		"entityID":   filter.EntityID,
+	}
+
+	entries, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := []repositories.AuditEntry{}
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.AuditEntry{}, err
+		}
+		for records.Next() {
+			entry, err := getAuditEntryFromQuery(records.Record())
+			if err != nil {
+				return []repositories.AuditEntry{}, err
+			}
+
+			results = append(results, entry)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.AuditEntry{}, err
+	}
+
+	return entries.([]repositories.AuditEntry), nil
+}
+
+// RecordLogin adds the login of the account using the email to the audit log.
+func RecordLogin(session neo4j.Session, email string, ip string, method string) error {
+	match := `
+		MATCH (a) 
+		WHERE (a:Student OR a:Teacher OR a:Admin) AND toLower(a.email) = toLower($email) 
+		WITH a, CASE WHEN a:Student THEN $studentType WHEN a:Teacher THEN $teacherType ELSE $adminType END AS actorType, 
+			a.ID AS entityID
+	`
+	params := map[string]interface{}{
+		"email":       email,
+		"studentType": repositories.StudentType,
+		"teacherType": repositories.TeacherType,
+		"adminType":   repositories.AdminType,
+	}
+
+	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return nil, helpers.CreateAuditEntry(tx, match, params, repositories.AuditEntry{
+			Action:     helpers.AuditActionLogin,
+			EntityType: helpers.AuditEntityUser,
+			Details:    fmt.Sprintf("%s login from %s", method, ip),
+		})
+	})
+
+	return err
+}
+
+// writeAudited runs a change which returns the value it replaces and adds the entry getEntry makes from that
+// value to the audit log, in the same transaction. What an administrator does while impersonating someone is
+// recorded as done by the administrator. It tells whether anything matched.
+func writeAudited(session neo4j.Session, tokenInfo repositories.TokenInfo, query string, params map[string]interface{},
+	getEntry func(oldValue string) repositories.AuditEntry,
+) (bool, error) {
+	label := tokenInfo.Label
+	actorID := tokenInfo.ID
+	impersonation := helpers.EmptyStringParameter
+	if tokenInfo.ImpersonatorID != 0 {
+		label = repositories.AdminLabel
+		actorID = tokenInfo.ImpersonatorID
+		impersonation = fmt.Sprintf("impersonating %s %d", strings.ToLower(tokenInfo.Label), tokenInfo.ID)
+	}
+	actorType := repositories.StudentType
+	switch label {
+	case repositories.TeacherLabel:
+		actorType = repositories.TeacherType
+	case repositories.AdminLabel:
+		actorType = repositories.AdminType
+	}
+	match := fmt.Sprintf(`
+		MATCH (a:%s {ID:$actorID}) 
+		WITH a, $actorType AS actorType, $entityID AS entityID
+	`, label)
+
+	changed, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return false, err
+		}
+		if !records.Next() {
+			return false, records.Err()
+		}
+		oldValue, err := helpers.GetStringParameterFromQuery(records.Record(), records.Record().Keys()[0], true, false)
+		if err != nil {
+			return false, err
+		}
+		_, err = records.Consume()
+		if err != nil {
+			return false, err
+		}
+
+		entry := getEntry(oldValue)
+		if impersonation != helpers.EmptyStringParameter {
+			entry.Details = strings.TrimSpace(fmt.Sprintf("%s (%s)", entry.Details, impersonation))
+		}
+
+		return true, helpers.CreateAuditEntry(tx, match, map[string]interface{}{
+			"actorID":   actorID,
+			"actorType": actorType,
+			"entityID":  entry.EntityID,
+		}, entry)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return changed.(bool), nil
+}
+
+func getAuditEntryFromQuery(record neo4j.Record) (repositories.AuditEntry, error) {
+	action, err := helpers.GetStringParameterFromQuery(record, "e.action", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	actorType, err := helpers.GetStringParameterFromQuery(record, "e.actorType", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	actorID, err := helpers.GetIntParameterFromQuery(record, "e.actorID", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	actorEmail, err := helpers.GetStringParameterFromQuery(record, "e.actorEmail", true, false)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	entityType, err := helpers.GetStringParameterFromQuery(record, "e.entityType", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	entityID, err := helpers.GetIntParameterFromQuery(record, "e.entityID", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	studentID, err := helpers.GetIntParameterFromQuery(record, "e.studentID", true, false)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	before, err := helpers.GetStringParameterFromQuery(record, "e.before", true, false)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	after, err := helpers.GetStringParameterFromQuery(record, "e.after", true, false)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	details, err := helpers.GetStringParameterFromQuery(record, "e.details", true, false)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+	createdAt, err := helpers.GetIntParameterFromQuery(record, "e.createdAt", true, true)
+	if err != nil {
+		return repositories.AuditEntry{}, err
+	}
+
+	return repositories.AuditEntry{
+		Action:     action,
+		Actor:      repositories.User{ID: actorID, Type: actorType, Email: actorEmail},
+		EntityType: entityType,
+		EntityID:   entityID,
+		StudentID:  studentID,
+		Before:     before,
+		After:      after,
+		Details:    details,
+		CreatedAt:  createdAt,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// RegisterDevice links a push token to the user. A token moves to the last user that registered it,
+// so a shared phone only receives the notifications of whoever is logged in.
+func RegisterDevice(session neo4j.Session, path string, token string, device repositories.Device) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if device.Token == helpers.EmptyStringParameter {
+		return fmt.Errorf("device token is missing")
+	}
+	if device.Platform != helpers.DevicePlatformAndroid && device.Platform != helpers.DevicePlatformIOS {
+		return fmt.Errorf("unknown device platform '%s'", device.Platform)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID}) 
+		MERGE (d:Device {token:$deviceToken}) 
+		WITH u, d 
+		OPTIONAL MATCH ()-[previous:HAS_DEVICE]->(d) 
+		DELETE previous 
+		WITH DISTINCT u, d 
+		CREATE (u)-[:HAS_DEVICE]->(d) 
+		SET d.platform = $platform, d.registeredAt = $registeredAt
+	`, tokenInfo.Label)
+	params := map[string]interface{}{
+		"ID":           tokenInfo.ID,
+		"deviceToken":  device.Token,
+		"platform":     device.Platform,
+		"registeredAt": time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func UnregisterDevice(session neo4j.Session, path string, token string, deviceToken string) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID})-[:HAS_DEVICE]->(d:Device {token:$deviceToken}) 
+		DETACH DELETE d
+	`, tokenInfo.Label)
+	params := map[string]interface{}{
+		"ID":          tokenInfo.ID,
+		"deviceToken": deviceToken,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
@@ -0,0 +1,78 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func GetEmailPreferences(session neo4j.Session, path string, token string) (repositories.EmailPreferences, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return repositories.EmailPreferences{}, helpers.InvalidTokenError(path, err)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID}) 
+		RETURN u.emailMode, u.emailMutedTypes
+	`, tokenInfo.Label)
+
+	preferences, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var result repositories.EmailPreferences
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"ID": tokenInfo.ID})
+		if err != nil {
+			return repositories.EmailPreferences{}, err
+		}
+		if records.Next() {
+			result, err = helpers.GetEmailPreferencesFromQuery(records.Record(), "u")
+			if err != nil {
+				return repositories.EmailPreferences{}, err
+			}
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return repositories.EmailPreferences{}, err
+	}
+
+	return preferences.(repositories.EmailPreferences), nil
+}
+
+func SetEmailPreferences(session neo4j.Session, path string, token string, preferences repositories.EmailPreferences) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	mutedTypes := preferences.MutedTypes
+	if mutedTypes == nil {
+		mutedTypes = []string{}
+	}
+
+	// the digest sends every notification it has not sent yet, so the ones from before the user switched
+	// to it are marked as sent already
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID}) 
+		WITH u, coalesce(u.emailMode, '') <> $digest AND $emailMode = $digest AS startsDigest 
+		SET u.emailMode = $emailMode, u.emailMutedTypes = $emailMutedTypes 
+		FOREACH (n IN CASE WHEN startsDigest THEN [(u)-[:HAS_NOTIFICATION]->(n:Notification) WHERE n.digestedAt IS NULL | n] ELSE [] END | 
+			SET n.digestedAt = $now)
+	`, tokenInfo.Label)
+	params := map[string]interface{}{
+		"ID":              tokenInfo.ID,
+		"emailMode":       preferences.Mode,
+		"emailMutedTypes": mutedTypes,
+		"digest":          helpers.EmailModeDigest,
+		"now":             time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
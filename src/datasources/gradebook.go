@@ -0,0 +1,93 @@
+package datasources
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// ExportTestGradebook exports every submission of a test added by the teacher.
+func ExportTestGradebook(session neo4j.Session, path string, token string, testID int, format string) ([]byte, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return nil, helpers.InvalidTokenError(path, err)
+	}
+
+	tests, err := getTestForTeacher(session, tokenInfo.ID, testID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("test %d was not added by this teacher", testID)
+	}
+
+	submissions, err := getAllCompletedTestsForTeacher(session, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	title := fmt.Sprintf("%s - %s", tests[0].Test.Name, tests[0].Test.Subject)
+
+	return helpers.ExportGradebook(title, submissions, format)
+}
+
+// ExportSubjectGradebook exports the submissions of every test the teacher added for a subject.
+func ExportSubjectGradebook(session neo4j.Session, path string, token string, subject string, format string) ([]byte, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return nil, helpers.InvalidTokenError(path, err)
+	}
+
+	submissions, err := getAllCompletedTestsForSubject(session, tokenInfo.ID, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return helpers.ExportGradebook(subject, submissions, format)
+}
+
+func getAllCompletedTestsForSubject(session neo4j.Session, teacherID int, subject string) ([]repositories.CompletedTest, error) {
+	query := `
+		MATCH (g:Group)<-[sg:MEMBER_OF]-(s:Student)-[st:COMPLETED]->(t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
+		WHERE p.ID = $teacherID AND subj.name = $subject AND NOT coalesce(t.archived, false) AND NOT coalesce(s.archived, false) 
+		RETURN s.ID, s.email, s.firstName, s.lastName, g.gID, 
+				t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
+					t.enablePartialScoring, t.mandatoryToPass, t.template, t.layout, t.templatePDF, t.templatePreviews, t.templateStatus, t.templateError, t.publication, t.releaseAt, t.publishedAt, count(st) as nrTestsGraded, t.answers, 
+					p.ID, p.email, p.firstName, p.lastName, 
+				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.feedback, st.answers
+	`
+	params := map[string]interface{}{
+		"teacherID": teacherID,
+		"subject":   subject,
+	}
+
+	testResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []repositories.CompletedTest
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.CompletedTest{}, err
+		}
+
+		for records.Next() {
+			completedTest, err := getCompletedTestFromTestQuery(records.Record())
+			if err != nil {
+				return []repositories.CompletedTest{}, err
+			}
+
+			results = append(results, completedTest)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.CompletedTest{}, err
+	}
+
+	return testResults.([]repositories.CompletedTest), nil
+}
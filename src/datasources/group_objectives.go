@@ -0,0 +1,487 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// GetGroupObjectives returns the group objectives set by a teacher together with the progress of every
+// student covered by them.
+func GetGroupObjectives(session neo4j.Session, path string, token string, subject string, state string) ([]repositories.GroupObjective, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return []repositories.GroupObjective{}, helpers.InvalidTokenError(path, err)
+	}
+
+	groupObjectives, err := getGroupObjectivesForTeacher(session, tokenInfo.ID, subject, state)
+	if err != nil {
+		return []repositories.GroupObjective{}, err
+	}
+
+	now := int(time.Now().Unix())
+	for index, groupObjective := range groupObjectives {
+		students, err := getGroupObjectiveStudents(session, groupObjective.ID, now)
+		if err != nil {
+			return []repositories.GroupObjective{}, err
+		}
+
+		groupObjectives[index].Progress = helpers.EvaluateGroupObjective(groupObjective, students, now)
+	}
+
+	return groupObjectives, nil
+}
+
+// AddGroupObjective sets an objective for a group or, without a group, for every student enrolled in the
+// subject. Each of the students gets an objective derived from it, which only the teacher can change.
+// Students joining the group later are not covered.
+func AddGroupObjective(session neo4j.Session, path string, token string, groupObjective repositories.GroupObjective, dispatcher *helpers.NotificationDispatcher) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+	err = helpers.ValidateGroupObjective(groupObjective)
+	if err != nil {
+		return err
+	}
+	err = checkGroupObjectiveScope(session, tokenInfo.ID, groupObjective.Subject, groupObjective.Group)
+	if err != nil {
+		return err
+	}
+
+	nextID, err := getNextNodeID(session, "GroupObjective", "ID")
+	if err != nil {
+		return err
+	}
+	nextObjectiveID, err := getNextNodeID(session, "Objective", "ID")
+	if err != nil {
+		return err
+	}
+
+	studentMatch := " MATCH (s:Student)-[:ENROLLED_IN]->(subj) WHERE NOT coalesce(s.archived, false) "
+	if groupObjective.Group != 0 {
+		studentMatch = " MATCH (s:Student)-[:MEMBER_OF]->(g) WHERE NOT coalesce(s.archived, false) "
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (p:Teacher {ID:$teacherID})-[:TEACHES]->(subj:Subject {name:$subject}) 
+		OPTIONAL MATCH (g:Group {gID:$group}) 
+		CREATE (p)-[:HAS_OBJECTIVE]->(go:GroupObjective {ID:$nextID})-[:FOR_SUBJECT]->(subj) 
+		SET go.timestampStart=$ts, go.timestampEnd=$te, go.target=$target, go.share=$share, go.nrTests=$nrTests, 
+			go.state=$state, go.createdAt=$createdAt 
+		FOREACH (forGroup IN CASE WHEN g IS NULL THEN [] ELSE [g] END | CREATE (go)-[:FOR_GROUP]->(forGroup)) 
+		WITH go, subj, g 
+		%s 
+		WITH go, subj, collect(DISTINCT s) AS students 
+		UNWIND range(0, size(students) - 1) AS index 
+		WITH go, subj, students[index] AS student, $nextObjectiveID + index AS objectiveID 
+		CREATE (student)-[:HAS_OBJECTIVE]->(o:Objective {ID:objectiveID})-[:FOR_SUBJECT]->(subj) 
+		SET o.timestampStart=$ts, o.timestampEnd=$te, o.target=$target, o.nrTests=$nrTests, 
+			o.state=$state, o.createdAt=$createdAt 
+		CREATE (o)-[:DERIVED_FROM]->(go)
+	`, studentMatch)
+	params := map[string]interface{}{
+		"teacherID":        tokenInfo.ID,
+		"subject":          groupObjective.Subject,
+		"group":            groupObjective.Group,
+		"nextID":           nextID,
+		"nextObjectiveID":  nextObjectiveID,
+		"ts":               groupObjective.StartTimestamp,
+		"te":               groupObjective.EndTimestamp,
+		"target":           groupObjective.TargetGrade,
+		"share":            groupObjective.TargetShare,
+		"nrTests":          groupObjective.NrTests,
+		"state":            helpers.ObjectiveStateActive,
+		"createdAt":        time.Now().Unix(),
+		"groupObjectiveID": nextID,
+	}
+
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return err
+	}
+
+	return dispatcher.Notify(session, `
+		MATCH (u:Student)-[:HAS_OBJECTIVE]->(:Objective)-[:DERIVED_FROM]->(:GroupObjective {ID:$groupObjectiveID})
+	`, params, repositories.Notification{
+		Type:    helpers.NotificationTypeObjectiveAssigned,
+		Message: helpers.ObjectiveAssignedNotification,
+		Payload: repositories.NotificationPayload{
+			Subject: groupObjective.Subject,
+		},
+	})
+}
+
+// UpdateGroupObjective changes an active group objective or closes it, together with the active objectives
+// derived from it.
+func UpdateGroupObjective(session neo4j.Session, path string, token string, groupObjectiveID int, groupObjective repositories.GroupObjective) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	currentObjectives, err := getGroupObjectivesForTeacher(session, tokenInfo.ID, helpers.EmptyStringParameter, helpers.EmptyStringParameter)
+	if err != nil {
+		return err
+	}
+	var current *repositories.GroupObjective
+	for index := range currentObjectives {
+		if currentObjectives[index].ID == groupObjectiveID {
+			current = &currentObjectives[index]
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("group objective %d does not exist", groupObjectiveID)
+	}
+	if current.State != helpers.ObjectiveStateActive {
+		return fmt.Errorf("group objective %d is %s and can no longer be changed", groupObjectiveID, current.State)
+	}
+
+	// The group and subject define who the objective was derived for, so they cannot be changed.
+	groupObjective.Group = current.Group
+	groupObjective.Subject = current.Subject
+	err = helpers.ValidateGroupObjective(groupObjective)
+	if err != nil {
+		return err
+	}
+
+	state := groupObjective.State
+	if state == helpers.EmptyStringParameter {
+		state = helpers.ObjectiveStateActive
+	}
+	if !helpers.IsObjectiveState(state) {
+		return fmt.Errorf("unknown objective state '%s'", state)
+	}
+
+	query := `
+		MATCH (p:Teacher {ID:$teacherID})-[:HAS_OBJECTIVE]->(go:GroupObjective {ID:$groupObjectiveID}) 
+		SET go.timestampStart=$ts, go.timestampEnd=$te, go.target=$target, go.share=$share, go.nrTests=$nrTests, 
+			go.state=$state, go.closedAt = CASE WHEN $state = $active THEN null ELSE $now END 
+		WITH go 
+		OPTIONAL MATCH (o:Objective)-[:DERIVED_FROM]->(go) 
+		WHERE o.state = $active 
+		FOREACH (derived IN CASE WHEN o IS NULL THEN [] ELSE [o] END | 
+			SET derived.timestampStart=$ts, derived.timestampEnd=$te, derived.target=$target, derived.nrTests=$nrTests, 
+				derived.state=$state, derived.closedAt = CASE WHEN $state = $active THEN null ELSE $now END, derived.status = null)
+	`
+	params := map[string]interface{}{
+		"teacherID":        tokenInfo.ID,
+		"groupObjectiveID": groupObjectiveID,
+		"ts":               groupObjective.StartTimestamp,
+		"te":               groupObjective.EndTimestamp,
+		"target":           groupObjective.TargetGrade,
+		"share":            groupObjective.TargetShare,
+		"nrTests":          groupObjective.NrTests,
+		"state":            state,
+		"active":           helpers.ObjectiveStateActive,
+		"now":              time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// DeleteGroupObjective removes an active group objective and the active objectives derived from it.
+// Derived objectives which were already closed stay as the history of their students.
+func DeleteGroupObjective(session neo4j.Session, path string, token string, groupObjectiveID int) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	currentState, err := getGroupObjectiveState(session, tokenInfo.ID, groupObjectiveID)
+	if err != nil {
+		return err
+	}
+	if currentState != helpers.ObjectiveStateActive {
+		return fmt.Errorf("group objective %d is %s and is kept as history", groupObjectiveID, currentState)
+	}
+
+	query := `
+		MATCH (p:Teacher {ID:$teacherID})-[:HAS_OBJECTIVE]->(go:GroupObjective {ID:$groupObjectiveID}) 
+		OPTIONAL MATCH (o:Objective)-[:DERIVED_FROM]->(go) 
+		WHERE o.state = $active 
+		DETACH DELETE o, go
+	`
+	params := map[string]interface{}{
+		"teacherID":        tokenInfo.ID,
+		"groupObjectiveID": groupObjectiveID,
+		"active":           helpers.ObjectiveStateActive,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// completeGroupObjectives closes the active group objectives whose window is over. Their derived objectives
+// are completed by EvaluateObjectives.
+func completeGroupObjectives(session neo4j.Session) error {
+	query := `
+		MATCH (go:GroupObjective) 
+		WHERE go.state = $active AND go.timestampEnd < $now 
+		SET go.state = $completed, go.closedAt = $now
+	`
+	params := map[string]interface{}{
+		"active":    helpers.ObjectiveStateActive,
+		"completed": helpers.ObjectiveStateCompleted,
+		"now":       time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func checkGroupObjectiveScope(session neo4j.Session, teacherID int, subject string, group int) error {
+	query := `
+		MATCH (p:Teacher {ID:$teacherID})-[:TEACHES]->(subj:Subject {name:$subject}) 
+		OPTIONAL MATCH (g:Group {gID:$group}) 
+		RETURN count(g) AS groups
+	`
+	params := map[string]interface{}{
+		"teacherID": teacherID,
+		"subject":   subject,
+		"group":     group,
+	}
+
+	groups, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return 0, err
+		}
+		if !records.Next() {
+			return 0, fmt.Errorf("subject '%s' is not taught by this teacher", subject)
+		}
+
+		return helpers.GetIntParameterFromQuery(records.Record(), "groups", true, true)
+	})
+	if err != nil {
+		return err
+	}
+	if group != 0 && groups.(int) == 0 {
+		return fmt.Errorf("group %d does not exist", group)
+	}
+
+	return nil
+}
+
+func getGroupObjectiveState(session neo4j.Session, teacherID int, groupObjectiveID int) (string, error) {
+	query := `
+		MATCH (p:Teacher {ID:$teacherID})-[:HAS_OBJECTIVE]->(go:GroupObjective {ID:$groupObjectiveID}) 
+		RETURN go.state
+	`
+	params := map[string]interface{}{
+		"teacherID":        teacherID,
+		"groupObjectiveID": groupObjectiveID,
+	}
+
+	state, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+		if !records.Next() {
+			return helpers.EmptyStringParameter, fmt.Errorf("group objective %d does not exist", groupObjectiveID)
+		}
+
+		return helpers.GetStringParameterFromQuery(records.Record(), "go.state", true, true)
+	})
+	if err != nil {
+		return helpers.EmptyStringParameter, err
+	}
+
+	return state.(string), nil
+}
+
+func getGroupObjectivesForTeacher(session neo4j.Session, teacherID int, subject string, state string) ([]repositories.GroupObjective, error) {
+	extraCondition := ""
+	if subject != helpers.EmptyStringParameter {
+		extraCondition = " AND subj.name = $subject "
+	}
+	if state != helpers.EmptyStringParameter {
+		extraCondition += " AND go.state = $state "
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (p:Teacher)-[:HAS_OBJECTIVE]->(go:GroupObjective)-[:FOR_SUBJECT]->(subj:Subject) 
+		WHERE p.ID = $teacherID %s 
+		OPTIONAL MATCH (go)-[:FOR_GROUP]->(g:Group) 
+		RETURN subj.name, g.gID, go.ID, go.timestampStart, go.timestampEnd, go.target, go.share, go.nrTests, 
+			go.state, go.createdAt, go.closedAt 
+		ORDER BY go.timestampStart DESC
+	`, extraCondition)
+	params := map[string]interface{}{
+		"teacherID": teacherID,
+		"subject":   subject,
+		"state":     state,
+	}
+
+	groupObjectives, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []repositories.GroupObjective
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.GroupObjective{}, err
+		}
+
+		for records.Next() {
+			groupObjective, err := getGroupObjectiveFromQuery(records.Record())
+			if err != nil {
+				return []repositories.GroupObjective{}, err
+			}
+
+			results = append(results, groupObjective)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.GroupObjective{}, err
+	}
+
+	return groupObjectives.([]repositories.GroupObjective), nil
+}
+
+func getGroupObjectiveStudents(session neo4j.Session, groupObjectiveID int, now int) ([]repositories.StudentObjectiveProgress, error) {
+	query := `
+		MATCH (s:Student)-[:HAS_OBJECTIVE]->(o:Objective)-[:DERIVED_FROM]->(go:GroupObjective {ID:$groupObjectiveID}), 
+			(o)-[:FOR_SUBJECT]->(subj:Subject) 
+		WHERE NOT coalesce(s.archived, false) 
+		RETURN s.ID, s.firstName, s.lastName, subj.name, o.ID, o.timestampStart, o.timestampEnd, o.target, o.nrTests, 
+			o.state, o.createdAt, o.closedAt, go.ID 
+		ORDER BY s.lastName, s.firstName
+	`
+
+	type derivedObjective struct {
+		student   repositories.StudentObjectiveProgress
+		objective repositories.Objective
+	}
+
+	derived, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []derivedObjective
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"groupObjectiveID": groupObjectiveID})
+		if err != nil {
+			return []derivedObjective{}, err
+		}
+
+		for records.Next() {
+			record := records.Record()
+			studentID, err := helpers.GetIntParameterFromQuery(record, "s.ID", true, true)
+			if err != nil {
+				return []derivedObjective{}, err
+			}
+			firstName, err := helpers.GetStringParameterFromQuery(record, "s.firstName", true, false)
+			if err != nil {
+				return []derivedObjective{}, err
+			}
+			lastName, err := helpers.GetStringParameterFromQuery(record, "s.lastName", true, false)
+			if err != nil {
+				return []derivedObjective{}, err
+			}
+			objective, err := getObjectiveFromQuery(record)
+			if err != nil {
+				return []derivedObjective{}, err
+			}
+
+			results = append(results, derivedObjective{
+				student: repositories.StudentObjectiveProgress{
+					StudentID:   studentID,
+					FirstName:   firstName,
+					LastName:    lastName,
+					ObjectiveID: objective.ID,
+				},
+				objective: objective,
+			})
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.StudentObjectiveProgress{}, err
+	}
+
+	students := []repositories.StudentObjectiveProgress{}
+	for _, derived := range derived.([]derivedObjective) {
+		completedTests, err := getAllCompletedTestsForStudent(session, derived.student.StudentID, helpers.EmptyStringParameter, derived.objective.Subject)
+		if err != nil {
+			return []repositories.StudentObjectiveProgress{}, err
+		}
+
+		derived.student.Evaluation = helpers.EvaluateObjective(derived.objective, completedTests, now)
+		students = append(students, derived.student)
+	}
+
+	return students, nil
+}
+
+func getGroupObjectiveFromQuery(record neo4j.Record) (repositories.GroupObjective, error) {
+	ID, err := helpers.GetIntParameterFromQuery(record, "go.ID", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	subjectName, err := helpers.GetStringParameterFromQuery(record, "subj.name", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	group, err := helpers.GetIntParameterFromQuery(record, "g.gID", true, false)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	timestampStart, err := helpers.GetIntParameterFromQuery(record, "go.timestampStart", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	timestampEnd, err := helpers.GetIntParameterFromQuery(record, "go.timestampEnd", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	targetGrade, err := helpers.GetIntParameterFromQuery(record, "go.target", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	targetShare, err := helpers.GetIntParameterFromQuery(record, "go.share", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	nrTests, err := helpers.GetIntParameterFromQuery(record, "go.nrTests", true, false)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	state, err := helpers.GetStringParameterFromQuery(record, "go.state", true, true)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	createdAt, err := helpers.GetIntParameterFromQuery(record, "go.createdAt", true, false)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+	closedAt, err := helpers.GetIntParameterFromQuery(record, "go.closedAt", true, false)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+
+	return repositories.GroupObjective{
+		ID:             ID,
+		Group:          group,
+		Subject:        subjectName,
+		TargetGrade:    targetGrade,
+		TargetShare:    targetShare,
+		StartTimestamp: timestampStart,
+		EndTimestamp:   timestampEnd,
+		NrTests:        nrTests,
+		State:          state,
+		CreatedAt:      createdAt,
+		ClosedAt:       closedAt,
+	}, nil
+}
@@ -0,0 +1,515 @@
+package datasources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func AddFaculty(session neo4j.Session, path string, token string, name string) error {
+	err := checkAdminName(session, path, token, "faculty", name)
+	if err != nil {
+		return err
+	}
+	err = checkNameAvailable(session, fmt.Sprintf("faculty '%s'", name), `
+		MATCH (f:Faculty {name:$name}) 
+		RETURN count(f) AS nr
+	`, map[string]interface{}{"name": name})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		CREATE (f:Faculty {name:$name})
+	`
+
+	return helpers.WriteTX(session, query, map[string]interface{}{"name": name})
+}
+
+func RenameFaculty(session neo4j.Session, path string, token string, faculty string, name string) error {
+	err := checkAdminName(session, path, token, "faculty", name)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"faculty": faculty,
+		"name":    name,
+	}
+	err = checkExists(session, fmt.Sprintf("faculty '%s'", faculty), `
+		MATCH (f:Faculty {name:$faculty}) 
+		RETURN count(f) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+	if name != faculty {
+		err = checkNameAvailable(session, fmt.Sprintf("faculty '%s'", name), `
+			MATCH (f:Faculty {name:$name}) 
+			RETURN count(f) AS nr
+		`, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		MATCH (f:Faculty {name:$faculty}) 
+		SET f.name = $name
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// DeleteFaculty removes a faculty which has no specializations and no affiliated teachers left.
+func DeleteFaculty(session neo4j.Session, path string, token string, faculty string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{"faculty": faculty}
+	err = checkNoReferences(session, fmt.Sprintf("faculty '%s'", faculty), `
+		MATCH (f:Faculty {name:$faculty}) 
+		RETURN size([(f)<-[:IN_FACULTY]-(spec:Specialization) | spec]) AS specializations, 
+			size([(f)<-[:AFILLIATED_TO]-(p:Teacher) | p]) AS teachers
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (f:Faculty {name:$faculty}) 
+		DETACH DELETE f
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func AddSpecialization(session neo4j.Session, path string, token string, faculty string, name string) error {
+	err := checkAdminName(session, path, token, "specialization", name)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"faculty": faculty,
+		"name":    name,
+	}
+	err = checkExists(session, fmt.Sprintf("faculty '%s'", faculty), `
+		MATCH (f:Faculty {name:$faculty}) 
+		RETURN count(f) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+	err = checkNameAvailable(session, fmt.Sprintf("specialization '%s' of faculty '%s'", name, faculty), `
+		MATCH (spec:Specialization {name:$name})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		RETURN count(spec) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (f:Faculty {name:$faculty}) 
+		CREATE (spec:Specialization {name:$name})-[:IN_FACULTY]->(f)
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func RenameSpecialization(session neo4j.Session, path string, token string, faculty string, specialization string, name string) error {
+	err := checkAdminName(session, path, token, "specialization", name)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"faculty":        faculty,
+		"specialization": specialization,
+		"name":           name,
+	}
+	err = checkExists(session, fmt.Sprintf("specialization '%s' of faculty '%s'", specialization, faculty), `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		RETURN count(spec) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+	if name != specialization {
+		err = checkNameAvailable(session, fmt.Sprintf("specialization '%s' of faculty '%s'", name, faculty), `
+			MATCH (spec:Specialization {name:$name})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+			RETURN count(spec) AS nr
+		`, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		SET spec.name = $name
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// DeleteSpecialization removes a specialization which has no groups left.
+func DeleteSpecialization(session neo4j.Session, path string, token string, faculty string, specialization string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{
+		"faculty":        faculty,
+		"specialization": specialization,
+	}
+	err = checkNoReferences(session, fmt.Sprintf("specialization '%s' of faculty '%s'", specialization, faculty), `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		RETURN size([(spec)<-[:HAS_SPECIALIZATION]-(g:Group) | g]) AS groups
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		DETACH DELETE spec
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func AddGroup(session neo4j.Session, path string, token string, group repositories.Group) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	err = checkGroup(session, group, helpers.EmptyIntParameter)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		CREATE (g:Group {gID:$gID})-[:HAS_SPECIALIZATION]->(spec)
+	`
+	params := map[string]interface{}{
+		"gID":            group.ID,
+		"specialization": group.Specialization,
+		"faculty":        group.Faculty,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// UpdateGroup renumbers a group or moves it to another specialization, keeping its students.
+func UpdateGroup(session neo4j.Session, path string, token string, gID int, group repositories.Group) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{
+		"gID":            gID,
+		"newGID":         group.ID,
+		"specialization": group.Specialization,
+		"faculty":        group.Faculty,
+	}
+	err = checkExists(session, fmt.Sprintf("group %d", gID), `
+		MATCH (g:Group {gID:$gID}) 
+		RETURN count(g) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+	err = checkGroup(session, group, gID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (g:Group {gID:$gID}), (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		OPTIONAL MATCH (g)-[previous:HAS_SPECIALIZATION]->(:Specialization) 
+		DELETE previous 
+		WITH DISTINCT g, spec 
+		SET g.gID = $newGID 
+		CREATE (g)-[:HAS_SPECIALIZATION]->(spec)
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// DeleteGroup removes a group which has no students and no group objectives left.
+func DeleteGroup(session neo4j.Session, path string, token string, gID int) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{"gID": gID}
+	err = checkNoReferences(session, fmt.Sprintf("group %d", gID), `
+		MATCH (g:Group {gID:$gID}) 
+		RETURN size([(g)<-[:MEMBER_OF]-(s:Student) | s]) AS students, 
+			size([(g)<-[:FOR_GROUP]-(go:GroupObjective) | go]) AS objectives
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (g:Group {gID:$gID}) 
+		DETACH DELETE g
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func AddSubject(session neo4j.Session, path string, token string, name string) error {
+	err := checkAdminName(session, path, token, "subject", name)
+	if err != nil {
+		return err
+	}
+	err = checkNameAvailable(session, fmt.Sprintf("subject '%s'", name), `
+		MATCH (subj:Subject {name:$name}) 
+		RETURN count(subj) AS nr
+	`, map[string]interface{}{"name": name})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		CREATE (subj:Subject {name:$name})
+	`
+
+	return helpers.WriteTX(session, query, map[string]interface{}{"name": name})
+}
+
+func RenameSubject(session neo4j.Session, path string, token string, subject string, name string) error {
+	err := checkAdminName(session, path, token, "subject", name)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"subject": subject,
+		"name":    name,
+	}
+	err = checkExists(session, fmt.Sprintf("subject '%s'", subject), `
+		MATCH (subj:Subject {name:$subject}) 
+		RETURN count(subj) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+	if name != subject {
+		err = checkNameAvailable(session, fmt.Sprintf("subject '%s'", name), `
+			MATCH (subj:Subject {name:$name}) 
+			RETURN count(subj) AS nr
+		`, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		MATCH (subj:Subject {name:$subject}) 
+		SET subj.name = $name
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// DeleteSubject removes a subject nobody teaches, studies or set objectives for and which has no tests.
+// Duplicates still in use are merged with MergeSubjects instead.
+func DeleteSubject(session neo4j.Session, path string, token string, subject string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{"subject": subject}
+	err = checkNoReferences(session, fmt.Sprintf("subject '%s'", subject), `
+		MATCH (subj:Subject {name:$subject}) 
+		RETURN size([(subj)<-[:BELONGS_TO]-(t:Test) | t]) AS tests, 
+			size([(subj)<-[:ENROLLED_IN]-(s:Student) | s]) AS students, 
+			size([(subj)<-[:TEACHES]-(p:Teacher) | p]) AS teachers, 
+			size([(subj)<-[:FOR_SUBJECT]-(o) | o]) AS objectives
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (subj:Subject {name:$subject}) 
+		DETACH DELETE subj
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// MergeSubjects moves the tests, enrolments, teachers and objectives of a duplicate subject to the subject
+// it duplicates and removes the duplicate, all in one transaction.
+func MergeSubjects(session neo4j.Session, path string, token string, subject string, into string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if subject == into {
+		return fmt.Errorf("subject '%s' cannot be merged into itself", subject)
+	}
+	params := map[string]interface{}{
+		"subject": subject,
+		"into":    into,
+	}
+	for _, name := range []string{subject, into} {
+		err = checkExists(session, fmt.Sprintf("subject '%s'", name), `
+			MATCH (subj:Subject {name:$name}) 
+			RETURN count(subj) AS nr
+		`, map[string]interface{}{"name": name})
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		MATCH (duplicate:Subject {name:$subject}), (target:Subject {name:$into}) 
+		OPTIONAL MATCH (s:Student)-[:ENROLLED_IN]->(duplicate) 
+		FOREACH (student IN CASE WHEN s IS NULL THEN [] ELSE [s] END | MERGE (student)-[:ENROLLED_IN]->(target)) 
+		WITH DISTINCT duplicate, target 
+		OPTIONAL MATCH (p:Teacher)-[:TEACHES]->(duplicate) 
+		FOREACH (teacher IN CASE WHEN p IS NULL THEN [] ELSE [p] END | MERGE (teacher)-[:TEACHES]->(target)) 
+		WITH DISTINCT duplicate, target 
+		OPTIONAL MATCH (t:Test)-[:BELONGS_TO]->(duplicate) 
+		FOREACH (test IN CASE WHEN t IS NULL THEN [] ELSE [t] END | MERGE (test)-[:BELONGS_TO]->(target)) 
+		WITH DISTINCT duplicate, target 
+		OPTIONAL MATCH (o)-[:FOR_SUBJECT]->(duplicate) 
+		FOREACH (objective IN CASE WHEN o IS NULL THEN [] ELSE [o] END | MERGE (objective)-[:FOR_SUBJECT]->(target)) 
+		WITH DISTINCT duplicate 
+		DETACH DELETE duplicate
+	`
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func checkAdminName(session neo4j.Session, path string, token string, kind string, name string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if strings.TrimSpace(name) == helpers.EmptyStringParameter {
+		return fmt.Errorf("%s needs a name", kind)
+	}
+
+	return nil
+}
+
+// checkGroup makes sure the group number is free, unless it is the current number of the group, and that
+// the specialization the group is placed in exists.
+func checkGroup(session neo4j.Session, group repositories.Group, currentGID int) error {
+	if group.ID <= 0 {
+		return fmt.Errorf("group needs a positive number")
+	}
+	params := map[string]interface{}{
+		"gID":            group.ID,
+		"specialization": group.Specialization,
+		"faculty":        group.Faculty,
+	}
+	if group.ID != currentGID {
+		err := checkNameAvailable(session, fmt.Sprintf("group %d", group.ID), `
+			MATCH (g:Group {gID:$gID}) 
+			RETURN count(g) AS nr
+		`, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkExists(session, fmt.Sprintf("specialization '%s' of faculty '%s'", group.Specialization, group.Faculty), `
+		MATCH (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f:Faculty {name:$faculty}) 
+		RETURN count(spec) AS nr
+	`, params)
+}
+
+func checkExists(session neo4j.Session, entity string, query string, params map[string]interface{}) error {
+	nr, err := countNodes(session, query, params)
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		return fmt.Errorf("%s does not exist", entity)
+	}
+
+	return nil
+}
+
+func checkNameAvailable(session neo4j.Session, entity string, query string, params map[string]interface{}) error {
+	nr, err := countNodes(session, query, params)
+	if err != nil {
+		return err
+	}
+	if nr > 0 {
+		return fmt.Errorf("%s already exists", entity)
+	}
+
+	return nil
+}
+
+func countNodes(session neo4j.Session, query string, params map[string]interface{}) (int, error) {
+	nr, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return 0, err
+		}
+		if !records.Next() {
+			return 0, nil
+		}
+
+		return helpers.GetIntParameterFromQuery(records.Record(), "nr", true, true)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return nr.(int), nil
+}
+
+// checkNoReferences fails when the entity matched by the query does not exist or is still referenced.
+// The query has to return a single row with the number of references of every kind.
+func checkNoReferences(session neo4j.Session, entity string, query string, params map[string]interface{}) error {
+	references, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []string
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []string{}, err
+		}
+		if !records.Next() {
+			return []string{}, fmt.Errorf("%s does not exist", entity)
+		}
+
+		record := records.Record()
+		for _, key := range record.Keys() {
+			nr, err := helpers.GetIntParameterFromQuery(record, key, true, true)
+			if err != nil {
+				return []string{}, err
+			}
+			if nr > 0 {
+				results = append(results, fmt.Sprintf("%d %s", nr, key))
+			}
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if used := references.([]string); len(used) > 0 {
+		return fmt.Errorf("%s is still used by %s", entity, strings.Join(used, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package datasources
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// InviteStudents adds the students a teacher invites by email to a group and emails them a link to create
+// their account. Students who already have an account are left as they are, while students who were invited
+// before are moved to the group and invited again.
+func InviteStudents(session neo4j.Session, path string, token string, gID int, emails []string, accounts *helpers.AccountMailer) ([]repositories.InvitationReport, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return []repositories.InvitationReport{}, helpers.InvalidTokenError(path, err)
+	}
+	err = checkExists(session, fmt.Sprintf("group %d", gID), `
+		MATCH (g:Group {gID:$gID}) 
+		RETURN count(g) AS nr
+	`, map[string]interface{}{"gID": gID})
+	if err != nil {
+		return []repositories.InvitationReport{}, err
+	}
+	teacher, err := getTeacherName(session, tokenInfo.ID)
+	if err != nil {
+		return []repositories.InvitationReport{}, err
+	}
+
+	lowerEmails := []string{}
+	for _, email := range emails {
+		lowerEmails = append(lowerEmails, strings.ToLower(strings.TrimSpace(email)))
+	}
+	existing, err := getInvitedEmails(session, lowerEmails)
+	if err != nil {
+		return []repositories.InvitationReport{}, err
+	}
+
+	reports := []repositories.InvitationReport{}
+	invited := make(map[string]bool)
+	for _, email := range emails {
+		email = strings.TrimSpace(email)
+		if email == helpers.EmptyStringParameter || invited[strings.ToLower(email)] {
+			continue
+		}
+		invited[strings.ToLower(email)] = true
+
+		report := repositories.InvitationReport{Email: email, Status: helpers.InvitationStatusInvalid}
+		user, exists := existing[strings.ToLower(email)]
+		address, err := mail.ParseAddress(email)
+		switch {
+		case err != nil || address.Address != email:
+			report.Error = fmt.Sprintf("'%s' is not a valid email address", email)
+		case exists && user.Type != repositories.StudentType:
+			report.Error = fmt.Sprintf("email '%s' belongs to a teacher or administrator", email)
+		case exists && user.Status != helpers.UserStatusInvited:
+			report.Status = helpers.InvitationStatusRegistered
+		default:
+			err = inviteStudent(session, tokenInfo.ID, gID, user.ID, email, teacher, accounts)
+			if err != nil {
+				report.Error = err.Error()
+				break
+			}
+			report.Status = helpers.InvitationStatusInvited
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// GetInvitation returns the invitation a student follows, so the sign-up can show who invited them and where.
+func GetInvitation(session neo4j.Session, path string, code string, accounts *helpers.AccountMailer) (repositories.Invitation, error) {
+	_, invitation, err := getInvitation(session, code, accounts)
+
+	return invitation, err
+}
+
+// inviteStudent adds an invited student with no password to the group, unless studentID points to a student
+// invited before, and emails them the invitation.
+func inviteStudent(session neo4j.Session, teacherID int, gID int, studentID int, email string, teacherName string, accounts *helpers.AccountMailer) error {
+	var err error
+	if studentID == 0 {
+		studentID, err = getNextNodeID(session, "Student", "ID")
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		MATCH (g:Group {gID:$gID}), (p:Teacher {ID:$teacherID}) 
+		MERGE (s:Student {ID:$studentID}) 
+		ON CREATE SET s.email = $email, s.status = $invited, s.emailVerified = false 
+		WITH s, g, p 
+		OPTIONAL MATCH (s)-[membership:MEMBER_OF]->(:Group) 
+		DELETE membership 
+		WITH DISTINCT s, g, p 
+		MERGE (s)-[:MEMBER_OF]->(g) 
+		MERGE (p)-[i:INVITED]->(s) 
+		SET i.createdAt = $now
+	`
+	params := map[string]interface{}{
+		"gID":       gID,
+		"teacherID": teacherID,
+		"studentID": studentID,
+		"email":     email,
+		"invited":   helpers.UserStatusInvited,
+		"now":       time.Now().Unix(),
+	}
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return err
+	}
+
+	invitation := helpers.InvitationEmail{
+		Email:       email,
+		TeacherName: teacherName,
+		Group:       gID,
+	}
+
+	return accounts.SendInvitation(invitation, fmt.Sprintf("%d:%s", studentID, strings.ToLower(email)))
+}
+
+// getInvitedStudent fills in the account a student was invited with. The student has to sign up with the
+// address the invitation was sent to and joins the group they were invited to.
+func getInvitedStudent(session neo4j.Session, code string, student repositories.Student, accounts *helpers.AccountMailer) (repositories.Student, error) {
+	studentID, invitation, err := getInvitation(session, code, accounts)
+	if err != nil {
+		return repositories.Student{}, err
+	}
+	if student.Email != helpers.EmptyStringParameter && !strings.EqualFold(student.Email, invitation.Email) {
+		return repositories.Student{}, fmt.Errorf("invitation was sent to another email address")
+	}
+
+	student.ID = studentID
+	student.Email = invitation.Email
+	student.Group = invitation.Group
+
+	return student, nil
+}
+
+// acceptInvitation activates the account of an invited student who signed up. Following the link proved
+// they own the address, so it is verified as well.
+func acceptInvitation(session neo4j.Session, studentID int) error {
+	query := `
+		MATCH (s:Student {ID:$studentID}) 
+		SET s.status = $active, s.emailVerified = true, s.emailVerifiedAt = $now
+	`
+	params := map[string]interface{}{
+		"studentID": studentID,
+		"active":    helpers.UserStatusActive,
+		"now":       time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func getInvitation(session neo4j.Session, code string, accounts *helpers.AccountMailer) (int, repositories.Invitation, error) {
+	subject, err := accounts.VerifyLink(helpers.LinkPurposeInvitation, code)
+	if err != nil {
+		return 0, repositories.Invitation{}, err
+	}
+	fields := strings.SplitN(subject, ":", 2)
+	if len(fields) != 2 {
+		return 0, repositories.Invitation{}, fmt.Errorf("link is not valid")
+	}
+	studentID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, repositories.Invitation{}, fmt.Errorf("link is not valid")
+	}
+
+	query := `
+		MATCH (s:Student {ID:$studentID}) 
+		WHERE s.status = $invited AND toLower(s.email) = $email 
+		OPTIONAL MATCH (s)-[:MEMBER_OF]->(g:Group) 
+		OPTIONAL MATCH (g)-[:HAS_SPECIALIZATION]->(spec:Specialization)-[:IN_FACULTY]->(f:Faculty) 
+		OPTIONAL MATCH (p:Teacher)-[i:INVITED]->(s) 
+		RETURN s.email, g.gID, spec.name, f.name, p.email, p.firstName, p.lastName 
+		ORDER BY i.createdAt DESC 
+		LIMIT 1
+	`
+	params := map[string]interface{}{
+		"studentID": studentID,
+		"email":     fields[1],
+		"invited":   helpers.UserStatusInvited,
+	}
+
+	invitation, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return repositories.Invitation{}, err
+		}
+		if !records.Next() {
+			return repositories.Invitation{}, fmt.Errorf("invitation has already been accepted or withdrawn")
+		}
+
+		return getInvitationFromQuery(records.Record())
+	})
+	if err != nil {
+		return 0, repositories.Invitation{}, err
+	}
+
+	return studentID, invitation.(repositories.Invitation), nil
+}
+
+// getInvitedEmails looks up the users already using the invited addresses.
+func getInvitedEmails(session neo4j.Session, emails []string) (map[string]repositories.ManagedUser, error) {
+	query := `
+		MATCH (n) 
+		WHERE (n:Student OR n:Teacher OR n:Admin) AND toLower(n.email) IN $emails 
+		RETURN toLower(n.email) AS email, n.ID, n:Student AS isStudent, coalesce(n.status, $active) AS status
+	`
+	params := map[string]interface{}{
+		"emails": emails,
+		"active": helpers.UserStatusActive,
+	}
+
+	users, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := make(map[string]repositories.ManagedUser)
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return results, err
+		}
+		for records.Next() {
+			record := records.Record()
+			email, err := helpers.GetStringParameterFromQuery(record, "email", true, true)
+			if err != nil {
+				return results, err
+			}
+			ID, err := helpers.GetIntParameterFromQuery(record, "n.ID", true, true)
+			if err != nil {
+				return results, err
+			}
+			status, err := helpers.GetStringParameterFromQuery(record, "status", true, true)
+			if err != nil {
+				return results, err
+			}
+			user := repositories.ManagedUser{User: repositories.User{ID: ID, Email: email}, Status: status}
+			user.Type, err = getUserTypeFromQuery(record)
+			if err != nil {
+				return results, err
+			}
+
+			results[email] = user
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users.(map[string]repositories.ManagedUser), nil
+}
+
+func getTeacherName(session neo4j.Session, teacherID int) (string, error) {
+	query := `
+		MATCH (p:Teacher {ID:$userID}) 
+		RETURN trim(coalesce(p.firstName, '') + ' ' + coalesce(p.lastName, '')) AS name
+	`
+
+	return getManagedUserProperty(session, query, teacherID, "name")
+}
+
+func getInvitationFromQuery(record neo4j.Record) (repositories.Invitation, error) {
+	email, err := helpers.GetStringParameterFromQuery(record, "s.email", true, true)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	group, err := helpers.GetIntParameterFromQuery(record, "g.gID", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	specialization, err := helpers.GetStringParameterFromQuery(record, "spec.name", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	faculty, err := helpers.GetStringParameterFromQuery(record, "f.name", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	teacherEmail, err := helpers.GetStringParameterFromQuery(record, "p.email", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	teacherFirstName, err := helpers.GetStringParameterFromQuery(record, "p.firstName", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+	teacherLastName, err := helpers.GetStringParameterFromQuery(record, "p.lastName", true, false)
+	if err != nil {
+		return repositories.Invitation{}, err
+	}
+
+	return repositories.Invitation{
+		Email:          email,
+		Group:          group,
+		Specialization: specialization,
+		Faculty:        faculty,
+		InvitedBy: repositories.User{
+			Type:      repositories.TeacherType,
+			Email:     teacherEmail,
+			FirstName: teacherFirstName,
+			LastName:  teacherLastName,
+		},
+	}, nil
+}
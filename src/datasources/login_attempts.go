@@ -0,0 +1,150 @@
+package datasources
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// RecordFailedLogin keeps a failed login for the audit of administrators, along with the account it was
+// meant for when the email belongs to one. Unlike the caller, administrators get to see why it failed.
+func RecordFailedLogin(session neo4j.Session, email string, ip string, reason string, locked bool) error {
+	query := `
+		CREATE (l:LoginAttempt {email:$email, ip:$ip, reason:$reason, locked:$locked, createdAt:$now}) 
+		WITH l 
+		OPTIONAL MATCH (n) 
+		WHERE (n:Student OR n:Teacher OR n:Admin) AND toLower(n.email) = toLower($email) 
+		FOREACH (account IN CASE WHEN n IS NULL THEN [] ELSE [n] END | 
+			CREATE (l)-[:FOR_ACCOUNT]->(account))
+	`
+	params := map[string]interface{}{
+		"email":  email,
+		"ip":     ip,
+		"reason": reason,
+		"locked": locked,
+		"now":    time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// PurgeLoginAttempts removes the failed logins older than the retention period. It is run periodically
+// in the background along with PurgeArchived.
+func PurgeLoginAttempts(session neo4j.Session, retention time.Duration) error {
+	query := `
+		MATCH (l:LoginAttempt) 
+		WHERE l.createdAt < $before 
+		DETACH DELETE l
+	`
+	params := map[string]interface{}{
+		"before": time.Now().Add(-retention).Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// GetFailedLogins lists the failed logins for administrators, newest first, optionally only the ones since
+// a time and whose email or address contains the search string.
+func GetFailedLogins(session neo4j.Session, path string, token string, searchString string, since int) ([]repositories.LoginAttempt, error) {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return []repositories.LoginAttempt{}, helpers.InvalidTokenError(path, err)
+	}
+
+	query := `
+		MATCH (l:LoginAttempt) 
+		WHERE l.createdAt >= $since AND (toLower(l.email) CONTAINS $search OR l.ip CONTAINS $search) 
+		OPTIONAL MATCH (l)-[:FOR_ACCOUNT]->(n) 
+		RETURN l.email, l.ip, l.reason, l.locked, l.createdAt, n.ID, n.email, n.firstName, n.lastName, 
+			n:Student AS isStudent, n:Admin AS isAdmin 
+		ORDER BY l.createdAt DESC
+	`
+	params := map[string]interface{}{
+		"search": strings.ToLower(searchString),
+		"since":  since,
+	}
+
+	attempts, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := []repositories.LoginAttempt{}
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.LoginAttempt{}, err
+		}
+		for records.Next() {
+			attempt, err := getLoginAttemptFromQuery(records.Record())
+			if err != nil {
+				return []repositories.LoginAttempt{}, err
+			}
+
+			results = append(results, attempt)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.LoginAttempt{}, err
+	}
+
+	return attempts.([]repositories.LoginAttempt), nil
+}
+
+func getLoginAttemptFromQuery(record neo4j.Record) (repositories.LoginAttempt, error) {
+	email, err := helpers.GetStringParameterFromQuery(record, "l.email", true, false)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	ip, err := helpers.GetStringParameterFromQuery(record, "l.ip", true, true)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	reason, err := helpers.GetStringParameterFromQuery(record, "l.reason", true, false)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	locked, err := helpers.GetBoolParameterFromQuery(record, "l.locked", true, false)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	createdAt, err := helpers.GetIntParameterFromQuery(record, "l.createdAt", true, true)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	attempt := repositories.LoginAttempt{
+		Email:     email,
+		IP:        ip,
+		Reason:    reason,
+		Locked:    locked,
+		CreatedAt: createdAt,
+	}
+
+	userID, err := helpers.GetIntParameterFromQuery(record, "n.ID", true, false)
+	if err != nil || userID == 0 {
+		return attempt, err
+	}
+	user, err := getManagedUserIdentityFromQuery(record, "n")
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	isAdmin, err := helpers.GetBoolParameterFromQuery(record, "isAdmin", true, true)
+	if err != nil {
+		return repositories.LoginAttempt{}, err
+	}
+	user.Type = repositories.AdminType
+	if !isAdmin {
+		user.Type, err = getUserTypeFromQuery(record)
+		if err != nil {
+			return repositories.LoginAttempt{}, err
+		}
+	}
+	attempt.User = &user
+
+	return attempt, nil
+}
@@ -0,0 +1,125 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func GetNotifications(session neo4j.Session, path string, token string, unreadOnly bool) ([]repositories.Notification, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return []repositories.Notification{}, helpers.InvalidTokenError(path, err)
+	}
+
+	extraCondition := ""
+	if unreadOnly {
+		extraCondition = " AND n.readAt IS NULL "
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s)-[:HAS_NOTIFICATION]->(n:Notification) 
+		WHERE u.ID = $ID %s 
+		OPTIONAL MATCH (n)-[:ABOUT]->(t:Test)-[:BELONGS_TO]->(subj:Subject) 
+		RETURN n.ID, n.type, n.message, n.payload, n.createdAt, n.readAt, t.testID, t.name, subj.name 
+		ORDER BY n.createdAt DESC
+	`, tokenInfo.Label, extraCondition)
+
+	notifications, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []repositories.Notification
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"ID": tokenInfo.ID})
+		if err != nil {
+			return []repositories.Notification{}, err
+		}
+
+		for records.Next() {
+			notification, err := helpers.GetNotificationFromQuery(records.Record())
+			if err != nil {
+				return []repositories.Notification{}, err
+			}
+
+			results = append(results, notification)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.Notification{}, err
+	}
+
+	return notifications.([]repositories.Notification), nil
+}
+
+func MarkNotificationRead(session neo4j.Session, path string, token string, notificationID int) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID})-[:HAS_NOTIFICATION]->(n:Notification {ID:$notificationID}) 
+		WHERE n.readAt IS NULL 
+		SET n.readAt = $readAt
+	`, tokenInfo.Label)
+	params := map[string]interface{}{
+		"ID":             tokenInfo.ID,
+		"notificationID": notificationID,
+		"readAt":         time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func MarkAllNotificationsRead(session neo4j.Session, path string, token string) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$ID})-[:HAS_NOTIFICATION]->(n:Notification) 
+		WHERE n.readAt IS NULL 
+		SET n.readAt = $readAt
+	`, tokenInfo.Label)
+	params := map[string]interface{}{
+		"ID":     tokenInfo.ID,
+		"readAt": time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func getUnreadNotificationCount(session neo4j.Session, tokenInfo repositories.TokenInfo) (int, error) {
+	query := fmt.Sprintf(`
+		MATCH (u:%s)-[:HAS_NOTIFICATION]->(n:Notification) 
+		WHERE u.ID = $ID AND n.readAt IS NULL 
+		RETURN count(n) AS unread
+	`, tokenInfo.Label)
+
+	count, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"ID": tokenInfo.ID})
+		if err != nil {
+			return 0, err
+		}
+		for records.Next() {
+			return helpers.GetIntParameterFromQuery(records.Record(), "unread", true, true)
+		}
+
+		return 0, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count.(int), nil
+}
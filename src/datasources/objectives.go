@@ -2,6 +2,7 @@ package datasources
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 
@@ -9,13 +10,13 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func GetObjectives(session neo4j.Session, path string, token string, subject string, search string) ([]repositories.Objective, error) {
+func GetObjectives(session neo4j.Session, path string, token string, subject string, search string, state string) ([]repositories.Objective, error) {
 	tokenInfo, err := GetTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.StudentLabel {
 		return []repositories.Objective{}, helpers.InvalidTokenError(path, err)
 	}
 
-	objectives, err := getObjectivesWithoutCompletedTestsForStudent(session, tokenInfo.ID, subject, search)
+	objectives, err := getObjectivesWithoutCompletedTestsForStudent(session, tokenInfo.ID, subject, search, state)
 	if err != nil {
 		return []repositories.Objective{}, err
 	}
@@ -25,54 +26,320 @@ func GetObjectives(session neo4j.Session, path string, token string, subject str
 			session,
 			tokenInfo.ID,
 			helpers.EmptyStringParameter,
-			objective.Tests[0].Subject,
+			objective.Subject,
 		)
 		if err != nil {
 			return []repositories.Objective{}, err
 		}
 
-		objectives[index].Tests = completedTests
+		objectives[index].Tests = helpers.GetTestsInObjectiveWindow(objective, completedTests)
+		objectives[index].Evaluation = helpers.EvaluateObjective(objective, completedTests, int(time.Now().Unix()))
 	}
 
 	return objectives, nil
 }
 
+// AddObjective always creates a new objective, so several of them can be kept for the same subject.
 func AddObjective(session neo4j.Session, path string, token string, subject string, objective repositories.Objective) error {
 	tokenInfo, err := GetTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.StudentLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
-
-	nextID := objective.ID
-	if objective.ID == 0 {
-		nextID, err = getNextRelationshipID(session, "SET_OBJECTIVE", "ID")
-		if err != nil {
-			return err
-		}
+	err = helpers.ValidateObjective(objective)
+	if err != nil {
+		return err
 	}
 
-	query := fmt.Sprintf(`
-		MATCH (s:Student {ID:$studentID}), (subj:Subject {name:'%s'}) 
-		MERGE (s)-[ssubj:SET_OBJECTIVE]->(subj) 
-		SET ssubj.ID=$nextID, ssubj.timestampStart=$ts, ssubj.timestampEnd=$te, ssubj.target=$target 
-	`, subject)
+	nextID, err := getNextNodeID(session, "Objective", "ID")
+	if err != nil {
+		return err
+	}
 
+	query := `
+		MATCH (s:Student {ID:$studentID}), (subj:Subject {name:$subject}) 
+		CREATE (s)-[:HAS_OBJECTIVE]->(o:Objective {ID:$nextID})-[:FOR_SUBJECT]->(subj) 
+		SET o.timestampStart=$ts, o.timestampEnd=$te, o.target=$target, o.nrTests=$nrTests, 
+			o.state=$state, o.createdAt=$createdAt
+	`
 	params := map[string]interface{}{
 		"studentID": tokenInfo.ID,
+		"subject":   subject,
+		"nextID":    nextID,
 		"ts":        objective.StartTimestamp,
 		"te":        objective.EndTimestamp,
 		"target":    objective.TargetGrade,
-		"nextID":    nextID,
+		"nrTests":   objective.NrTests,
+		"state":     helpers.ObjectiveStateActive,
+		"createdAt": time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// UpdateObjective changes the target and window of an active objective or closes it by setting its state
+// to completed or abandoned. Closed objectives are kept as history and cannot be changed anymore.
+func UpdateObjective(session neo4j.Session, path string, token string, objectiveID int, objective repositories.Objective) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.StudentLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+	err = helpers.ValidateObjective(objective)
+	if err != nil {
+		return err
+	}
+
+	state := objective.State
+	if state == helpers.EmptyStringParameter {
+		state = helpers.ObjectiveStateActive
+	}
+	if !helpers.IsObjectiveState(state) {
+		return fmt.Errorf("unknown objective state '%s'", state)
+	}
+
+	currentState, derived, err := getObjectiveState(session, tokenInfo.ID, objectiveID)
+	if err != nil {
+		return err
+	}
+	if derived {
+		return fmt.Errorf("objective %d was set by a teacher and can only be changed by them", objectiveID)
+	}
+	if currentState != helpers.ObjectiveStateActive {
+		return fmt.Errorf("objective %d is %s and can no longer be changed", objectiveID, currentState)
+	}
+
+	query := `
+		MATCH (s:Student {ID:$studentID})-[:HAS_OBJECTIVE]->(o:Objective {ID:$objectiveID}) 
+		SET o.timestampStart=$ts, o.timestampEnd=$te, o.target=$target, o.nrTests=$nrTests, o.state=$state, 
+			o.closedAt = CASE WHEN $state = $active THEN null ELSE $now END, o.status = null 
+		REMOVE o.legacyTarget
+	`
+	params := map[string]interface{}{
+		"studentID":   tokenInfo.ID,
+		"objectiveID": objectiveID,
+		"ts":          objective.StartTimestamp,
+		"te":          objective.EndTimestamp,
+		"target":      objective.TargetGrade,
+		"nrTests":     objective.NrTests,
+		"state":       state,
+		"active":      helpers.ObjectiveStateActive,
+		"now":         time.Now().Unix(),
 	}
 
 	return helpers.WriteTX(session, query, params)
 }
 
-func getObjectivesWithoutCompletedTestsForStudent(session neo4j.Session, studentID int, subject string, searchString string) ([]repositories.Objective, error) {
+// DeleteObjective removes an objective set by mistake. Closed objectives are history and stay.
+func DeleteObjective(session neo4j.Session, path string, token string, objectiveID int) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.StudentLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	currentState, derived, err := getObjectiveState(session, tokenInfo.ID, objectiveID)
+	if err != nil {
+		return err
+	}
+	if derived {
+		return fmt.Errorf("objective %d was set by a teacher and can only be removed by them", objectiveID)
+	}
+	if currentState != helpers.ObjectiveStateActive {
+		return fmt.Errorf("objective %d is %s and is kept as history", objectiveID, currentState)
+	}
+
+	query := `
+		MATCH (s:Student {ID:$studentID})-[:HAS_OBJECTIVE]->(o:Objective {ID:$objectiveID}) 
+		DETACH DELETE o
+	`
+	params := map[string]interface{}{
+		"studentID":   tokenInfo.ID,
+		"objectiveID": objectiveID,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// EvaluateObjectives checks the active objectives of every student and notifies them when an objective
+// becomes at risk, is achieved or is missed. Objectives whose window is over are completed, together with
+// the group objectives they may be derived from. It is run periodically in the background.
+func EvaluateObjectives(session neo4j.Session, dispatcher *helpers.NotificationDispatcher) error {
+	query := `
+		MATCH (s:Student)-[:HAS_OBJECTIVE]->(o:Objective)-[:FOR_SUBJECT]->(subj:Subject) 
+		WHERE o.state = $active AND NOT coalesce(s.archived, false) 
+		RETURN s.ID, subj.name, o.ID, o.timestampStart, o.timestampEnd, o.target, o.nrTests, o.state, o.createdAt, o.closedAt, o.status
+	`
+
+	type storedObjective struct {
+		studentID int
+		status    string
+		objective repositories.Objective
+	}
+
+	stored, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []storedObjective
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"active": helpers.ObjectiveStateActive})
+		if err != nil {
+			return []storedObjective{}, err
+		}
+
+		for records.Next() {
+			record := records.Record()
+			studentID, err := helpers.GetIntParameterFromQuery(record, "s.ID", true, true)
+			if err != nil {
+				return []storedObjective{}, err
+			}
+			status, err := helpers.GetStringParameterFromQuery(record, "o.status", true, false)
+			if err != nil {
+				return []storedObjective{}, err
+			}
+			objective, err := getObjectiveFromQuery(record)
+			if err != nil {
+				return []storedObjective{}, err
+			}
+
+			results = append(results, storedObjective{studentID: studentID, status: status, objective: objective})
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := int(time.Now().Unix())
+	for _, stored := range stored.([]storedObjective) {
+		completedTests, err := getAllCompletedTestsForStudent(session, stored.studentID, helpers.EmptyStringParameter, stored.objective.Subject)
+		if err != nil {
+			return err
+		}
+
+		evaluation := helpers.EvaluateObjective(stored.objective, completedTests, now)
+		windowOver := now > stored.objective.EndTimestamp
+		if evaluation.Status == stored.status && !windowOver {
+			continue
+		}
+
+		err = updateObjectiveStatus(session, stored.studentID, stored.objective, evaluation, windowOver, evaluation.Status != stored.status, dispatcher)
+		if err != nil {
+			return err
+		}
+	}
+
+	return completeGroupObjectives(session)
+}
+
+// legacyObjectiveScale is the grade scale objectives used before their targets became percentages.
+const legacyObjectiveScale = 10
+
+// MigrateObjectiveRelationships turns the objectives stored on SET_OBJECTIVE relationships into
+// Objective nodes, keeping their IDs. It does nothing once every relationship has been converted.
+// Those objectives targeted a grade rather than a percentage of the test points. Grades up to 10 are
+// taken as grades out of 10, anything else is capped at 100, and the old target is kept as
+// legacyTarget so the student can check it until they update the objective.
+func MigrateObjectiveRelationships(session neo4j.Session) error {
+	query := `
+		MATCH (s:Student)-[ssubj:SET_OBJECTIVE]->(subj:Subject) 
+		CREATE (s)-[:HAS_OBJECTIVE]->(o:Objective {ID:ssubj.ID})-[:FOR_SUBJECT]->(subj) 
+		SET o.timestampStart=ssubj.timestampStart, o.timestampEnd=ssubj.timestampEnd, o.legacyTarget=ssubj.target, 
+			o.target = CASE WHEN ssubj.target <= $legacyScale THEN ssubj.target * 100 / $legacyScale 
+				WHEN ssubj.target > 100 THEN 100 ELSE ssubj.target END, 
+			o.nrTests=ssubj.nrTests, o.status=ssubj.status, o.state=$active, o.createdAt=$now 
+		DELETE ssubj
+	`
+	params := map[string]interface{}{
+		"legacyScale": legacyObjectiveScale,
+		"active":      helpers.ObjectiveStateActive,
+		"now":         time.Now().Unix(),
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func updateObjectiveStatus(session neo4j.Session, studentID int, objective repositories.Objective, evaluation repositories.ObjectiveEvaluation,
+	complete bool, notify bool, dispatcher *helpers.NotificationDispatcher,
+) error {
+	query := `
+		MATCH (s:Student {ID:$studentID})-[:HAS_OBJECTIVE]->(o:Objective {ID:$objectiveID}) 
+		SET o.status = $status 
+		FOREACH (_ IN CASE WHEN $complete THEN [1] ELSE [] END | SET o.state = $completed, o.closedAt = $now)
+	`
+	params := map[string]interface{}{
+		"studentID":   studentID,
+		"objectiveID": objective.ID,
+		"status":      evaluation.Status,
+		"complete":    complete,
+		"completed":   helpers.ObjectiveStateCompleted,
+		"now":         time.Now().Unix(),
+	}
+
+	err := helpers.WriteTX(session, query, params)
+	if err != nil {
+		return err
+	}
+
+	message, ok := helpers.ObjectiveStatusNotifications[evaluation.Status]
+	if !notify || !ok {
+		return nil
+	}
+
+	return dispatcher.Notify(session, `
+		MATCH (u:Student {ID:$studentID})
+	`, params, repositories.Notification{
+		Type:    helpers.NotificationTypeObjectiveStatus,
+		Message: message,
+		Payload: repositories.NotificationPayload{
+			Subject:   objective.Subject,
+			Objective: objective.ID,
+			Status:    evaluation.Status,
+		},
+	})
+}
+
+// getObjectiveState returns the state of a student objective and whether it was derived from a group objective.
+func getObjectiveState(session neo4j.Session, studentID int, objectiveID int) (string, bool, error) {
+	query := `
+		MATCH (s:Student {ID:$studentID})-[:HAS_OBJECTIVE]->(o:Objective {ID:$objectiveID}) 
+		RETURN o.state, exists((o)-[:DERIVED_FROM]->(:GroupObjective)) AS derived
+	`
+	params := map[string]interface{}{
+		"studentID":   studentID,
+		"objectiveID": objectiveID,
+	}
+
+	var derived bool
+	state, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+		if !records.Next() {
+			return helpers.EmptyStringParameter, fmt.Errorf("objective %d does not exist", objectiveID)
+		}
+
+		derived, err = helpers.GetBoolParameterFromQuery(records.Record(), "derived", true, true)
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+
+		return helpers.GetStringParameterFromQuery(records.Record(), "o.state", true, true)
+	})
+	if err != nil {
+		return helpers.EmptyStringParameter, false, err
+	}
+
+	return state.(string), derived, nil
+}
+
+func getObjectivesWithoutCompletedTestsForStudent(session neo4j.Session, studentID int, subject string, searchString string, state string) ([]repositories.Objective, error) {
 	extraCondition := ""
 	extraConditionSearch := ""
 	if subject != helpers.EmptyStringParameter {
-		extraCondition = fmt.Sprintf(" AND subj.name = '%s' ", subject)
+		extraCondition = " AND subj.name = $subject "
 	} else if searchString != helpers.EmptyStringParameter {
 		extraConditionSearch = fmt.Sprintf(`
 			CALL db.index.fulltext.queryNodes('subjects', '%s~')
@@ -81,19 +348,29 @@ func getObjectivesWithoutCompletedTestsForStudent(session neo4j.Session, student
 		`, searchString)
 		extraCondition = " AND subj.name = name"
 	}
+	if state != helpers.EmptyStringParameter {
+		extraCondition += " AND o.state = $state "
+	}
 
-	query := fmt.Sprintf(` %s 
-		MATCH (s:Student)-[ssubj:SET_OBJECTIVE]->(subj:Subject)
-		WHERE s.ID = $studentID %s 
-		RETURN subj.name, ssubj.timestampStart, ssubj.timestampEnd, ssubj.target, ssubj.ID 
+	query := fmt.Sprintf(` %s
+		MATCH (s:Student)-[:HAS_OBJECTIVE]->(o:Objective)-[:FOR_SUBJECT]->(subj:Subject)
+		WHERE s.ID = $studentID %s
+		OPTIONAL MATCH (o)-[:DERIVED_FROM]->(go:GroupObjective)
+		RETURN subj.name, o.ID, o.timestampStart, o.timestampEnd, o.target, o.legacyTarget, o.nrTests, o.state, o.createdAt, o.closedAt, go.ID
+		ORDER BY o.timestampStart DESC
 	`, extraConditionSearch, extraCondition)
+	params := map[string]interface{}{
+		"studentID": studentID,
+		"subject":   subject,
+		"state":     state,
+	}
 
 	testResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
 		var results []repositories.Objective
 
 		fmt.Printf("query: %s\n", query)
 
-		records, err := tx.Run(query, map[string]interface{}{"studentID": studentID})
+		records, err := tx.Run(query, params)
 		if err != nil {
 			return []repositories.Objective{}, err
 		}
@@ -119,19 +396,39 @@ func getObjectivesWithoutCompletedTestsForStudent(session neo4j.Session, student
 }
 
 func getObjectiveFromQuery(record neo4j.Record) (repositories.Objective, error) {
-	ID, err := helpers.GetIntParameterFromQuery(record, "ssubj.ID", true, true)
-	timestampStart, err := helpers.GetIntParameterFromQuery(record, "ssubj.timestampStart", true, true)
+	ID, err := helpers.GetIntParameterFromQuery(record, "o.ID", true, true)
+	if err != nil {
+		return repositories.Objective{}, err
+	}
+	timestampStart, err := helpers.GetIntParameterFromQuery(record, "o.timestampStart", true, true)
+	if err != nil {
+		return repositories.Objective{}, err
+	}
+	timestampEnd, err := helpers.GetIntParameterFromQuery(record, "o.timestampEnd", true, true)
+	if err != nil {
+		return repositories.Objective{}, err
+	}
+	targetGrade, err := helpers.GetIntParameterFromQuery(record, "o.target", true, true)
 	if err != nil {
 		return repositories.Objective{}, err
 	}
+	legacyTarget, err := helpers.GetIntParameterFromQuery(record, "o.legacyTarget", false, false)
 	if err != nil {
 		return repositories.Objective{}, err
 	}
-	timestampEnd, err := helpers.GetIntParameterFromQuery(record, "ssubj.timestampEnd", true, true)
+	nrTests, err := helpers.GetIntParameterFromQuery(record, "o.nrTests", true, false)
 	if err != nil {
 		return repositories.Objective{}, err
 	}
-	targetGrade, err := helpers.GetIntParameterFromQuery(record, "ssubj.target", true, true)
+	state, err := helpers.GetStringParameterFromQuery(record, "o.state", true, true)
+	if err != nil {
+		return repositories.Objective{}, err
+	}
+	createdAt, err := helpers.GetIntParameterFromQuery(record, "o.createdAt", true, false)
+	if err != nil {
+		return repositories.Objective{}, err
+	}
+	closedAt, err := helpers.GetIntParameterFromQuery(record, "o.closedAt", true, false)
 	if err != nil {
 		return repositories.Objective{}, err
 	}
@@ -139,50 +436,23 @@ func getObjectiveFromQuery(record neo4j.Record) (repositories.Objective, error)
 	if err != nil {
 		return repositories.Objective{}, err
 	}
-
-	return repositories.Objective{
-		ID:             ID,
-		Subject:        subjectName,
-		TargetGrade:    targetGrade,
-		StartTimestamp: timestampStart,
-		EndTimestamp:   timestampEnd,
-		Tests: []repositories.CompletedTest{
-			{
-				Test: repositories.Test{
-					Subject: subjectName,
-				},
-			},
-		},
-	}, nil
-}
-
-func getNextRelationshipID(session neo4j.Session, relationshipType string, IDProperty string) (int, error) {
-	query := fmt.Sprintf("MATCH ()-[n:%s]->() RETURN max(n.%s) + 1 as next", relationshipType, IDProperty)
-	params := map[string]interface{}{}
-
-	nextID, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-
-		fmt.Printf("query: %s\n", query)
-
-		records, err := tx.Run(query, params)
-		if err != nil {
-			return 0, err
-		}
-		for records.Next() {
-			nextID, err := helpers.GetIntParameterFromQuery(records.Record(), "next", true, true)
-			if err != nil {
-				return 0, err
-			}
-
-			return nextID, nil
-		}
-
-		return 0, nil
-	})
-
+	groupObjectiveID, err := helpers.GetIntParameterFromQuery(record, "go.ID", false, false)
 	if err != nil {
-		return 0, err
+		return repositories.Objective{}, err
 	}
 
-	return nextID.(int), nil
+	return repositories.Objective{
+		ID:               ID,
+		Subject:          subjectName,
+		TargetGrade:      targetGrade,
+		LegacyTarget:     legacyTarget,
+		StartTimestamp:   timestampStart,
+		EndTimestamp:     timestampEnd,
+		NrTests:          nrTests,
+		State:            state,
+		CreatedAt:        createdAt,
+		ClosedAt:         closedAt,
+		GroupObjectiveID: groupObjectiveID,
+		Tests:            []repositories.CompletedTest{},
+	}, nil
 }
@@ -0,0 +1,214 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// GetUserByOIDCIdentity logs in the student or teacher the identity provider vouches for. The identity is
+// linked to the account using the same email address the first time, and an account is created when there
+// is none. The identity provider already checked who they are, so such accounts need no approval.
+func GetUserByOIDCIdentity(session neo4j.Session, path string, identity helpers.OIDCIdentity) (interface{}, error) {
+	user, found, err := getOIDCUser(session, `
+		MATCH (n) 
+		WHERE (n:Student OR n:Teacher) AND n.oidcIssuer = $issuer AND n.oidcSubject = $subject 
+		RETURN n.ID, n:Student AS isStudent, n:Admin AS isAdmin, coalesce(n.status, $active) AS status, n.token, 
+			coalesce(n.archived, false) AS archived
+	`, identity)
+	if err == nil && !found {
+		user, found, err = getOIDCUser(session, `
+			MATCH (n) 
+			WHERE (n:Student OR n:Teacher OR n:Admin) AND toLower(n.email) = $email 
+			RETURN n.ID, n:Student AS isStudent, n:Admin AS isAdmin, coalesce(n.status, $active) AS status, n.token, 
+				coalesce(n.archived, false) AS archived
+		`, identity)
+		if err == nil && found {
+			user, err = linkOIDCIdentity(session, user, identity)
+		}
+	}
+	if err == nil && !found {
+		user, err = addOIDCUser(session, identity)
+	}
+	if err != nil {
+		return repositories.User{}, helpers.InvalidTokenError(path, err)
+	}
+
+	err = helpers.CheckUserStatus(user.Status)
+	if err != nil {
+		return repositories.User{}, helpers.InvalidTokenError(path, err)
+	}
+	if user.Token == helpers.EmptyStringParameter {
+		label, err := helpers.GetUserLabel(user.Type)
+		if err != nil {
+			return repositories.User{}, err
+		}
+		user.Token = helpers.GenerateToken(tokenLength)
+		query := fmt.Sprintf(`
+			MATCH (n:%s {ID:$userID}) 
+			SET n.token = $token
+		`, label)
+		params := map[string]interface{}{
+			"userID": user.ID,
+			"token":  user.Token,
+		}
+
+		err = helpers.WriteTX(session, query, params)
+		if err != nil {
+			return repositories.User{}, err
+		}
+	}
+
+	return GetUser(session, path, user.Token)
+}
+
+// linkOIDCIdentity remembers which identity logs in to an existing account. Only an address the identity
+// provider verified is trusted, and administrators keep logging in with their password. Invited students
+// accept their invitation by logging in.
+func linkOIDCIdentity(session neo4j.Session, user repositories.ManagedUser, identity helpers.OIDCIdentity) (repositories.ManagedUser, error) {
+	if !identity.EmailVerified {
+		return repositories.ManagedUser{}, fmt.Errorf("identity provider has not verified the email address")
+	}
+	if user.Type == repositories.AdminType {
+		return repositories.ManagedUser{}, fmt.Errorf("administrators log in with their password")
+	}
+	if identity.UserType != helpers.EmptyStringParameter && identity.UserType != user.Type {
+		return repositories.ManagedUser{}, fmt.Errorf("email address belongs to an account with another role")
+	}
+
+	label, err := helpers.GetUserLabel(user.Type)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	if user.Status == helpers.UserStatusInvited {
+		user.Status = helpers.UserStatusActive
+	}
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		SET n.oidcIssuer = $issuer, n.oidcSubject = $subject, n.status = $status, 
+			n.emailVerified = true, n.emailVerifiedAt = coalesce(n.emailVerifiedAt, $now)
+	`, label)
+	params := map[string]interface{}{
+		"userID":  user.ID,
+		"issuer":  identity.Issuer,
+		"subject": identity.Subject,
+		"status":  user.Status,
+		"now":     time.Now().Unix(),
+	}
+
+	return user, helpers.WriteTX(session, query, params)
+}
+
+// addOIDCUser creates the account of someone logging in for the first time. It has no password, but one
+// can be set with a password reset.
+func addOIDCUser(session neo4j.Session, identity helpers.OIDCIdentity) (repositories.ManagedUser, error) {
+	if !identity.EmailVerified {
+		return repositories.ManagedUser{}, fmt.Errorf("identity provider has not verified the email address")
+	}
+	if identity.UserType == helpers.EmptyStringParameter {
+		return repositories.ManagedUser{}, fmt.Errorf("identity provider did not say whether the user is a student or a teacher")
+	}
+
+	label, err := helpers.GetUserLabel(identity.UserType)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	userID, err := getNextNodeID(session, label, "ID")
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	token := helpers.GenerateToken(tokenLength)
+
+	query := fmt.Sprintf(`
+		CREATE (n:%s {ID:$userID}) 
+		SET n.email = $email, n.firstName = $firstName, n.lastName = $lastName, n.token = $token, 
+			n.status = $active, n.emailVerified = true, n.emailVerifiedAt = $now, 
+			n.oidcIssuer = $issuer, n.oidcSubject = $subject
+	`, label)
+	params := map[string]interface{}{
+		"userID":    userID,
+		"email":     identity.Email,
+		"firstName": identity.FirstName,
+		"lastName":  identity.LastName,
+		"token":     token,
+		"active":    helpers.UserStatusActive,
+		"now":       time.Now().Unix(),
+		"issuer":    identity.Issuer,
+		"subject":   identity.Subject,
+	}
+
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+
+	return repositories.ManagedUser{
+		User:   repositories.User{ID: userID, Type: identity.UserType, Token: token},
+		Status: helpers.UserStatusActive,
+	}, nil
+}
+
+func getOIDCUser(session neo4j.Session, query string, identity helpers.OIDCIdentity) (repositories.ManagedUser, bool, error) {
+	params := map[string]interface{}{
+		"issuer":  identity.Issuer,
+		"subject": identity.Subject,
+		"email":   identity.Email,
+		"active":  helpers.UserStatusActive,
+	}
+
+	user, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return nil, err
+		}
+		if !records.Next() {
+			return nil, nil
+		}
+
+		record := records.Record()
+		ID, err := helpers.GetIntParameterFromQuery(record, "n.ID", true, true)
+		if err != nil {
+			return nil, err
+		}
+		status, err := helpers.GetStringParameterFromQuery(record, "status", true, true)
+		if err != nil {
+			return nil, err
+		}
+		token, err := helpers.GetStringParameterFromQuery(record, "n.token", true, false)
+		if err != nil {
+			return nil, err
+		}
+		isAdmin, err := helpers.GetBoolParameterFromQuery(record, "isAdmin", true, true)
+		if err != nil {
+			return nil, err
+		}
+		archived, err := helpers.GetBoolParameterFromQuery(record, "archived", true, true)
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			return nil, fmt.Errorf("account has been deleted")
+		}
+		userType := repositories.AdminType
+		if !isAdmin {
+			userType, err = getUserTypeFromQuery(record)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return repositories.ManagedUser{User: repositories.User{ID: ID, Type: userType, Token: token}, Status: status}, nil
+	})
+	if err != nil || user == nil {
+		return repositories.ManagedUser{}, false, err
+	}
+
+	return user.(repositories.ManagedUser), true, nil
+}
@@ -0,0 +1,133 @@
+package datasources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+)
+
+// RequestPasswordReset emails a link to choose a new password to the active account using the address.
+// It succeeds whether or not such an account exists, so it cannot be used to find out who has one.
+func RequestPasswordReset(session neo4j.Session, path string, email string, accounts *helpers.AccountMailer) error {
+	if email == helpers.EmptyStringParameter {
+		return fmt.Errorf("email address is missing")
+	}
+	code, err := helpers.NewPasswordResetCode()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (u) 
+		WHERE (u:Student OR u:Teacher) AND toLower(u.email) = toLower($email) 
+			AND coalesce(u.status, $active) = $active AND NOT coalesce(u.archived, false) 
+		SET u.passwordResetHash = $hash, u.passwordResetExpiresAt = $expiresAt 
+		RETURN u.email, u.firstName, u.lastName, u.emailMode, u.emailMutedTypes
+	`
+	params := map[string]interface{}{
+		"email":     email,
+		"active":    helpers.UserStatusActive,
+		"hash":      helpers.HashPasswordResetCode(code),
+		"expiresAt": time.Now().Add(helpers.PasswordResetValidity).Unix(),
+	}
+
+	recipients, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []helpers.EmailRecipient
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []helpers.EmailRecipient{}, err
+		}
+		for records.Next() {
+			recipient, err := helpers.GetEmailRecipientFromQuery(records.Record(), "u")
+			if err != nil {
+				return []helpers.EmailRecipient{}, err
+			}
+
+			results = append(results, recipient)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients.([]helpers.EmailRecipient) {
+		err = accounts.SendPasswordReset(recipient, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckPasswordReset tells whether a reset link can still be used, so the client can ask for the new
+// password only when it will be accepted. The link is not used up.
+func CheckPasswordReset(session neo4j.Session, path string, code string) error {
+	nr, err := countNodes(session, `
+		MATCH (u) 
+		WHERE (u:Student OR u:Teacher) AND u.passwordResetHash = $hash AND u.passwordResetExpiresAt >= $now 
+			AND NOT coalesce(u.archived, false) 
+		RETURN count(u) AS nr
+	`, map[string]interface{}{
+		"hash": helpers.HashPasswordResetCode(code),
+		"now":  time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if nr == 0 {
+		return fmt.Errorf("reset link is not valid or has expired")
+	}
+
+	return nil
+}
+
+// ResetPassword sets the password of the account a reset link was sent to. The link is used up and the
+// session token of the account is removed, so whoever was logged in has to log in again.
+func ResetPassword(session neo4j.Session, path string, code string, newPassword string) error {
+	if newPassword == helpers.EmptyStringParameter {
+		return fmt.Errorf("new password is missing")
+	}
+
+	query := `
+		MATCH (u) 
+		WHERE (u:Student OR u:Teacher) AND u.passwordResetHash = $hash AND u.passwordResetExpiresAt >= $now 
+			AND NOT coalesce(u.archived, false) 
+		SET u.password = $password 
+		REMOVE u.passwordResetHash, u.passwordResetExpiresAt, u.token 
+		RETURN u.ID
+	`
+	params := map[string]interface{}{
+		"hash":     helpers.HashPasswordResetCode(code),
+		"now":      time.Now().Unix(),
+		"password": newPassword,
+	}
+
+	reset, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return false, err
+		}
+
+		return records.Next(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !reset.(bool) {
+		return fmt.Errorf("reset link is not valid or has expired")
+	}
+
+	return nil
+}
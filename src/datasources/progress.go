@@ -0,0 +1,136 @@
+package datasources
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func GetStudentProgress(session neo4j.Session, path string, token string, subject string) ([]repositories.SubjectProgress, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.StudentLabel {
+		return []repositories.SubjectProgress{}, helpers.InvalidTokenError(path, err)
+	}
+
+	groupGrades, err := getGroupGrades(session, tokenInfo.ID, subject)
+	if err != nil {
+		return []repositories.SubjectProgress{}, err
+	}
+	objectives, err := getObjectivesWithoutCompletedTestsForStudent(session, tokenInfo.ID, subject, helpers.EmptyStringParameter, helpers.EmptyStringParameter)
+	if err != nil {
+		return []repositories.SubjectProgress{}, err
+	}
+
+	return helpers.CalculateStudentProgress(tokenInfo.ID, groupGrades, objectives), nil
+}
+
+// getGroupGrades returns the published grades of every student in the group of the given student, so
+// the student can be ranked within it.
+func getGroupGrades(session neo4j.Session, studentID int, subject string) ([]helpers.GroupGrade, error) {
+	extraCondition := ""
+	if subject != helpers.EmptyStringParameter {
+		extraCondition = "AND subj.name = $subject"
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (me:Student {ID:$studentID})-[:MEMBER_OF]->(g:Group)<-[:MEMBER_OF]-(s:Student)-[st:COMPLETED]->(t:Test)-[:BELONGS_TO]->(subj:Subject) 
+		WHERE coalesce(t.publication, $published) = $published AND NOT coalesce(t.archived, false) 
+			AND NOT coalesce(s.archived, false) %s 
+		RETURN s.ID, subj.name, t.testID, t.name, t.points, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp
+	`, extraCondition)
+	params := map[string]interface{}{
+		"studentID": studentID,
+		"subject":   subject,
+		"published": helpers.TestPublicationPublished,
+	}
+
+	grades, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []helpers.GroupGrade
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []helpers.GroupGrade{}, err
+		}
+
+		for records.Next() {
+			grade, err := getGroupGradeFromQuery(records.Record())
+			if err != nil {
+				return []helpers.GroupGrade{}, err
+			}
+
+			results = append(results, grade)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []helpers.GroupGrade{}, err
+	}
+
+	return grades.([]helpers.GroupGrade), nil
+}
+
+func getGroupGradeFromQuery(record neo4j.Record) (helpers.GroupGrade, error) {
+	studentID, err := helpers.GetIntParameterFromQuery(record, "s.ID", true, true)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	subject, err := helpers.GetStringParameterFromQuery(record, "subj.name", true, true)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	testID, err := helpers.GetIntParameterFromQuery(record, "t.testID", true, true)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	testName, err := helpers.GetStringParameterFromQuery(record, "t.name", true, true)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	points, err := helpers.GetIntParameterFromQuery(record, "t.points", true, true)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	grade, err := helpers.GetIntParameterFromQuery(record, "st.grade", true, false)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	timestamp, err := helpers.GetIntParameterFromQuery(record, "st.timestamp", true, false)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	correctedGrade, err := helpers.GetIntParameterFromQuery(record, "st.correctedGrade", true, false)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+	correctedGradeTimestamp, err := helpers.GetIntParameterFromQuery(record, "st.correctedGradeTimestamp", true, false)
+	if err != nil {
+		return helpers.GroupGrade{}, err
+	}
+
+	finalGrade := helpers.GetFinalGrade(repositories.CompletedTest{
+		Grade:                   grade,
+		CorrectedGrade:          correctedGrade,
+		CorrectedGradeTimestamp: correctedGradeTimestamp,
+	})
+	percentage := 0.0
+	if points != 0 {
+		percentage = float64(finalGrade) * 100 / float64(points)
+	}
+
+	return helpers.GroupGrade{
+		StudentID:  studentID,
+		Subject:    subject,
+		TestID:     testID,
+		TestName:   testName,
+		Timestamp:  timestamp,
+		Grade:      finalGrade,
+		Points:     points,
+		Percentage: percentage,
+	}, nil
+}
@@ -0,0 +1,338 @@
+package datasources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+type importGroup struct {
+	specialization string
+	faculty        string
+}
+
+// importLookup holds what an import needs to know about the database. It is updated as rows are imported,
+// so a group created for one row is reused by the next ones.
+type importLookup struct {
+	faculties       map[string]bool
+	specializations map[string][]string
+	groups          map[int]importGroup
+	subjects        map[string]bool
+	students        map[string]int
+	staff           map[string]bool
+}
+
+// ImportStudents creates the students of a class list, or updates them when their email is already used by
+// a student, moving them to the group of the list and enrolling them in its subjects. Missing groups and
+// specializations are created, but faculties and subjects have to exist. Every row is imported on its own,
+// so an invalid row does not stop the others, and a dry run reports what would happen without changing
+// anything. Imported students have no password until they set one.
+func ImportStudents(session neo4j.Session, path string, token string, rows [][]string, dryRun bool) (repositories.ImportReport, error) {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return repositories.ImportReport{}, helpers.InvalidTokenError(path, err)
+	}
+
+	students, err := helpers.ParseStudentImport(rows)
+	if err != nil {
+		return repositories.ImportReport{}, err
+	}
+	emails := make([]string, 0, len(students))
+	for _, imported := range students {
+		emails = append(emails, strings.ToLower(imported.Student.Email))
+	}
+	lookup, err := getImportLookup(session, emails)
+	if err != nil {
+		return repositories.ImportReport{}, err
+	}
+
+	report := repositories.ImportReport{
+		DryRun:                 dryRun,
+		NrRows:                 len(students),
+		CreatedGroups:          []int{},
+		CreatedSpecializations: []string{},
+		Rows:                   []repositories.ImportRowReport{},
+	}
+	for _, imported := range students {
+		rowReport := importStudent(session, lookup, imported, dryRun, &report)
+		switch rowReport.Status {
+		case helpers.ImportStatusCreated:
+			report.NrCreated++
+		case helpers.ImportStatusUpdated:
+			report.NrUpdated++
+		default:
+			report.NrInvalid++
+		}
+
+		report.Rows = append(report.Rows, rowReport)
+	}
+
+	return report, nil
+}
+
+func importStudent(session neo4j.Session, lookup importLookup, imported repositories.ImportedStudent, dryRun bool, report *repositories.ImportReport) repositories.ImportRowReport {
+	student := imported.Student
+	rowReport := repositories.ImportRowReport{
+		Row:    imported.Row,
+		Email:  student.Email,
+		Status: helpers.ImportStatusInvalid,
+		Errors: imported.Errors,
+	}
+	if len(rowReport.Errors) > 0 {
+		return rowReport
+	}
+
+	if lookup.staff[strings.ToLower(student.Email)] {
+		rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("email '%s' belongs to a teacher or administrator", student.Email))
+	}
+
+	faculties := lookup.specializations[student.Specialization]
+	createSpecialization := false
+	switch {
+	case student.Faculty != helpers.EmptyStringParameter && !lookup.faculties[student.Faculty]:
+		rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("faculty '%s' does not exist", student.Faculty))
+	case student.Faculty != helpers.EmptyStringParameter:
+		createSpecialization = !containsString(faculties, student.Faculty)
+	case len(faculties) == 1:
+		student.Faculty = faculties[0]
+	case len(faculties) == 0:
+		rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("specialization '%s' does not exist, add its faculty to create it", student.Specialization))
+	default:
+		rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("specialization '%s' exists in several faculties, add the faculty", student.Specialization))
+	}
+
+	group, groupExists := lookup.groups[student.Group]
+	if groupExists && group.specialization != helpers.EmptyStringParameter &&
+		(group.specialization != student.Specialization || group.faculty != student.Faculty) {
+		rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("group %d belongs to specialization '%s' of faculty '%s'",
+			student.Group, group.specialization, group.faculty))
+	}
+
+	for _, subject := range student.Subjects {
+		if !lookup.subjects[subject] {
+			rowReport.Errors = append(rowReport.Errors, fmt.Sprintf("subject '%s' does not exist", subject))
+		}
+	}
+	if len(rowReport.Errors) > 0 {
+		return rowReport
+	}
+
+	studentID, exists := lookup.students[strings.ToLower(student.Email)]
+	if !dryRun {
+		var err error
+		if !exists {
+			studentID, err = getNextNodeID(session, "Student", "ID")
+		}
+		if err == nil {
+			student.ID = studentID
+			err = writeImportedStudent(session, student, exists)
+		}
+		if err != nil {
+			rowReport.Errors = append(rowReport.Errors, err.Error())
+			return rowReport
+		}
+	}
+
+	if createSpecialization {
+		lookup.specializations[student.Specialization] = append(faculties, student.Faculty)
+		report.CreatedSpecializations = append(report.CreatedSpecializations, fmt.Sprintf("%s (%s)", student.Specialization, student.Faculty))
+	}
+	if !groupExists {
+		report.CreatedGroups = append(report.CreatedGroups, student.Group)
+	}
+	lookup.groups[student.Group] = importGroup{specialization: student.Specialization, faculty: student.Faculty}
+
+	rowReport.Status = helpers.ImportStatusCreated
+	if exists {
+		rowReport.Status = helpers.ImportStatusUpdated
+	}
+
+	return rowReport
+}
+
+func writeImportedStudent(session neo4j.Session, student repositories.Student, exists bool) error {
+	studentQuery := " CREATE (s:Student {ID:$studentID}) "
+	if exists {
+		studentQuery = " MATCH (s:Student {ID:$studentID}) "
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (f:Faculty {name:$faculty}) 
+		MERGE (spec:Specialization {name:$specialization})-[:IN_FACULTY]->(f) 
+		MERGE (g:Group {gID:$gID}) 
+		MERGE (g)-[:HAS_SPECIALIZATION]->(spec) 
+		WITH g 
+		%s 
+		SET s.email=$email, s.firstName=$firstName, s.lastName=$lastName, s.year=$year 
+		WITH s, g 
+		OPTIONAL MATCH (s)-[membership:MEMBER_OF]->(:Group) 
+		DELETE membership 
+		WITH DISTINCT s, g 
+		MERGE (s)-[:MEMBER_OF]->(g) 
+		WITH s 
+		UNWIND $subjects AS subject 
+		MATCH (subj:Subject {name:subject}) 
+		MERGE (s)-[:ENROLLED_IN]->(subj)
+	`, studentQuery)
+	params := map[string]interface{}{
+		"faculty":        student.Faculty,
+		"specialization": student.Specialization,
+		"gID":            student.Group,
+		"studentID":      student.ID,
+		"email":          student.Email,
+		"firstName":      student.FirstName,
+		"lastName":       student.LastName,
+		"year":           student.Year,
+		"subjects":       student.Subjects,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func getImportLookup(session neo4j.Session, emails []string) (importLookup, error) {
+	lookup := importLookup{
+		faculties:       map[string]bool{},
+		specializations: map[string][]string{},
+		groups:          map[int]importGroup{},
+		subjects:        map[string]bool{},
+		students:        map[string]int{},
+		staff:           map[string]bool{},
+	}
+
+	queries := []struct {
+		query  string
+		params map[string]interface{}
+		read   func(record neo4j.Record) error
+	}{
+		{
+			query: `
+				MATCH (f:Faculty) 
+				RETURN f.name
+			`,
+			read: func(record neo4j.Record) error {
+				faculty, err := helpers.GetStringParameterFromQuery(record, "f.name", true, true)
+				lookup.faculties[faculty] = true
+
+				return err
+			},
+		},
+		{
+			query: `
+				MATCH (spec:Specialization)-[:IN_FACULTY]->(f:Faculty) 
+				RETURN spec.name, f.name
+			`,
+			read: func(record neo4j.Record) error {
+				specialization, err := helpers.GetStringParameterFromQuery(record, "spec.name", true, true)
+				if err != nil {
+					return err
+				}
+				faculty, err := helpers.GetStringParameterFromQuery(record, "f.name", true, true)
+				lookup.specializations[specialization] = append(lookup.specializations[specialization], faculty)
+
+				return err
+			},
+		},
+		{
+			query: `
+				MATCH (g:Group) 
+				OPTIONAL MATCH (g)-[:HAS_SPECIALIZATION]->(spec:Specialization)-[:IN_FACULTY]->(f:Faculty) 
+				RETURN g.gID, spec.name, f.name
+			`,
+			read: func(record neo4j.Record) error {
+				gID, err := helpers.GetIntParameterFromQuery(record, "g.gID", true, true)
+				if err != nil {
+					return err
+				}
+				specialization, err := helpers.GetStringParameterFromQuery(record, "spec.name", true, false)
+				if err != nil {
+					return err
+				}
+				faculty, err := helpers.GetStringParameterFromQuery(record, "f.name", true, false)
+				lookup.groups[gID] = importGroup{specialization: specialization, faculty: faculty}
+
+				return err
+			},
+		},
+		{
+			query: `
+				MATCH (subj:Subject) 
+				RETURN subj.name
+			`,
+			read: func(record neo4j.Record) error {
+				subject, err := helpers.GetStringParameterFromQuery(record, "subj.name", true, true)
+				lookup.subjects[subject] = true
+
+				return err
+			},
+		},
+		{
+			query: `
+				MATCH (n) 
+				WHERE (n:Student OR n:Teacher OR n:Admin) AND toLower(n.email) IN $emails 
+				RETURN toLower(n.email) AS email, n.ID, NOT n:Student AS isStaff
+			`,
+			params: map[string]interface{}{"emails": emails},
+			read: func(record neo4j.Record) error {
+				email, err := helpers.GetStringParameterFromQuery(record, "email", true, true)
+				if err != nil {
+					return err
+				}
+				isStaff, err := helpers.GetBoolParameterFromQuery(record, "isStaff", true, true)
+				if err != nil {
+					return err
+				}
+				if isStaff {
+					lookup.staff[email] = true
+					return nil
+				}
+				lookup.students[email], err = helpers.GetIntParameterFromQuery(record, "n.ID", true, true)
+
+				return err
+			},
+		},
+	}
+
+	_, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		for _, lookupQuery := range queries {
+
+			fmt.Printf("query: %s\n", lookupQuery.query)
+
+			params := lookupQuery.params
+			if params == nil {
+				params = map[string]interface{}{}
+			}
+			records, err := tx.Run(lookupQuery.query, params)
+			if err != nil {
+				return nil, err
+			}
+
+			for records.Next() {
+				err = lookupQuery.read(records.Record())
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return importLookup{}, err
+	}
+
+	return lookup, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+package datasources
+
+import (
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func GetTemplateStyle(session neo4j.Session, path string, token string, faculty string) (repositories.TemplateStyle, error) {
+	_, err := GetTokenInfo(session, token)
+	if err != nil {
+		return repositories.TemplateStyle{}, helpers.InvalidTokenError(path, err)
+	}
+
+	query := `
+		MATCH (f:Faculty) 
+		WHERE f.name = $faculty 
+		RETURN f.name, f.templateStyle
+	`
+	params := map[string]interface{}{
+		"faculty": faculty,
+	}
+
+	return getTemplateStyle(session, query, params)
+}
+
+// SetTemplateStyle replaces the template style of a faculty, which only an administrator may do.
+func SetTemplateStyle(session neo4j.Session, path string, token string, faculty string, style repositories.TemplateStyle) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	params := map[string]interface{}{
+		"faculty": faculty,
+	}
+	err = checkExists(session, fmt.Sprintf("faculty '%s'", faculty), `
+		MATCH (f:Faculty {name:$faculty}) 
+		RETURN count(f) AS nr
+	`, params)
+	if err != nil {
+		return err
+	}
+
+	style.Faculty = faculty
+	styleString, err := helpers.GetStringFromTemplateStyle(style)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (f:Faculty) 
+		WHERE f.name = $faculty 
+		SET f.templateStyle = $style
+	`
+	params["style"] = styleString
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func getTemplateStyleForTeacher(session neo4j.Session, teacherID int) (repositories.TemplateStyle, error) {
+	query := `
+		MATCH (p:Teacher)-[:AFILLIATED_TO]->(f:Faculty) 
+		WHERE p.ID = $teacherID 
+		RETURN f.name, f.templateStyle
+	`
+	params := map[string]interface{}{
+		"teacherID": teacherID,
+	}
+
+	return getTemplateStyle(session, query, params)
+}
+
+// getTemplateStyleForTest returns the style the template of a test was generated with. Tests added before
+// the style was kept with them fall back to the style of the faculty.
+func getTemplateStyleForTest(session neo4j.Session, testID int) (repositories.TemplateStyle, error) {
+	query := `
+		MATCH (t:Test {testID:$testID})-[:ADDED_BY]->(p:Teacher) 
+		OPTIONAL MATCH (p)-[:AFILLIATED_TO]->(f:Faculty) 
+		RETURN coalesce(t.templateStyle, f.templateStyle) AS templateStyle
+	`
+	params := map[string]interface{}{
+		"testID": testID,
+	}
+
+	style, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return repositories.TemplateStyle{}, err
+		}
+		if !records.Next() {
+			return repositories.TemplateStyle{}, fmt.Errorf("could not get the template style of test %d", testID)
+		}
+
+		return helpers.GetTemplateStyleFromQuery(records.Record(), "templateStyle", true, false)
+	})
+	if err != nil {
+		return repositories.TemplateStyle{}, err
+	}
+
+	return style.(repositories.TemplateStyle), nil
+}
+
+func getTemplateStyle(session neo4j.Session, query string, params map[string]interface{}) (repositories.TemplateStyle, error) {
+	style, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return repositories.TemplateStyle{}, err
+		}
+		for records.Next() {
+			record := records.Record()
+			style, err := helpers.GetTemplateStyleFromQuery(record, "f.templateStyle", true, false)
+			if err != nil {
+				return repositories.TemplateStyle{}, err
+			}
+			style.Faculty, err = helpers.GetStringParameterFromQuery(record, "f.name", true, true)
+			if err != nil {
+				return repositories.TemplateStyle{}, err
+			}
+
+			return style, nil
+		}
+
+		return repositories.TemplateStyle{}, nil
+	})
+	if err != nil {
+		return repositories.TemplateStyle{}, err
+	}
+
+	return style.(repositories.TemplateStyle), nil
+}
@@ -0,0 +1,193 @@
+package datasources
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// PublishTest releases the grades of a test to its students, right away when releaseAt is empty or
+// already passed, otherwise at releaseAt through ReleaseScheduledTests.
+func PublishTest(session neo4j.Session, path string, token string, testID int, releaseAt int, dispatcher *helpers.NotificationDispatcher) error {
+	err := CheckTestAuthor(session, path, token, testID)
+	if err != nil {
+		return err
+	}
+
+	if releaseAt > int(time.Now().Unix()) {
+		query := `
+			MATCH (t:Test {testID:$testID}) 
+			WHERE coalesce(t.publication, $published) <> $published 
+			SET t.releaseAt = $releaseAt
+		`
+		params := map[string]interface{}{
+			"testID":    testID,
+			"releaseAt": releaseAt,
+			"published": helpers.TestPublicationPublished,
+		}
+
+		return helpers.WriteTX(session, query, params)
+	}
+
+	return publishTestGrades(session, testID, dispatcher)
+}
+
+// WithdrawTest hides the grades of a test from its students again and cancels any scheduled release.
+func WithdrawTest(session neo4j.Session, path string, token string, testID int) error {
+	err := CheckTestAuthor(session, path, token, testID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (t:Test {testID:$testID}) 
+		OPTIONAL MATCH (:Student)-[st:COMPLETED]->(t) 
+		WITH t, count(st) AS nrTestsGraded 
+		SET t.publication = CASE WHEN nrTestsGraded > 0 THEN $graded ELSE $draft END, 
+			t.releaseAt = null, t.publishedAt = null
+	`
+	params := map[string]interface{}{
+		"testID": testID,
+		"graded": helpers.TestPublicationGraded,
+		"draft":  helpers.TestPublicationDraft,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// ReleaseScheduledTests publishes every test whose release date has passed. It is run periodically
+// in the background. A test that cannot be published is logged and retried on the next run, without
+// holding up the others.
+func ReleaseScheduledTests(session neo4j.Session, dispatcher *helpers.NotificationDispatcher, logger *log.Logger) error {
+	query := `
+		MATCH (t:Test) 
+		WHERE t.releaseAt IS NOT NULL AND t.releaseAt <= $now AND coalesce(t.publication, $published) <> $published 
+			AND NOT coalesce(t.archived, false) 
+		RETURN t.testID
+	`
+	params := map[string]interface{}{
+		"now":       time.Now().Unix(),
+		"published": helpers.TestPublicationPublished,
+	}
+
+	testIDs, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []int
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []int{}, err
+		}
+		for records.Next() {
+			testID, err := helpers.GetIntParameterFromQuery(records.Record(), "t.testID", true, true)
+			if err != nil {
+				return []int{}, err
+			}
+
+			results = append(results, testID)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, testID := range testIDs.([]int) {
+		err = publishTestGrades(session, testID, dispatcher)
+		if err != nil {
+			logger.Printf("could not release grades of test %d: %s", testID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// publishTestGrades marks the test as published and notifies all of its students at once. Only the
+// call that actually changes the state sends the notifications, so a manual release racing the
+// scheduled one does not notify twice.
+func publishTestGrades(session neo4j.Session, testID int, dispatcher *helpers.NotificationDispatcher) error {
+	query := `
+		MATCH (t:Test {testID:$testID}) 
+		WHERE coalesce(t.publication, $published) <> $published 
+		SET t.publication = $published, t.publishedAt = $publishedAt, t.releaseAt = null 
+		RETURN t.testID
+	`
+	params := map[string]interface{}{
+		"testID":      testID,
+		"published":   helpers.TestPublicationPublished,
+		"publishedAt": time.Now().Unix(),
+	}
+
+	published, err := session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\nparams: %+v\n", query, params)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return false, err
+		}
+
+		return records.Next(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !published.(bool) {
+		return nil
+	}
+
+	return dispatcher.Notify(session, `
+		MATCH (u:Student)-[:COMPLETED]->(:Test {testID:$testID})
+	`, map[string]interface{}{
+		"testID": testID,
+	}, repositories.Notification{
+		Type:    helpers.NotificationTypeGradesPublished,
+		Message: helpers.GradesPublishedNotification,
+		Payload: repositories.NotificationPayload{
+			TestID: testID,
+		},
+	})
+}
+
+func getTestPublication(session neo4j.Session, testID int) (string, error) {
+	query := `
+		MATCH (t:Test {testID:$testID}) 
+		WHERE NOT coalesce(t.archived, false) 
+		RETURN t.publication
+	`
+
+	publication, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"testID": testID})
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+		if !records.Next() {
+			return helpers.EmptyStringParameter, fmt.Errorf("test %d does not exist", testID)
+		}
+
+		result, err := helpers.GetStringParameterFromQuery(records.Record(), "t.publication", true, false)
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+		if result == helpers.EmptyStringParameter {
+			result = helpers.TestPublicationPublished
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return helpers.EmptyStringParameter, err
+	}
+
+	return publication.(string), nil
+}
@@ -1,9 +1,9 @@
 package datasources
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
@@ -13,7 +13,7 @@ import (
 )
 
 func AddTestAnswers(session neo4j.Session, path string, token string, testID int, answers map[int][]string) error {
-	tokenInfo, err := GetTokenInfo(session, token)
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
@@ -23,26 +23,41 @@ func AddTestAnswers(session neo4j.Session, path string, token string, testID int
 		return err
 	}
 
-	query := fmt.Sprintf(`
+	query := `
 		MATCH (t:Test {testID:$testID})-[tp:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
-		SET t.answers = '%s'
-	`, answerString)
+		WHERE NOT coalesce(t.archived, false) 
+		WITH t, t.answers AS oldAnswers 
+		SET t.answers = $answers 
+		RETURN oldAnswers
+	`
 	params := map[string]interface{}{
 		"teacherID": tokenInfo.ID,
 		"testID":    testID,
+		"answers":   answerString,
 	}
 
-	return helpers.WriteTX(session, query, params)
+	_, err = writeAudited(session, tokenInfo, query, params, func(oldAnswers string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionAnswerKeyChange,
+			EntityType: helpers.AuditEntityTest,
+			EntityID:   testID,
+			Before:     oldAnswers,
+			After:      answerString,
+		}
+	})
+
+	return err
 }
 
 func AddFeedbackForTest(session neo4j.Session, path string, token string, testID int, feedback string) error {
-	tokenInfo, err := GetTokenInfo(session, token)
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
 
 	query := fmt.Sprintf(`
 		MATCH (t:Test {testID:$testID})-[tp:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
+		WHERE NOT coalesce(t.archived, false) 
 		SET t.feedback = '%s'
 	`, feedback)
 	params := map[string]interface{}{
@@ -53,16 +68,19 @@ func AddFeedbackForTest(session neo4j.Session, path string, token string, testID
 	return helpers.WriteTX(session, query, params)
 }
 
-func OverwriteGradeForTest(session neo4j.Session, path string, token string, testID int, studentID int, newGrade int) error {
-	tokenInfo, err := GetTokenInfo(session, token)
+func OverwriteGradeForTest(session neo4j.Session, path string, token string, testID int, studentID int, newGrade int, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
 
-	query := fmt.Sprintf(`
+	query := `
 		MATCH (s:Student {ID:$studentID})-[st:COMPLETED]->(t:Test {testID:$testID})-[tp:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
-		SET st.correctedGrade = $newGrade, st.correctedGradeTimestamp = $newGradeTS, st.notificationMessage = '%s'
-	`, helpers.TestCorrectionNotification)
+		WHERE NOT coalesce(t.archived, false) 
+		WITH st, toString(coalesce(st.correctedGrade, st.grade)) AS oldGrade 
+		SET st.correctedGrade = $newGrade, st.correctedGradeTimestamp = $newGradeTS 
+		RETURN oldGrade
+	`
 	params := map[string]interface{}{
 		"studentID":  studentID,
 		"testID":     testID,
@@ -71,30 +89,85 @@ func OverwriteGradeForTest(session neo4j.Session, path string, token string, tes
 		"newGradeTS": time.Now().Unix(),
 	}
 
-	return helpers.WriteTX(session, query, params)
+	changed, err := writeAudited(session, tokenInfo, query, params, func(oldGrade string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionGradeChange,
+			EntityType: helpers.AuditEntityTest,
+			EntityID:   testID,
+			StudentID:  studentID,
+			Before:     oldGrade,
+			After:      strconv.Itoa(newGrade),
+		}
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	events.Publish(repositories.TestEvent{
+		Type:      helpers.TestEventCorrected,
+		TestID:    testID,
+		StudentID: studentID,
+		Grade:     newGrade,
+	})
+
+	params["published"] = helpers.TestPublicationPublished
+
+	return dispatcher.Notify(session, `
+		MATCH (u:Student {ID:$studentID})-[:COMPLETED]->(t:Test {testID:$testID})-[:ADDED_BY]->(:Teacher {ID:$teacherID}) 
+		WHERE coalesce(t.publication, $published) = $published
+	`, params, repositories.Notification{
+		Type:    helpers.NotificationTypeTestCorrection,
+		Message: helpers.TestCorrectionNotification,
+		Payload: repositories.NotificationPayload{
+			TestID:    testID,
+			StudentID: studentID,
+			Grade:     newGrade,
+		},
+	})
 }
 
-func SignalErrorForTest(session neo4j.Session, path string, token string, testID int) error {
-	tokenInfo, err := GetTokenInfo(session, token)
+func SignalErrorForTest(session neo4j.Session, path string, token string, testID int, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.StudentLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
 
-	query := fmt.Sprintf(`
-		MATCH (s:Student)-[st:COMPLETED]->(t:Test) 
-		WHERE s.ID = $studentID AND t.testID = $testID 
-		SET st.notificationMessage = '%s'
-	`, helpers.GradingErrorNotification)
-	params := map[string]interface{}{
+	publication, err := getTestPublication(session, testID)
+	if err != nil {
+		return err
+	}
+	if publication != helpers.TestPublicationPublished {
+		return fmt.Errorf("grades for test %d are not published", testID)
+	}
+
+	err = dispatcher.Notify(session, `
+		MATCH (s:Student {ID:$studentID})-[:COMPLETED]->(:Test {testID:$testID})-[:ADDED_BY]->(u:Teacher)
+	`, map[string]interface{}{
 		"studentID": tokenInfo.ID,
 		"testID":    testID,
+	}, repositories.Notification{
+		Type:    helpers.NotificationTypeGradingError,
+		Message: helpers.GradingErrorNotification,
+		Payload: repositories.NotificationPayload{
+			TestID:    testID,
+			StudentID: tokenInfo.ID,
+		},
+	})
+	if err != nil {
+		return err
 	}
 
-	return helpers.WriteTX(session, query, params)
+	events.Publish(repositories.TestEvent{
+		Type:      helpers.TestEventDisputed,
+		TestID:    testID,
+		StudentID: tokenInfo.ID,
+	})
+
+	return nil
 }
 
-func GradeTest(logger *log.Logger, session neo4j.Session, path string, token string, test repositories.CompletedTest, s3Bucket string, s3Region string, s3Profile string) error {
-	tokenInfo, err := GetTokenInfo(session, token)
+func GradeTest(logger *log.Logger, driver neo4j.Driver, session neo4j.Session, path string, token string, test repositories.CompletedTest, s3Bucket string, s3Region string, s3Profile string, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
 		return helpers.InvalidTokenError(path, err)
 	}
@@ -102,9 +175,31 @@ func GradeTest(logger *log.Logger, session neo4j.Session, path string, token str
 	if err != nil {
 		return err
 	}
+	if testDetails.TemplateStatus != helpers.TemplateStatusReady {
+		return fmt.Errorf("template for test %d is not ready: %s", testDetails.ID, testDetails.TemplateStatus)
+	}
 	testDetails.TestImageURL = test.TestImageURL
 
-	go helpers.GradeTestImage(logger, session, tokenInfo.ID, testDetails, s3Bucket, s3Region, s3Profile)
+	// grading outlives the request, so it opens a session of its own
+	go helpers.GradeTestImage(logger, driver, tokenInfo.ID, testDetails, s3Bucket, s3Region, s3Profile, dispatcher, events)
+
+	return nil
+}
+
+// CheckTestAuthor makes sure the token belongs to the teacher that added the test.
+func CheckTestAuthor(session neo4j.Session, path string, token string, testID int) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
+	}
+
+	tests, err := getTestForTeacher(session, tokenInfo.ID, testID)
+	if err != nil {
+		return err
+	}
+	if len(tests) == 0 {
+		return fmt.Errorf("test %d was not added by this teacher", testID)
+	}
 
 	return nil
 }
@@ -112,8 +207,8 @@ func GradeTest(logger *log.Logger, session neo4j.Session, path string, token str
 func GetTestDetails(session neo4j.Session, path string, token string, testName string, teacherID int) (repositories.CompletedTest, error) {
 	query := fmt.Sprintf(`
 		MATCH (t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE p.ID = $teacherID AND t.name = '%s' 
-		RETURN t.testID 
+		WHERE p.ID = $teacherID AND t.name = '%s' AND NOT coalesce(t.archived, false) 
+		RETURN t.testID
 	`, testName)
 
 	testID, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -153,8 +248,99 @@ func GetTestDetails(session neo4j.Session, path string, token string, testName s
 	return testDetails[0], nil
 }
 
-func AddTest(session neo4j.Session, path string, token string, test repositories.Test, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) (int, error) {
-	tokenInfo, err := GetTokenInfo(session, token)
+func GetTestTemplate(session neo4j.Session, path string, token string, testID int, format string, resolution int, renderer *helpers.TemplateRenderer, logger *log.Logger) ([]byte, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return nil, helpers.InvalidTokenError(path, err)
+	}
+	err = helpers.ValidateTemplateFile(format, resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	tests, err := getTestForTeacher(session, tokenInfo.ID, testID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tests) != 1 {
+		return nil, fmt.Errorf("could not get test with ID %d", testID)
+	}
+	test := tests[0].Test
+	if test.TemplateStatus == helpers.TemplateStatusPending {
+		return nil, fmt.Errorf("template for test %d is still being generated", testID)
+	}
+
+	templateURL := getTemplateFileURL(test, format, resolution)
+	if templateURL == helpers.EmptyStringParameter {
+		// the file has to match the layout the test is graded with, so it is rendered with the style the
+		// test was generated with rather than the current one of the faculty
+		style, err := getTemplateStyleForTest(session, testID)
+		if err != nil {
+			return nil, err
+		}
+		templateFile, err := renderer.RenderFile(test, style, format, resolution)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("regenerated %s template for test %d at %s\n", format, testID, templateFile.URL)
+
+		err = saveTemplateFile(session, test, templateFile)
+		if err != nil {
+			return nil, err
+		}
+		templateURL = templateFile.URL
+	}
+
+	return renderer.DownloadFile(templateURL)
+}
+
+func getTemplateFileURL(test repositories.Test, format string, resolution int) string {
+	if format == helpers.TemplateFormatPDF {
+		return test.TemplatePDFURL
+	}
+	if format == helpers.TemplateFormatJPG && resolution == helpers.DefaultTemplateResolution {
+		return test.TemplateImageURL
+	}
+
+	for _, preview := range test.TemplatePreviews {
+		if preview.Format == format && preview.Resolution == resolution {
+			return preview.URL
+		}
+	}
+
+	return helpers.EmptyStringParameter
+}
+
+func saveTemplateFile(session neo4j.Session, test repositories.Test, templateFile repositories.TemplateFile) error {
+	property := "templatePreviews"
+	value := templateFile.URL
+
+	if templateFile.Format == helpers.TemplateFormatPDF {
+		property = "templatePDF"
+	} else if templateFile.Format == helpers.TemplateFormatJPG && templateFile.Resolution == helpers.DefaultTemplateResolution {
+		property = "template"
+	} else {
+		previewsString, err := helpers.GetStringFromTemplateFiles(append(test.TemplatePreviews, templateFile))
+		if err != nil {
+			return err
+		}
+		value = previewsString
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (t:Test {testID:$testID}) 
+		SET t.%s = $value
+	`, property)
+	params := map[string]interface{}{
+		"testID": test.ID,
+		"value":  value,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+func AddTest(session neo4j.Session, path string, token string, test repositories.Test, renderer *helpers.TemplateRenderer) (int, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
 	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
 		return 0, helpers.InvalidTokenError(path, err)
 	}
@@ -162,9 +348,19 @@ func AddTest(session neo4j.Session, path string, token string, test repositories
 	queryPrefix := ""
 	testID := test.ID
 	if test.ID != 0 {
+		// only the teacher who added a test may change it
 		queryPrefix = `
-			MATCH (t:Test {testID:$testID}) 
+			MATCH (t:Test {testID:$testID})-[:ADDED_BY]->(:Teacher {ID:$teacherID}) 
 		`
+		err = checkExists(session, fmt.Sprintf("test %d", test.ID), queryPrefix+`
+			RETURN count(t) AS nr
+		`, map[string]interface{}{
+			"testID":    test.ID,
+			"teacherID": tokenInfo.ID,
+		})
+		if err != nil {
+			return 0, err
+		}
 	} else {
 		testID, err = getNextNodeID(session, "Test", "testID")
 		if err != nil {
@@ -172,23 +368,36 @@ func AddTest(session neo4j.Session, path string, token string, test repositories
 		}
 
 		queryPrefix = `
-			CREATE (t:Test {testID:$testID}) 
+			CREATE (t:Test {testID:$testID, publication:$publication}) 
 		`
 	}
 
-	templateURL, err := helpers.GenerateTestTemplate(test, s3Bucket, s3Region, s3Profile, logger)
+	for _, preview := range test.TemplatePreviews {
+		err = helpers.ValidateTemplateFile(preview.Format, preview.Resolution)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	logger.Printf("generated template for test %d at %s\n", testID, templateURL)
+	style, err := getTemplateStyleForTeacher(session, tokenInfo.ID)
+	if err != nil {
+		return 0, err
+	}
+	styleString, err := helpers.GetStringFromTemplateStyle(style)
+	if err != nil {
+		return 0, err
+	}
 
 	query := fmt.Sprintf(`
 		%s 
 		SET t.name='%s', t.nrQuestions=$nrQuestions, t.nrAnswers=$nrAnswers, t.points=$points, t.exOfficio=$exOfficio, 
-			t.multipleAnswersAllowed=$multipleAnswersAllowed, t.enablePartialScoring=$enablePartialScoring, t.mandatoryToPass=$mandatoryToPass,
-			t.template=$template 
+			t.multipleAnswersAllowed=$multipleAnswersAllowed, t.enablePartialScoring=$enablePartialScoring, t.mandatoryToPass=$mandatoryToPass, 
+			t.templateStatus=$templateStatus, t.templateError='', t.templateStyle=$templateStyle
 	`, queryPrefix, test.Name)
 
 	params := map[string]interface{}{
 		"testID":                 testID,
+		"teacherID":              tokenInfo.ID,
 		"nrQuestions":            test.NrQuestions,
 		"nrAnswers":              test.NrAnswerOptions,
 		"points":                 test.TotalPoints,
@@ -196,7 +405,9 @@ func AddTest(session neo4j.Session, path string, token string, test repositories
 		"multipleAnswersAllowed": test.MultipleAnswersAllowed,
 		"enablePartialScoring":   test.EnablePartialScoring,
 		"mandatoryToPass":        test.MandatoryToPass,
-		"template":               templateURL,
+		"templateStatus":         helpers.TemplateStatusPending,
+		"templateStyle":          styleString,
+		"publication":            helpers.TestPublicationDraft,
 	}
 
 	err = helpers.WriteTX(session, query, params)
@@ -206,7 +417,7 @@ func AddTest(session neo4j.Session, path string, token string, test repositories
 
 	query = fmt.Sprintf(`
 		MATCH (p:Teacher {ID:$teacherID}), (t:Test {testID:$testID}), (subj:Subject {name:'%s'}) 
-		MERGE (t)-[r:ADDED_BY]->(p)
+		MERGE (t)-[r:ADDED_BY]->(p) 
 		MERGE (t)-[q:BELONGS_TO]->(subj)
 	`, test.Subject)
 
@@ -215,44 +426,97 @@ func AddTest(session neo4j.Session, path string, token string, test repositories
 		"testID":    testID,
 	}
 
-	return testID, helpers.WriteTX(session, query, params)
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return 0, err
+	}
+
+	test.ID = testID
+	err = renderer.Enqueue(helpers.TemplateJob{
+		Test:   test,
+		Style:  style,
+		OnDone: saveGeneratedTemplate,
+	})
+	if err != nil {
+		return testID, saveGeneratedTemplate(session, test, err)
+	}
+
+	return testID, nil
 }
 
-func DeleteTest(session neo4j.Session, path string, token string, testID int) error {
-	tokenInfo, err := GetTokenInfo(session, token)
-	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
-		return helpers.InvalidTokenError(path, err)
+func saveGeneratedTemplate(session neo4j.Session, test repositories.Test, templateErr error) error {
+	if templateErr != nil {
+		query := `
+			MATCH (t:Test {testID:$testID}) 
+			SET t.templateStatus=$templateStatus, t.templateError=$templateError
+		`
+		params := map[string]interface{}{
+			"testID":         test.ID,
+			"templateStatus": helpers.TemplateStatusFailed,
+			"templateError":  templateErr.Error(),
+		}
+
+		return helpers.WriteTX(session, query, params)
+	}
+
+	layoutString, err := helpers.GetStringFromLayout(test.TemplateLayout)
+	if err != nil {
+		return err
+	}
+	previewsString, err := helpers.GetStringFromTemplateFiles(test.TemplatePreviews)
+	if err != nil {
+		return err
 	}
 
 	query := `
-		MATCH (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE p.ID = $teacherID AND t.testID = $testID 
-		DETACH DELETE t
+		MATCH (t:Test {testID:$testID}) 
+		SET t.template=$template, t.layout=$layout, t.templatePDF=$templatePDF, t.templatePreviews=$templatePreviews, 
+			t.templateStatus=$templateStatus, t.templateError=''
 	`
 	params := map[string]interface{}{
-		"teacherID": tokenInfo.ID,
-		"testID":    testID,
+		"testID":           test.ID,
+		"template":         test.TemplateImageURL,
+		"layout":           layoutString,
+		"templatePDF":      test.TemplatePDFURL,
+		"templatePreviews": previewsString,
+		"templateStatus":   helpers.TemplateStatusReady,
 	}
 
 	return helpers.WriteTX(session, query, params)
 }
 
-func GetNotificationTests(session neo4j.Session, path string, token string) ([]repositories.CompletedTest, error) {
-	tokenInfo, err := GetTokenInfo(session, token)
-	if err != nil {
-		return []repositories.CompletedTest{}, helpers.InvalidTokenError(path, err)
+// DeleteTest archives a test. It disappears along with its grades until it is restored, or purged once
+// it has been archived for longer than the retention period.
+func DeleteTest(session neo4j.Session, path string, token string, testID int) error {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return helpers.InvalidTokenError(path, err)
 	}
 
-	notificationMessages := make([]string, 2)
-	if tokenInfo.Label == repositories.TeacherLabel {
-		notificationMessages[0] = helpers.GradingErrorNotification
-		notificationMessages[1] = helpers.TestGradedNotification
-	} else {
-		notificationMessages[0] = helpers.TestCorrectionNotification
-		notificationMessages[1] = helpers.TestGradedNotification
+	query := `
+		MATCH (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
+		WHERE p.ID = $teacherID AND t.testID = $testID AND NOT coalesce(t.archived, false) 
+		OPTIONAL MATCH (t)-[:BELONGS_TO]->(subj:Subject) 
+		WITH t, t.name + ' (' + coalesce(subj.name, '') + ')' AS oldName 
+		SET t.archived = true, t.archivedAt = $now 
+		RETURN oldName
+	`
+	params := map[string]interface{}{
+		"teacherID": tokenInfo.ID,
+		"testID":    testID,
+		"now":       time.Now().Unix(),
 	}
 
-	return getNotificationsCompletedTests(session, tokenInfo, notificationMessages)
+	_, err = writeAudited(session, tokenInfo, query, params, func(name string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionTestDeletion,
+			EntityType: helpers.AuditEntityTest,
+			EntityID:   testID,
+			Details:    name,
+		}
+	})
+
+	return err
 }
 
 func GetTests(session neo4j.Session, path string, token string, testID int, searchString string, singleTest bool) ([]repositories.CompletedTest, error) {
@@ -279,10 +543,10 @@ func getAllCompletedTestsForStudent(session neo4j.Session, studentID int, search
 	extraConditionSearch := ""
 	if searchString != helpers.EmptyStringParameter {
 		extraConditionSearch = fmt.Sprintf(`
-			CALL db.index.fulltext.queryNodes('testsAndSubjects', '%s~')
-			YIELD node, score
-			WITH collect({name:node.name}) AS rows
-			UNWIND rows AS row
+			CALL db.index.fulltext.queryNodes('testsAndSubjects', '%s~') 
+			YIELD node, score 
+			WITH collect({name:node.name}) AS rows 
+			UNWIND rows AS row 
 			WITH distinct(row.name) AS name
 		`, searchString)
 
@@ -295,12 +559,12 @@ func getAllCompletedTestsForStudent(session neo4j.Session, studentID int, search
 
 	query := fmt.Sprintf(` %s 
 		MATCH (g:Group)<-[sg:MEMBER_OF]-(s:Student)-[st:COMPLETED]->(t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE s.ID = $studentID %s 
+		WHERE s.ID = $studentID AND coalesce(t.publication, $published) = $published AND NOT coalesce(t.archived, false) %s 
 		RETURN s.ID, s.email, s.firstName, s.lastName, g.gID, 
 				t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
-					t.enablePartialScoring, t.mandatoryToPass, t.template, count(st) as nrTestsGraded, t.answers, 
+					t.enablePartialScoring, t.mandatoryToPass, t.template, t.layout, t.templatePDF, t.templatePreviews, t.templateStatus, t.templateError, t.publication, t.releaseAt, t.publishedAt, count(st) as nrTestsGraded, t.answers, 
 					p.ID, p.email, p.firstName, p.lastName, 
-				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.notificationMessage, st.feedback, st.answers 
+				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.feedback, st.answers 
 	`, extraConditionSearch, extraCondition)
 
 	testResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -308,7 +572,10 @@ func getAllCompletedTestsForStudent(session neo4j.Session, studentID int, search
 
 		fmt.Printf("query: %s\n", query)
 
-		records, err := tx.Run(query, map[string]interface{}{"studentID": studentID})
+		records, err := tx.Run(query, map[string]interface{}{
+			"studentID": studentID,
+			"published": helpers.TestPublicationPublished,
+		})
 		if err != nil {
 			return []repositories.CompletedTest{}, err
 		}
@@ -338,10 +605,10 @@ func getAllTestsForTeacher(session neo4j.Session, teacherID int, searchString st
 	extraConditionSearch := ""
 	if searchString != helpers.EmptyStringParameter {
 		extraConditionSearch = fmt.Sprintf(`
-			CALL db.index.fulltext.queryNodes('testsAndSubjects', '%s~')
-			YIELD node, score
-			WITH collect({name:node.name}) AS rows
-			UNWIND rows AS row
+			CALL db.index.fulltext.queryNodes('testsAndSubjects', '%s~') 
+			YIELD node, score 
+			WITH collect({name:node.name}) AS rows 
+			UNWIND rows AS row 
 			WITH distinct(row.name) AS name
 		`, searchString)
 
@@ -352,9 +619,9 @@ func getAllTestsForTeacher(session neo4j.Session, teacherID int, searchString st
 		MATCH (p:Teacher)<-[tp:ADDED_BY]-(t:Test)-[ts:BELONGS_TO]->(subj:Subject) 
 			OPTIONAL MATCH (Student)-[st:COMPLETED]->(t:Test) 
 		WITH p, tp, t, ts, subj, st 
-		WHERE p.ID = $teacherID %s
+		WHERE p.ID = $teacherID AND NOT coalesce(t.archived, false) %s
 		RETURN t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
-					t.enablePartialScoring, t.mandatoryToPass, t.template, count(st) as nrTestsGraded, t.answers, 
+					t.enablePartialScoring, t.mandatoryToPass, t.template, t.layout, t.templatePDF, t.templatePreviews, t.templateStatus, t.templateError, t.publication, t.releaseAt, t.publishedAt, count(st) as nrTestsGraded, t.answers, 
 					p.ID, p.email, p.firstName, p.lastName
 	`, extraConditionSearch, extraCondition)
 
@@ -391,9 +658,9 @@ func getAllTestsForTeacher(session neo4j.Session, teacherID int, searchString st
 func getTestForTeacher(session neo4j.Session, teacherID int, testID int) ([]repositories.CompletedTest, error) {
 	query := `
 		MATCH (t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE p.ID = $teacherID AND t.testID = $testID 
+		WHERE p.ID = $teacherID AND t.testID = $testID AND NOT coalesce(t.archived, false) 
 		RETURN t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
-					t.enablePartialScoring, t.mandatoryToPass, t.template, 0 as nrTestsGraded, t.answers, 
+					t.enablePartialScoring, t.mandatoryToPass, t.template, t.layout, t.templatePDF, t.templatePreviews, t.templateStatus, t.templateError, t.publication, t.releaseAt, t.publishedAt, 0 as nrTestsGraded, t.answers, 
 					p.ID, p.email, p.firstName, p.lastName
 	`
 
@@ -433,12 +700,12 @@ func getTestForTeacher(session neo4j.Session, teacherID int, testID int) ([]repo
 func getAllCompletedTestsForTeacher(session neo4j.Session, testID int) ([]repositories.CompletedTest, error) {
 	query := `
 		MATCH (g:Group)<-[sg:MEMBER_OF]-(s:Student)-[st:COMPLETED]->(t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE t.testID = $testID 
+		WHERE t.testID = $testID AND NOT coalesce(t.archived, false) AND NOT coalesce(s.archived, false) 
 		RETURN s.ID, s.email, s.firstName, s.lastName, g.gID, 
 				t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
-					t.enablePartialScoring, t.mandatoryToPass, t.template, count(st) as nrTestsGraded, t.answers, 
+					t.enablePartialScoring, t.mandatoryToPass, t.template, t.layout, t.templatePDF, t.templatePreviews, t.templateStatus, t.templateError, t.publication, t.releaseAt, t.publishedAt, count(st) as nrTestsGraded, t.answers, 
 					p.ID, p.email, p.firstName, p.lastName, 
-				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.notificationMessage, st.feedback, st.answers 
+				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.feedback, st.answers
 	`
 
 	testResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -471,57 +738,6 @@ func getAllCompletedTestsForTeacher(session neo4j.Session, testID int) ([]reposi
 	return testResults.([]repositories.CompletedTest), nil
 }
 
-func getNotificationsCompletedTests(session neo4j.Session, tokenInfo repositories.TokenInfo, messages []string) ([]repositories.CompletedTest, error) {
-	nodePrefix := "p"
-	if tokenInfo.Label == repositories.StudentLabel {
-		nodePrefix = "s"
-	}
-
-	messagesString, err := json.Marshal(messages)
-	if err != nil {
-		return []repositories.CompletedTest{}, err
-	}
-	query := fmt.Sprintf(`
-		MATCH (g:Group)<-[sg:MEMBER_OF]-(s:Student)-[st:COMPLETED]->(t:Test)-[ts:BELONGS_TO]->(subj:Subject), (t:Test)-[tp:ADDED_BY]->(p:Teacher) 
-		WHERE %s.ID = $ID 
-			AND st.notificationMessage IN %s
-		RETURN s.ID, s.email, s.firstName, s.lastName, g.gID, 
-				t.testID, subj.name, t.name, t.nrQuestions, t.nrAnswers, t.points, t.exOfficio, t.multipleAnswersAllowed, 
-					t.enablePartialScoring, t.mandatoryToPass, t.template, count(st) as nrTestsGraded, t.answers, 
-					p.ID, p.email, p.firstName, p.lastName, 
-				st.testImage, st.gradedTestImage, st.grade, st.timestamp, st.correctedGrade, st.correctedGradeTimestamp, st.notificationMessage, st.feedback, st.answers 
-	`, nodePrefix, messagesString)
-
-	testResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
-		var results []repositories.CompletedTest
-
-		fmt.Printf("query: %s\n", query)
-
-		records, err := tx.Run(query, map[string]interface{}{"ID": tokenInfo.ID})
-		if err != nil {
-			return []repositories.CompletedTest{}, err
-		}
-
-		for records.Next() {
-			record := records.Record()
-			completedTest, err := getCompletedTestFromTestQuery(record)
-			if err != nil {
-				return []repositories.CompletedTest{}, err
-			}
-
-			results = append(results, completedTest)
-		}
-
-		return results, nil
-	})
-
-	if err != nil {
-		return []repositories.CompletedTest{}, err
-	}
-
-	return testResults.([]repositories.CompletedTest), nil
-}
-
 func getCompletedTestFromTestQuery(record neo4j.Record) (repositories.CompletedTest, error) {
 	test, err := getTestFromTestQuery(record)
 	if err != nil {
@@ -556,10 +772,6 @@ func getCompletedTestFromTestQuery(record neo4j.Record) (repositories.CompletedT
 	if err != nil {
 		return repositories.CompletedTest{}, err
 	}
-	notification, err := helpers.GetStringParameterFromQuery(record, "st.notificationMessage", true, false)
-	if err != nil {
-		return repositories.CompletedTest{}, err
-	}
 	feedback, err := helpers.GetStringParameterFromQuery(record, "st.feedback", true, false)
 	if err != nil {
 		return repositories.CompletedTest{}, err
@@ -581,7 +793,6 @@ func getCompletedTestFromTestQuery(record neo4j.Record) (repositories.CompletedT
 		GradeTimestamp:          gradeTimestamp,
 		CorrectedGrade:          correctedGrade,
 		CorrectedGradeTimestamp: correctedGradeTimestamp,
-		NotificationMessage:     notification,
 		Feedback:                feedback,
 		Author:                  student,
 		Answers:                 mapAnswers,
@@ -633,7 +844,45 @@ func getTestFromTestQuery(record neo4j.Record) (repositories.Test, error) {
 	if err != nil {
 		return repositories.Test{}, err
 	}
-	templateURL, err := helpers.GetStringParameterFromQuery(record, "t.template", true, true)
+	templateURL, err := helpers.GetStringParameterFromQuery(record, "t.template", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	layout, err := helpers.GetLayoutFromQuery(record, "t.layout", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	templatePDFURL, err := helpers.GetStringParameterFromQuery(record, "t.templatePDF", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	templatePreviews, err := helpers.GetTemplateFilesFromQuery(record, "t.templatePreviews", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	templateStatus, err := helpers.GetStringParameterFromQuery(record, "t.templateStatus", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	if templateStatus == helpers.EmptyStringParameter && templateURL != helpers.EmptyStringParameter {
+		templateStatus = helpers.TemplateStatusReady
+	}
+	templateError, err := helpers.GetStringParameterFromQuery(record, "t.templateError", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	publication, err := helpers.GetStringParameterFromQuery(record, "t.publication", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	if publication == helpers.EmptyStringParameter {
+		publication = helpers.TestPublicationPublished
+	}
+	releaseAt, err := helpers.GetIntParameterFromQuery(record, "t.releaseAt", true, false)
+	if err != nil {
+		return repositories.Test{}, err
+	}
+	publishedAt, err := helpers.GetIntParameterFromQuery(record, "t.publishedAt", true, false)
 	if err != nil {
 		return repositories.Test{}, err
 	}
@@ -658,6 +907,14 @@ func getTestFromTestQuery(record neo4j.Record) (repositories.Test, error) {
 		EnablePartialScoring:   enablePartialScoring,
 		MandatoryToPass:        mandatoryToPass,
 		TemplateImageURL:       templateURL,
+		TemplateLayout:         layout,
+		TemplatePDFURL:         templatePDFURL,
+		TemplatePreviews:       templatePreviews,
+		TemplateStatus:         templateStatus,
+		TemplateError:          templateError,
+		Publication:            publication,
+		ReleaseAt:              releaseAt,
+		PublishedAt:            publishedAt,
 		NrTestsGraded:          gradeCount,
 		Teacher:                teacher,
 		CorrectAnswers:         answers,
@@ -682,7 +939,7 @@ func getStudentFromTestQuery(record neo4j.Record) (repositories.Student, error)
 }
 
 func getNextNodeID(session neo4j.Session, label string, IDProperty string) (int, error) {
-	query := fmt.Sprintf("MATCH (n:%s) RETURN max(n.%s) + 1 as next", label, IDProperty)
+	query := fmt.Sprintf("MATCH (n:%s) RETURN coalesce(max(n.%s), 0) + 1 as next", label, IDProperty)
 	params := map[string]interface{}{}
 
 	nextID, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -711,3 +968,25 @@ func getNextNodeID(session neo4j.Session, label string, IDProperty string) (int,
 
 	return nextID.(int), nil
 }
+
+func GetTestStats(session neo4j.Session, path string, token string, testID int) (repositories.TestStats, error) {
+	tokenInfo, err := GetVerifiedTokenInfo(session, token)
+	if err != nil || tokenInfo.Label != repositories.TeacherLabel {
+		return repositories.TestStats{}, helpers.InvalidTokenError(path, err)
+	}
+
+	tests, err := getTestForTeacher(session, tokenInfo.ID, testID)
+	if err != nil {
+		return repositories.TestStats{}, err
+	}
+	if len(tests) == 0 {
+		return repositories.TestStats{}, fmt.Errorf("test %d was not added by this teacher", testID)
+	}
+
+	submissions, err := getAllCompletedTestsForTeacher(session, testID)
+	if err != nil {
+		return repositories.TestStats{}, err
+	}
+
+	return helpers.CalculateTestStats(tests[0].Test, submissions), nil
+}
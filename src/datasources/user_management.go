@@ -0,0 +1,451 @@
+package datasources
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+const impersonationValidity = time.Hour
+
+// GetManagedUsers lists students and teachers for administrators, optionally only the ones of a type, with
+// a status, or whose name or email contains the search string. Listing the pending teachers gives the sign-ups
+// waiting for approval. Deleted users are only listed when asking for the archived ones.
+func GetManagedUsers(session neo4j.Session, path string, token string, userType string, searchString string, status string, archived bool) ([]repositories.ManagedUser, error) {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return []repositories.ManagedUser{}, helpers.InvalidTokenError(path, err)
+	}
+
+	extraCondition := " (n:Student OR n:Teacher) "
+	if userType != helpers.EmptyStringParameter {
+		label, err := helpers.GetUserLabel(userType)
+		if err != nil {
+			return []repositories.ManagedUser{}, err
+		}
+		extraCondition = fmt.Sprintf(" n:%s ", label)
+	}
+	if searchString != helpers.EmptyStringParameter {
+		extraCondition += `
+			AND (toLower(n.email) CONTAINS $search OR toLower(n.firstName + ' ' + n.lastName) CONTAINS $search 
+			OR toLower(n.lastName + ' ' + n.firstName) CONTAINS $search)
+		`
+	}
+	if status != helpers.EmptyStringParameter {
+		if !helpers.IsUserStatus(status) {
+			return []repositories.ManagedUser{}, fmt.Errorf("unknown user status '%s'", status)
+		}
+		extraCondition += " AND coalesce(n.status, $active) = $status "
+	}
+	extraCondition += " AND coalesce(n.archived, false) = $archived "
+
+	query := fmt.Sprintf(`
+		MATCH (n) 
+		WHERE %s 
+		OPTIONAL MATCH (n)-[:MEMBER_OF]->(g:Group)-[:HAS_SPECIALIZATION]->(spec:Specialization)-[:IN_FACULTY]->(sf:Faculty) 
+		OPTIONAL MATCH (n)-[:AFILLIATED_TO]->(pf:Faculty) 
+		RETURN n.ID, n.email, n.firstName, n.lastName, n:Student AS isStudent, coalesce(n.status, $active) AS status, 
+			coalesce(sf.name, pf.name) AS faculty, spec.name, g.gID, n.archivedAt 
+		ORDER BY n.lastName, n.firstName
+	`, extraCondition)
+	params := map[string]interface{}{
+		"search":   strings.ToLower(searchString),
+		"status":   status,
+		"active":   helpers.UserStatusActive,
+		"archived": archived,
+	}
+
+	users, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := []repositories.ManagedUser{}
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.ManagedUser{}, err
+		}
+		for records.Next() {
+			user, err := getManagedUserFromQuery(records.Record())
+			if err != nil {
+				return []repositories.ManagedUser{}, err
+			}
+
+			results = append(results, user)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.ManagedUser{}, err
+	}
+
+	return users.([]repositories.ManagedUser), nil
+}
+
+// SetUserStatus approves a teacher who signed up, deactivates an account or reactivates it. Deactivated users
+// are logged out right away.
+func SetUserStatus(session neo4j.Session, path string, token string, userType string, userID int, status string) error {
+	adminInfo, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if status != helpers.UserStatusActive && status != helpers.UserStatusDeactivated {
+		return fmt.Errorf("users can only be set to '%s' or '%s'", helpers.UserStatusActive, helpers.UserStatusDeactivated)
+	}
+	label, err := checkManagedUser(session, userType, userID)
+	if err != nil {
+		return err
+	}
+
+	removeToken := ""
+	if status == helpers.UserStatusDeactivated {
+		removeToken = " REMOVE n.token "
+	}
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		SET n.status = $status, n.statusChangedAt = $now, n.statusChangedBy = $adminID 
+		%s
+	`, label, removeToken)
+	params := map[string]interface{}{
+		"userID":  userID,
+		"status":  status,
+		"now":     time.Now().Unix(),
+		"adminID": adminInfo.ID,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// ResetUserPassword sets a new password for a user and logs them out, so they have to log in with it.
+func ResetUserPassword(session neo4j.Session, path string, token string, userType string, userID int, newPassword string) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if newPassword == helpers.EmptyStringParameter {
+		return fmt.Errorf("password cannot be empty")
+	}
+	label, err := checkManagedUser(session, userType, userID)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		SET n.password = $password 
+		REMOVE n.token
+	`, label)
+	params := map[string]interface{}{
+		"userID":   userID,
+		"password": newPassword,
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// AssignUser moves a student to another group or a teacher to another faculty.
+func AssignUser(session neo4j.Session, path string, token string, userType string, userID int, assignment repositories.UserAssignment) error {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	label, err := checkManagedUser(session, userType, userID)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"userID":  userID,
+		"gID":     assignment.Group,
+		"faculty": assignment.Faculty,
+	}
+
+	if label == repositories.TeacherLabel {
+		err = checkExists(session, fmt.Sprintf("faculty '%s'", assignment.Faculty), `
+			MATCH (f:Faculty {name:$faculty}) 
+			RETURN count(f) AS nr
+		`, params)
+	} else {
+		err = checkExists(session, fmt.Sprintf("group %d", assignment.Group), `
+			MATCH (g:Group {gID:$gID}) 
+			RETURN count(g) AS nr
+		`, params)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+		MATCH (s:Student {ID:$userID}), (g:Group {gID:$gID}) 
+		OPTIONAL MATCH (s)-[membership:MEMBER_OF]->(:Group) 
+		DELETE membership 
+		WITH DISTINCT s, g 
+		MERGE (s)-[:MEMBER_OF]->(g)
+	`
+	if label == repositories.TeacherLabel {
+		query = `
+			MATCH (p:Teacher {ID:$userID}), (f:Faculty {name:$faculty}) 
+			OPTIONAL MATCH (p)-[affiliation:AFILLIATED_TO]->(:Faculty) 
+			DELETE affiliation 
+			WITH DISTINCT p, f 
+			MERGE (p)-[:AFILLIATED_TO]->(f)
+		`
+	}
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// ImpersonateUser returns a token for an active user so an administrator can see the application as they do.
+// The token is not the one of the user: it expires after impersonationValidity, and what is done with it
+// is audited as done by the administrator. Every impersonation is kept with its reason and can be listed
+// with GetImpersonations.
+func ImpersonateUser(session neo4j.Session, path string, token string, userType string, userID int, reason string) (repositories.Item, error) {
+	adminInfo, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return repositories.Item{}, helpers.InvalidTokenError(path, err)
+	}
+	if strings.TrimSpace(reason) == helpers.EmptyStringParameter {
+		return repositories.Item{}, fmt.Errorf("impersonation needs a reason")
+	}
+	label, err := checkManagedUser(session, userType, userID)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+	status, err := getManagedUserStatus(session, label, userID)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+	err = helpers.CheckUserStatus(status)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	now := time.Now()
+	query := fmt.Sprintf(`
+		MATCH (a:Admin {ID:$adminID}), (n:%s {ID:$userID}) 
+		CREATE (a)-[:IMPERSONATED {reason:$reason, token:$token, createdAt:$now, expiresAt:$expiresAt}]->(n)
+	`, label)
+	params := map[string]interface{}{
+		"adminID":   adminInfo.ID,
+		"userID":    userID,
+		"token":     helpers.GenerateToken(tokenLength),
+		"reason":    reason,
+		"now":       now.Unix(),
+		"expiresAt": now.Add(impersonationValidity).Unix(),
+	}
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	return repositories.Item{Name: params["token"].(string)}, nil
+}
+
+// GetImpersonations lists the impersonations done by administrators, newest first.
+func GetImpersonations(session neo4j.Session, path string, token string) ([]repositories.Impersonation, error) {
+	_, err := GetAdminTokenInfo(session, token)
+	if err != nil {
+		return []repositories.Impersonation{}, helpers.InvalidTokenError(path, err)
+	}
+
+	query := `
+		MATCH (a:Admin)-[i:IMPERSONATED]->(n) 
+		RETURN a.ID, a.email, a.firstName, a.lastName, n.ID, n.email, n.firstName, n.lastName, n:Student AS isStudent, 
+			i.reason, i.createdAt, coalesce(i.expiresAt, i.createdAt) AS expiresAt 
+		ORDER BY i.createdAt DESC
+	`
+
+	impersonations, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		results := []repositories.Impersonation{}
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{})
+		if err != nil {
+			return []repositories.Impersonation{}, err
+		}
+		for records.Next() {
+			impersonation, err := getImpersonationFromQuery(records.Record())
+			if err != nil {
+				return []repositories.Impersonation{}, err
+			}
+
+			results = append(results, impersonation)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.Impersonation{}, err
+	}
+
+	return impersonations.([]repositories.Impersonation), nil
+}
+
+// checkManagedUser returns the label of the user type after making sure the user exists.
+func checkManagedUser(session neo4j.Session, userType string, userID int) (string, error) {
+	label, err := helpers.GetUserLabel(userType)
+	if err != nil {
+		return helpers.EmptyStringParameter, err
+	}
+
+	return label, checkExists(session, fmt.Sprintf("%s %d", strings.ToLower(label), userID), fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		RETURN count(n) AS nr
+	`, label), map[string]interface{}{"userID": userID})
+}
+
+func getManagedUserStatus(session neo4j.Session, label string, userID int) (string, error) {
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		RETURN coalesce(n.status, $active) AS status
+	`, label)
+
+	return getManagedUserProperty(session, query, userID, "status")
+}
+
+func getManagedUserProperty(session neo4j.Session, query string, userID int, key string) (string, error) {
+	params := map[string]interface{}{
+		"userID": userID,
+		"active": helpers.UserStatusActive,
+	}
+
+	value, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return helpers.EmptyStringParameter, err
+		}
+		if !records.Next() {
+			return helpers.EmptyStringParameter, fmt.Errorf("user %d not found", userID)
+		}
+
+		return helpers.GetStringParameterFromQuery(records.Record(), key, true, true)
+	})
+	if err != nil {
+		return helpers.EmptyStringParameter, err
+	}
+
+	return value.(string), nil
+}
+
+func getManagedUserFromQuery(record neo4j.Record) (repositories.ManagedUser, error) {
+	user, err := getManagedUserIdentityFromQuery(record, "n")
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	user.Type, err = getUserTypeFromQuery(record)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	user.Faculty, err = helpers.GetStringParameterFromQuery(record, "faculty", false, false)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	status, err := helpers.GetStringParameterFromQuery(record, "status", true, true)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	specialization, err := helpers.GetStringParameterFromQuery(record, "spec.name", false, false)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	group, err := helpers.GetIntParameterFromQuery(record, "g.gID", false, false)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+	archivedAt, err := helpers.GetIntParameterFromQuery(record, "n.archivedAt", false, false)
+	if err != nil {
+		return repositories.ManagedUser{}, err
+	}
+
+	return repositories.ManagedUser{
+		User:           user,
+		Status:         status,
+		Specialization: specialization,
+		Group:          group,
+		ArchivedAt:     archivedAt,
+	}, nil
+}
+
+func getImpersonationFromQuery(record neo4j.Record) (repositories.Impersonation, error) {
+	admin, err := getManagedUserIdentityFromQuery(record, "a")
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+	admin.Type = repositories.AdminType
+	user, err := getManagedUserIdentityFromQuery(record, "n")
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+	user.Type, err = getUserTypeFromQuery(record)
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+	reason, err := helpers.GetStringParameterFromQuery(record, "i.reason", true, true)
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+	createdAt, err := helpers.GetIntParameterFromQuery(record, "i.createdAt", true, true)
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+	expiresAt, err := helpers.GetIntParameterFromQuery(record, "expiresAt", true, true)
+	if err != nil {
+		return repositories.Impersonation{}, err
+	}
+
+	return repositories.Impersonation{
+		Admin:     admin,
+		User:      user,
+		Reason:    reason,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// getManagedUserIdentityFromQuery reads who a user is. Names are optional, since imported students and
+// administrators may not have all of them.
+func getManagedUserIdentityFromQuery(record neo4j.Record, nodeName string) (repositories.User, error) {
+	ID, err := helpers.GetIntParameterFromQuery(record, fmt.Sprintf("%s.ID", nodeName), true, true)
+	if err != nil {
+		return repositories.User{}, err
+	}
+	email, err := helpers.GetStringParameterFromQuery(record, fmt.Sprintf("%s.email", nodeName), true, true)
+	if err != nil {
+		return repositories.User{}, err
+	}
+	firstName, err := helpers.GetStringParameterFromQuery(record, fmt.Sprintf("%s.firstName", nodeName), false, false)
+	if err != nil {
+		return repositories.User{}, err
+	}
+	lastName, err := helpers.GetStringParameterFromQuery(record, fmt.Sprintf("%s.lastName", nodeName), false, false)
+	if err != nil {
+		return repositories.User{}, err
+	}
+
+	return repositories.User{
+		ID:        ID,
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}, nil
+}
+
+func getUserTypeFromQuery(record neo4j.Record) (string, error) {
+	isStudent, err := helpers.GetBoolParameterFromQuery(record, "isStudent", true, true)
+	if err != nil {
+		return helpers.EmptyStringParameter, err
+	}
+	if isStudent {
+		return repositories.StudentType, nil
+	}
+
+	return repositories.TeacherType, nil
+}
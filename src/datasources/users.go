@@ -2,6 +2,7 @@ package datasources
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 
@@ -11,17 +12,28 @@ import (
 
 const tokenLength = 20
 
+// GetTokenInfo returns who the token of a student or teacher belongs to. Tokens an administrator got to
+// impersonate someone work as well until they expire, and tell which administrator uses them.
 func GetTokenInfo(session neo4j.Session, token string) (repositories.TokenInfo, error) {
 	query := `
+		OPTIONAL MATCH (a:Admin)-[i:IMPERSONATED {token:$token}]->(m) 
+		WHERE i.expiresAt > $now 
+		WITH a, m 
 		MATCH (n) 
-		WHERE (n:Student OR n:Teacher) AND n.token = $token 
-		RETURN n.ID AS userID, labels(n) AS type
+		WHERE (n:Student OR n:Teacher) AND (n.token = $token OR n = m) AND NOT coalesce(n.archived, false) 
+		RETURN n.ID AS userID, labels(n) AS type, coalesce(n.status, $active) AS status, coalesce(n.emailVerified, true) AS verified, 
+			coalesce(a.ID, 0) AS impersonatorID
 	`
+	params := map[string]interface{}{
+		"token":  token,
+		"now":    time.Now().Unix(),
+		"active": helpers.UserStatusActive,
+	}
 	tokenQueryResults, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
 
 		fmt.Printf("query: %s\n", query)
 
-		records, err := tx.Run(query, map[string]interface{}{"token": token})
+		records, err := tx.Run(query, params)
 		if err != nil {
 			return repositories.TokenInfo{}, err
 		}
@@ -32,14 +44,32 @@ func GetTokenInfo(session neo4j.Session, token string) (repositories.TokenInfo,
 			if err != nil {
 				return repositories.TokenInfo{}, err
 			}
+			status, err := helpers.GetStringParameterFromQuery(record, "status", true, true)
+			if err != nil {
+				return repositories.TokenInfo{}, err
+			}
+			err = helpers.CheckUserStatus(status)
+			if err != nil {
+				return repositories.TokenInfo{}, err
+			}
+			verified, err := helpers.GetBoolParameterFromQuery(record, "verified", true, true)
+			if err != nil {
+				return repositories.TokenInfo{}, err
+			}
+			impersonatorID, err := helpers.GetIntParameterFromQuery(record, "impersonatorID", true, true)
+			if err != nil {
+				return repositories.TokenInfo{}, err
+			}
 			resultType, ok := record.Get("type")
 			if !ok {
 				return repositories.TokenInfo{}, fmt.Errorf("'type' not found in query result")
 			}
 
 			return repositories.TokenInfo{
-				ID:    resultID,
-				Label: helpers.GetStringSliceFromInterfaceSlice(resultType.([]interface{}))[0],
+				ID:             resultID,
+				Label:          helpers.GetStringSliceFromInterfaceSlice(resultType.([]interface{}))[0],
+				Verified:       verified,
+				ImpersonatorID: impersonatorID,
 			}, nil
 		}
 
@@ -53,15 +83,32 @@ func GetTokenInfo(session neo4j.Session, token string) (repositories.TokenInfo,
 	return tokenQueryResults.(repositories.TokenInfo), nil
 }
 
+// GetVerifiedTokenInfo works like GetTokenInfo, but also fails for users who did not verify their email
+// address yet. It guards everything related to grading.
+func GetVerifiedTokenInfo(session neo4j.Session, token string) (repositories.TokenInfo, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return repositories.TokenInfo{}, err
+	}
+	if !tokenInfo.Verified {
+		return repositories.TokenInfo{}, fmt.Errorf("email address has not been verified yet")
+	}
+
+	return tokenInfo, nil
+}
+
 func GetTokenFromEmailAndPassword(session neo4j.Session, email string, password string) (string, error) {
 	var token string
-	query := fmt.Sprintf(`
+	query := `
 		MATCH (n) 
-		WHERE (n:Student OR n:Teacher) AND n.email = $email AND n.password = '%s'
-		RETURN n.token
-	`, password)
+		WHERE (n:Student OR n:Teacher OR n:Admin) AND n.email = $email AND n.password = $password 
+			AND NOT coalesce(n.archived, false) 
+		RETURN n.token, coalesce(n.status, $active) AS status
+	`
 	params := map[string]interface{}{
-		"email": email,
+		"email":    email,
+		"password": password,
+		"active":   helpers.UserStatusActive,
 	}
 
 	result, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -75,6 +122,14 @@ func GetTokenFromEmailAndPassword(session neo4j.Session, email string, password
 
 		for records.Next() {
 			record := records.Record()
+			status, err := helpers.GetStringParameterFromQuery(record, "status", true, true)
+			if err != nil {
+				return helpers.EmptyStringParameter, err
+			}
+			err = helpers.CheckUserStatus(status)
+			if err != nil {
+				return helpers.EmptyStringParameter, err
+			}
 			token, err := helpers.GetStringParameterFromQuery(record, "token", false, false)
 			if err != nil {
 				return helpers.EmptyStringParameter, nil
@@ -93,14 +148,16 @@ func GetTokenFromEmailAndPassword(session neo4j.Session, email string, password
 	if token == helpers.EmptyStringParameter {
 		token = helpers.GenerateToken(tokenLength)
 
-		query := fmt.Sprintf(`
+		query := `
 			MATCH (n) 
-			WHERE (n:Student OR n:Teacher) AND n.email = $email AND n.password = '%s'
+			WHERE (n:Student OR n:Teacher OR n:Admin) AND n.email = $email AND n.password = $password 
+				AND NOT coalesce(n.archived, false) 
 			SET n.token=$token
-		`, password)
+		`
 		params = map[string]interface{}{
-			"email": email,
-			"token": token,
+			"email":    email,
+			"password": password,
+			"token":    token,
 		}
 
 		err = helpers.WriteTX(session, query, params)
@@ -114,46 +171,64 @@ func GetTokenFromEmailAndPassword(session neo4j.Session, email string, password
 
 func DeleteToken(session neo4j.Session, path string, token string) error {
 	_, err := GetTokenInfo(session, token)
+	if err != nil {
+		_, err = GetAdminTokenInfo(session, token)
+	}
 	if err != nil {
 		return helpers.InvalidTokenError(path, err)
 	}
 
 	query := `
 		MATCH (n) 
-		WHERE (n:Student OR n:Teacher) AND n.token = $token 
+		WHERE (n:Student OR n:Teacher OR n:Admin) AND n.token = $token 
 		REMOVE n.token
 	`
 	params := map[string]interface{}{
 		"token": token,
 	}
 
+	err = helpers.WriteTX(session, query, params)
+	if err != nil {
+		return err
+	}
+
+	// Logging out of an impersonation ends it.
+	query = `
+		MATCH (:Admin)-[i:IMPERSONATED {token:$token}]->() 
+		REMOVE i.token
+	`
+
 	return helpers.WriteTX(session, query, params)
 }
 
+// DeleteUser archives the account of the user and logs them out. An administrator can restore it until it
+// is purged.
 func DeleteUser(session neo4j.Session, path string, token string) error {
 	tokenInfo, err := GetTokenInfo(session, token)
 	if err != nil {
 		return helpers.InvalidTokenError(path, err)
 	}
 
-	query := `
-		MATCH (s:Student) 
-		WHERE s.ID = $ID
-		DETACH DELETE s
-	`
-	if tokenInfo.Label == repositories.TeacherLabel {
-		query = `
-			MATCH (p:Teacher) 
-			WHERE p.ID = $ID
-			DETACH DELETE s
-		`
-	}
-
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$ID}) 
+		SET n.archived = true, n.archivedAt = $now 
+		REMOVE n.token 
+		RETURN n.email
+	`, tokenInfo.Label)
 	params := map[string]interface{}{
-		"ID": tokenInfo.ID,
+		"ID":  tokenInfo.ID,
+		"now": time.Now().Unix(),
 	}
 
-	return helpers.WriteTX(session, query, params)
+	_, err = writeAudited(session, tokenInfo, query, params, func(string) repositories.AuditEntry {
+		return repositories.AuditEntry{
+			Action:     helpers.AuditActionUserDeletion,
+			EntityType: helpers.AuditEntityUser,
+			EntityID:   tokenInfo.ID,
+		}
+	})
+
+	return err
 }
 
 func ChangePassword(session neo4j.Session, path string, token string, oldPassword string, newPassword string) error {
@@ -231,18 +306,93 @@ func SetSubjectsForUser(session neo4j.Session, path string, token string, subjec
 	return nil
 }
 
-func AddUser(session neo4j.Session, userType string, user interface{}) (repositories.Item, error) {
+// AddUser saves a user who signs up and emails them a link to verify their address. Students following an
+// invitation take over the account the teacher added them with, which is verified by the invitation itself.
+// Signing up never changes an existing account; that is what UpdateUser is for.
+func AddUser(session neo4j.Session, userType string, user interface{}, invitationCode string, accounts *helpers.AccountMailer) (repositories.Item, error) {
+	var userID int
 	var err error
 	token := helpers.GenerateToken(tokenLength)
+	label := repositories.TeacherLabel
 	if userType == repositories.StudentType {
-		err = addStudent(session, user, token)
+		label = repositories.StudentLabel
+		student := user.(repositories.Student)
+		if student.ID != 0 {
+			return repositories.Item{}, fmt.Errorf("cannot sign up as an existing user")
+		}
+		if invitationCode != helpers.EmptyStringParameter {
+			student, err = getInvitedStudent(session, invitationCode, student, accounts)
+		} else {
+			err = checkEmailAvailable(session, student.Email)
+		}
+		if err == nil {
+			userID, err = addStudent(session, student, token)
+		}
+		if err == nil && invitationCode != helpers.EmptyStringParameter {
+			err = acceptInvitation(session, userID)
+		}
 	} else {
-		err = addTeacher(session, user, token)
+		professor := user.(repositories.Professor)
+		if professor.ID != 0 {
+			return repositories.Item{}, fmt.Errorf("cannot sign up as an existing user")
+		}
+		err = checkEmailAvailable(session, professor.Email)
+		if err == nil {
+			userID, err = addTeacher(session, professor, token)
+		}
 	}
 	if err != nil {
 		return repositories.Item{}, err
 	}
 
+	err = sendVerification(session, label, userID, accounts)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	return repositories.Item{Name: token}, nil
+}
+
+// UpdateUser changes the profile of the user with the token. The password and token are left as they are,
+// since changing the password needs the old one, and a new email address has to be verified again.
+func UpdateUser(session neo4j.Session, path string, token string, userType string, user interface{}, accounts *helpers.AccountMailer) (repositories.Item, error) {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return repositories.Item{}, helpers.InvalidTokenError(path, err)
+	}
+
+	if userType == repositories.StudentType {
+		student := user.(repositories.Student)
+		if tokenInfo.Label != repositories.StudentLabel || (student.ID != 0 && student.ID != tokenInfo.ID) {
+			return repositories.Item{}, helpers.InvalidTokenError(path, fmt.Errorf("can only update your own profile"))
+		}
+		student.ID = tokenInfo.ID
+		student.Password = helpers.EmptyStringParameter
+		err = checkEmailAvailableFor(session, student.Email, tokenInfo.Label, tokenInfo.ID)
+		if err == nil {
+			_, err = addStudent(session, student, helpers.EmptyStringParameter)
+		}
+	} else {
+		professor := user.(repositories.Professor)
+		if tokenInfo.Label != repositories.TeacherLabel || (professor.ID != 0 && professor.ID != tokenInfo.ID) {
+			return repositories.Item{}, helpers.InvalidTokenError(path, fmt.Errorf("can only update your own profile"))
+		}
+		professor.ID = tokenInfo.ID
+		professor.Password = helpers.EmptyStringParameter
+		err = checkEmailAvailableFor(session, professor.Email, tokenInfo.Label, tokenInfo.ID)
+		if err == nil {
+			_, err = addTeacher(session, professor, helpers.EmptyStringParameter)
+		}
+	}
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	err = sendVerification(session, tokenInfo.Label, tokenInfo.ID, accounts)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
 	return repositories.Item{Name: token}, nil
 }
 
@@ -258,6 +408,11 @@ func GetUserByEmailAndPassword(session neo4j.Session, path string, email string,
 func GetUser(session neo4j.Session, path string, token string) (interface{}, error) {
 	tokenInfo, err := GetTokenInfo(session, token)
 	if err != nil {
+		adminInfo, adminErr := GetAdminTokenInfo(session, token)
+		if adminErr == nil {
+			return getAdmin(session, adminInfo, token)
+		}
+
 		return repositories.User{}, helpers.InvalidTokenError(path, err)
 	}
 
@@ -268,8 +423,7 @@ func GetUser(session neo4j.Session, path string, token string) (interface{}, err
 	return getTeacher(session, tokenInfo, token)
 }
 
-func addStudent(session neo4j.Session, user interface{}, token string) error {
-	student := user.(repositories.Student)
+func addStudent(session neo4j.Session, student repositories.Student, token string) (int, error) {
 	queryPrefix := ""
 	studentID := student.ID
 	var err error
@@ -280,7 +434,7 @@ func addStudent(session neo4j.Session, user interface{}, token string) error {
 	} else {
 		studentID, err = getNextNodeID(session, "Student", "ID")
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		queryPrefix = `
@@ -290,7 +444,8 @@ func addStudent(session neo4j.Session, user interface{}, token string) error {
 
 	query := fmt.Sprintf(`
 		%s 
-		SET s.year = '%s', s.email=$email, s.firstName=$firstName, s.lastName=$lastName, s.password=$password, s.token=$token 
+		SET s.emailVerified = CASE WHEN s.email = $email THEN coalesce(s.emailVerified, true) ELSE false END 
+		SET s.year = '%s', s.email=$email, s.firstName=$firstName, s.lastName=$lastName, s.password=CASE WHEN $password = '' THEN s.password ELSE $password END, s.token=CASE WHEN $token = '' THEN s.token ELSE $token END 
 	`, queryPrefix, student.Year)
 
 	params := map[string]interface{}{
@@ -304,7 +459,7 @@ func addStudent(session neo4j.Session, user interface{}, token string) error {
 
 	err = helpers.WriteTX(session, query, params)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	query = `
@@ -316,11 +471,11 @@ func addStudent(session neo4j.Session, user interface{}, token string) error {
 		"gID":       student.Group,
 	}
 
-	return helpers.WriteTX(session, query, params)
+	return studentID, helpers.WriteTX(session, query, params)
 }
 
-func addTeacher(session neo4j.Session, user interface{}, token string) error {
-	professor := user.(repositories.Professor)
+// addTeacher saves a teacher. Teachers who sign up cannot use their account until an administrator approves it.
+func addTeacher(session neo4j.Session, professor repositories.Professor, token string) (int, error) {
 	queryPrefix := ""
 	teacherID := professor.ID
 	var err error
@@ -331,17 +486,18 @@ func addTeacher(session neo4j.Session, user interface{}, token string) error {
 	} else {
 		teacherID, err = getNextNodeID(session, "Teacher", "ID")
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		queryPrefix = `
-			CREATE (p:Teacher {ID:$teacherID}) 
+			CREATE (p:Teacher {ID:$teacherID, status:$pending}) 
 		`
 	}
 
 	query := fmt.Sprintf(`
 		%s 
-		SET p.email=$email, p.firstName=$firstName, p.lastName=$lastName, p.password=$password, p.token=$token 
+		SET p.emailVerified = CASE WHEN p.email = $email THEN coalesce(p.emailVerified, true) ELSE false END 
+		SET p.email=$email, p.firstName=$firstName, p.lastName=$lastName, p.password=CASE WHEN $password = '' THEN p.password ELSE $password END, p.token=CASE WHEN $token = '' THEN p.token ELSE $token END 
 	`, queryPrefix)
 
 	params := map[string]interface{}{
@@ -351,11 +507,12 @@ func addTeacher(session neo4j.Session, user interface{}, token string) error {
 		"lastName":  professor.LastName,
 		"password":  professor.Password,
 		"token":     token,
+		"pending":   helpers.UserStatusPending,
 	}
 
 	err = helpers.WriteTX(session, query, params)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	query = fmt.Sprintf(`
@@ -367,7 +524,7 @@ func addTeacher(session neo4j.Session, user interface{}, token string) error {
 		"teacherID": teacherID,
 	}
 
-	return helpers.WriteTX(session, query, params)
+	return teacherID, helpers.WriteTX(session, query, params)
 }
 
 func getTeacher(session neo4j.Session, tokenInfo repositories.TokenInfo, token string) (interface{}, error) {
@@ -414,7 +571,7 @@ func getTeacher(session neo4j.Session, tokenInfo repositories.TokenInfo, token s
 
 	query = `
 		MATCH (t:Test)-[c:ADDED_BY]->(p:Teacher)
-		WHERE p.ID = $pID
+		WHERE p.ID = $pID AND NOT coalesce(t.archived, false)
 		RETURN count(c) as nrTests
 	`
 	params = map[string]interface{}{
@@ -451,6 +608,12 @@ func getTeacher(session neo4j.Session, tokenInfo repositories.TokenInfo, token s
 	teacherStats := result.(repositories.Professor)
 	teacher.NrTests = teacherStats.NrTests
 
+	teacher.UnreadNotifications, err = getUnreadNotificationCount(session, tokenInfo)
+	if err != nil {
+		return repositories.Professor{}, err
+	}
+	teacher.EmailVerified = tokenInfo.Verified
+
 	return teacher, nil
 }
 
@@ -504,11 +667,12 @@ func getStudent(session neo4j.Session, tokenInfo repositories.TokenInfo, token s
 
 	query = `
 		MATCH (s:Student)-[c:COMPLETED]->(t:Test) 
-		WHERE s.ID = $sID 
-		RETURN count(c) as nrTestsCompleted, toInteger(avg(c.grade * 1.0 / t.points) * 100) as averageGrade 
+		WHERE s.ID = $sID AND coalesce(t.publication, $published) = $published AND NOT coalesce(t.archived, false) 
+		RETURN count(c) as nrTestsCompleted, toInteger(avg(coalesce(c.correctedGrade, c.grade) * 1.0 / t.points) * 100) as averageGrade 
 	`
 	params = map[string]interface{}{
-		"sID": tokenInfo.ID,
+		"sID":       tokenInfo.ID,
+		"published": helpers.TestPublicationPublished,
 	}
 
 	result, err = session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
@@ -541,6 +705,12 @@ func getStudent(session neo4j.Session, tokenInfo repositories.TokenInfo, token s
 	student.AverageGrade = statsForStudent.AverageGrade
 	student.NrTestsTaken = statsForStudent.NrTestsTaken
 
+	student.UnreadNotifications, err = getUnreadNotificationCount(session, tokenInfo)
+	if err != nil {
+		return repositories.Student{}, err
+	}
+	student.EmailVerified = tokenInfo.Verified
+
 	return student, nil
 }
 
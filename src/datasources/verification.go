@@ -0,0 +1,128 @@
+package datasources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// SendVerificationEmail emails a user who did not verify their address yet another link to do so.
+func SendVerificationEmail(session neo4j.Session, path string, token string, accounts *helpers.AccountMailer) error {
+	tokenInfo, err := GetTokenInfo(session, token)
+	if err != nil {
+		return helpers.InvalidTokenError(path, err)
+	}
+	if tokenInfo.Verified {
+		return fmt.Errorf("email address is already verified")
+	}
+
+	return sendVerification(session, tokenInfo.Label, tokenInfo.ID, accounts)
+}
+
+// VerifyEmail marks the address a verification link was sent to as verified, unless the user changed it since.
+func VerifyEmail(session neo4j.Session, path string, code string, accounts *helpers.AccountMailer) error {
+	subject, err := accounts.VerifyLink(helpers.LinkPurposeVerification, code)
+	if err != nil {
+		return err
+	}
+	fields := strings.SplitN(subject, ":", 3)
+	if len(fields) != 3 || (fields[0] != repositories.StudentLabel && fields[0] != repositories.TeacherLabel) {
+		return fmt.Errorf("link is not valid")
+	}
+	userID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("link is not valid")
+	}
+	params := map[string]interface{}{
+		"userID": userID,
+		"email":  fields[2],
+		"now":    time.Now().Unix(),
+	}
+
+	err = checkExists(session, "account with this email address", fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		WHERE toLower(n.email) = $email 
+		RETURN count(n) AS nr
+	`, fields[0]), params)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (n:%s {ID:$userID}) 
+		SET n.emailVerified = true, n.emailVerifiedAt = $now
+	`, fields[0])
+
+	return helpers.WriteTX(session, query, params)
+}
+
+// sendVerification emails the user a verification link, unless their address is already verified.
+func sendVerification(session neo4j.Session, label string, userID int, accounts *helpers.AccountMailer) error {
+	query := fmt.Sprintf(`
+		MATCH (u:%s {ID:$userID}) 
+		WHERE NOT coalesce(u.emailVerified, true) 
+		RETURN u.email, u.firstName, u.lastName, u.emailMode, u.emailMutedTypes
+	`, label)
+
+	recipients, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []helpers.EmailRecipient
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"userID": userID})
+		if err != nil {
+			return []helpers.EmailRecipient{}, err
+		}
+		for records.Next() {
+			recipient, err := helpers.GetEmailRecipientFromQuery(records.Record(), "u")
+			if err != nil {
+				return []helpers.EmailRecipient{}, err
+			}
+
+			results = append(results, recipient)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients.([]helpers.EmailRecipient) {
+		err = accounts.SendVerification(recipient, fmt.Sprintf("%s:%d:%s", label, userID, strings.ToLower(recipient.Email)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkEmailAvailable makes sure nobody uses the address of a new account yet.
+func checkEmailAvailable(session neo4j.Session, email string) error {
+	return checkEmailAvailableFor(session, email, helpers.EmptyStringParameter, 0)
+}
+
+// checkEmailAvailableFor checks the email address is not used by anyone but the user with the label and ID.
+func checkEmailAvailableFor(session neo4j.Session, email string, label string, userID int) error {
+	nr, err := countNodes(session, `
+		MATCH (n) 
+		WHERE (n:Student OR n:Teacher OR n:Admin) AND toLower(n.email) = toLower($email) 
+			AND NOT (any(l IN labels(n) WHERE l = $label) AND n.ID = $userID) 
+		RETURN count(n) AS nr
+	`, map[string]interface{}{"email": email, "label": label, "userID": userID})
+	if err != nil {
+		return err
+	}
+	if nr > 0 {
+		return fmt.Errorf("email address '%s' is already used", email)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandleGroupObjectives(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, dispatcher *helpers.NotificationDispatcher) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		response, status, err = getGroupObjectives(r, session, path)
+	case http.MethodPost:
+		status, err = setGroupObjective(r, session, path, dispatcher)
+	case http.MethodPut:
+		status, err = updateGroupObjective(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteGroupObjective(r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func getGroupObjectives(r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	state, err := helpers.GetStringParameter(r, repositories.State, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	groupObjectives, err := datasources.GetGroupObjectives(session, path, token, subject, state)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	response, err := json.Marshal(groupObjectives)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func setGroupObjective(r *http.Request, session neo4j.Session, path string, dispatcher *helpers.NotificationDispatcher) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	groupObjective, err := extractGroupObjective(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.AddGroupObjective(session, path, token, groupObjective, dispatcher)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func updateGroupObjective(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	groupObjectiveID, err := helpers.GetIntParameter(r, repositories.ObjectiveID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	groupObjective, err := extractGroupObjective(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.UpdateGroupObjective(session, path, token, groupObjectiveID, groupObjective)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteGroupObjective(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	groupObjectiveID, err := helpers.GetIntParameter(r, repositories.ObjectiveID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteGroupObjective(session, path, token, groupObjectiveID)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func extractGroupObjective(r *http.Request) (repositories.GroupObjective, error) {
+	var unmarshalledGroupObjective repositories.GroupObjective
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledGroupObjective)
+	if err != nil {
+		return repositories.GroupObjective{}, err
+	}
+
+	return unmarshalledGroupObjective, nil
+}
@@ -33,8 +33,12 @@ func HandleObjectives(w http.ResponseWriter, r *http.Request, logger *log.Logger
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getObjectives(r, session, path)
-	case http.MethodPost, http.MethodPut:
+	case http.MethodPost:
 		status, err = setObjective(r, session, path)
+	case http.MethodPut:
+		status, err = updateObjective(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteObjective(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -77,8 +81,12 @@ func getObjectives(r *http.Request, session neo4j.Session, path string) ([]byte,
 	if err != nil {
 		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
+	state, err := helpers.GetStringParameter(r, repositories.State, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
 
-	objective, err := datasources.GetObjectives(session, path, token, subject, searchString)
+	objective, err := datasources.GetObjectives(session, path, token, subject, searchString, state)
 	if err != nil {
 		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
 	}
@@ -100,7 +108,7 @@ func setObjective(r *http.Request, session neo4j.Session, path string) (int, err
 	if err != nil {
 		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
 	}
-	subject, err := helpers.GetStringParameter(r, repositories.Subject, false)
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, true)
 	if err != nil {
 		return http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
@@ -113,6 +121,46 @@ func setObjective(r *http.Request, session neo4j.Session, path string) (int, err
 	return http.StatusOK, nil
 }
 
+func updateObjective(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	objectiveID, err := helpers.GetIntParameter(r, repositories.ObjectiveID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	objective, err := extractObjective(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.UpdateObjective(session, path, token, objectiveID, objective)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteObjective(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	objectiveID, err := helpers.GetIntParameter(r, repositories.ObjectiveID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteObjective(session, path, token, objectiveID)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
 func extractObjective(r *http.Request) (repositories.Objective, error) {
 	var unmarshalledObjective repositories.Objective
 
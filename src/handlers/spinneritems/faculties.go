@@ -2,6 +2,7 @@ package spinneritems
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"log"
 	"net/http"
 
@@ -32,6 +33,12 @@ func HandleFaculties(w http.ResponseWriter, r *http.Request, logger *log.Logger,
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getFaculties(session, path)
+	case http.MethodPost:
+		status, err = addFaculty(r, session, path)
+	case http.MethodPut:
+		status, err = renameFaculty(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteFaculty(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -74,3 +81,77 @@ func getFaculties(session neo4j.Session, path string) ([]byte, int, error) {
 
 	return response, http.StatusOK, nil
 }
+
+func addFaculty(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.AddFaculty(session, path, token, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func renameFaculty(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	faculty, err := helpers.GetStringParameter(r, repositories.Faculty, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.RenameFaculty(session, path, token, faculty, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteFaculty(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	faculty, err := helpers.GetStringParameter(r, repositories.Faculty, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteFaculty(session, path, token, faculty)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func extractItem(r *http.Request) (repositories.Item, error) {
+	var unmarshalledItem repositories.Item
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledItem)
+	if err != nil {
+		return repositories.Item{}, err
+	}
+
+	return unmarshalledItem, nil
+}
@@ -2,6 +2,7 @@ package spinneritems
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"log"
 	"net/http"
 
@@ -32,6 +33,12 @@ func HandleGroups(w http.ResponseWriter, r *http.Request, logger *log.Logger, dr
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getGroups(r, session, path)
+	case http.MethodPost:
+		status, err = addGroup(r, session, path)
+	case http.MethodPut:
+		status, err = updateGroup(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteGroup(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -83,3 +90,77 @@ func getGroups(r *http.Request, session neo4j.Session, path string) ([]byte, int
 
 	return response, http.StatusOK, nil
 }
+
+func addGroup(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	group, err := extractGroup(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.AddGroup(session, path, token, group)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func updateGroup(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	gID, err := helpers.GetIntParameter(r, repositories.GroupID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	group, err := extractGroup(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.UpdateGroup(session, path, token, gID, group)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteGroup(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	gID, err := helpers.GetIntParameter(r, repositories.GroupID, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteGroup(session, path, token, gID)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func extractGroup(r *http.Request) (repositories.Group, error) {
+	var unmarshalledGroup repositories.Group
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return repositories.Group{}, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledGroup)
+	if err != nil {
+		return repositories.Group{}, err
+	}
+
+	return unmarshalledGroup, nil
+}
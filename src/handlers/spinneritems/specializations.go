@@ -32,6 +32,12 @@ func HandleSpecializations(w http.ResponseWriter, r *http.Request, logger *log.L
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getSpecializations(r, session, path)
+	case http.MethodPost:
+		status, err = addSpecialization(r, session, path)
+	case http.MethodPut:
+		status, err = renameSpecialization(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteSpecialization(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -79,3 +85,73 @@ func getSpecializations(r *http.Request, session neo4j.Session, path string) ([]
 
 	return response, http.StatusOK, nil
 }
+
+func addSpecialization(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	faculty, err := helpers.GetStringParameter(r, repositories.Faculty, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.AddSpecialization(session, path, token, faculty, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func renameSpecialization(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	faculty, err := helpers.GetStringParameter(r, repositories.Faculty, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	specialization, err := helpers.GetStringParameter(r, repositories.Specialization, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.RenameSpecialization(session, path, token, faculty, specialization, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteSpecialization(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	faculty, err := helpers.GetStringParameter(r, repositories.Faculty, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	specialization, err := helpers.GetStringParameter(r, repositories.Specialization, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteSpecialization(session, path, token, faculty, specialization)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,84 @@
+package spinneritems
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandleSubjectMerge(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodPost:
+		status, err = mergeSubjects(r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func mergeSubjects(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	into, err := helpers.GetStringParameter(r, repositories.MergeInto, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.MergeSubjects(session, path, token, subject, into)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
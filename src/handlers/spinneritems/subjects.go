@@ -32,6 +32,12 @@ func HandleSubjects(w http.ResponseWriter, r *http.Request, logger *log.Logger,
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getSubjects(r, session, path)
+	case http.MethodPost:
+		status, err = addSubject(r, session, path)
+	case http.MethodPut:
+		status, err = renameSubject(r, session, path)
+	case http.MethodDelete:
+		status, err = deleteSubject(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -85,6 +91,64 @@ func getSubjects(r *http.Request, session neo4j.Session, path string) ([]byte, i
 	return response, http.StatusOK, nil
 }
 
+func addSubject(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.AddSubject(session, path, token, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func renameSubject(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	item, err := extractItem(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	err = datasources.RenameSubject(session, path, token, subject, item.Name)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func deleteSubject(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.DeleteSubject(session, path, token, subject)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
 //func addSubjectsForUser(r *http.Request, driver neo4j.Driver, logger *log.Logger) (int, error) {
 //	student, err := getStudentFromRequestBody(r)
 //	if err != nil {
@@ -12,7 +12,7 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func HandleTestErrors(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+func HandleTestErrors(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) {
 	var response []byte
 	var status int
 	var err error
@@ -31,9 +31,9 @@ func HandleTestErrors(w http.ResponseWriter, r *http.Request, logger *log.Logger
 	case http.MethodOptions:
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodPost:
-		status, err = signalError(r, session, path)
+		status, err = signalError(r, session, path, dispatcher, events)
 	case http.MethodPut:
-		status, err = overwriteGrade(r, session, path)
+		status, err = overwriteGrade(r, session, path, dispatcher, events)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -60,7 +60,7 @@ func HandleTestErrors(w http.ResponseWriter, r *http.Request, logger *log.Logger
 	helpers.PrintStatus(logger, status)
 }
 
-func signalError(r *http.Request, session neo4j.Session, path string) (int, error) {
+func signalError(r *http.Request, session neo4j.Session, path string, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) (int, error) {
 	token, err := helpers.GetToken(r)
 	if err != nil {
 		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
@@ -70,7 +70,7 @@ func signalError(r *http.Request, session neo4j.Session, path string) (int, erro
 		return http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
 
-	err = datasources.SignalErrorForTest(session, path, token, testID)
+	err = datasources.SignalErrorForTest(session, path, token, testID, dispatcher, events)
 	if err != nil {
 		return http.StatusInternalServerError, helpers.GetError(path, err)
 	}
@@ -78,7 +78,7 @@ func signalError(r *http.Request, session neo4j.Session, path string) (int, erro
 	return http.StatusOK, nil
 }
 
-func overwriteGrade(r *http.Request, session neo4j.Session, path string) (int, error) {
+func overwriteGrade(r *http.Request, session neo4j.Session, path string, dispatcher *helpers.NotificationDispatcher, events *helpers.TestEventBroker) (int, error) {
 	token, err := helpers.GetToken(r)
 	if err != nil {
 		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
@@ -96,7 +96,7 @@ func overwriteGrade(r *http.Request, session neo4j.Session, path string) (int, e
 		return http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
 
-	err = datasources.OverwriteGradeForTest(session, path, token, testID, studentID, newGrade)
+	err = datasources.OverwriteGradeForTest(session, path, token, testID, studentID, newGrade, dispatcher, events)
 	if err != nil {
 		return http.StatusInternalServerError, helpers.GetError(path, err)
 	}
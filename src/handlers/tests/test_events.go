@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	keepAliveInterval = 30 * time.Second
+)
+
+// HandleTestEvents streams the grading events of a test as server-sent events. The server write
+// timeout ends long streams, EventSource clients reconnect on their own when that happens.
+func HandleTestEvents(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, events *helpers.TestEventBroker) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		status, err = streamTestEvents(w, r, driver, path, events)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func streamTestEvents(w http.ResponseWriter, r *http.Request, driver neo4j.Driver, path string, events *helpers.TestEventBroker) (int, error) {
+	testID, status, err := checkTestEventsAccess(r, driver, path)
+	if err != nil {
+		return status, err
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("%s: streaming is not supported", path)
+	}
+
+	testEvents, unsubscribe := events.Subscribe(testID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return http.StatusOK, nil
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-testEvents:
+			err = writeTestEvent(w, event)
+		}
+		if err != nil {
+			// The client went away, there is nobody left to report the error to.
+			return http.StatusOK, nil
+		}
+		flusher.Flush()
+	}
+}
+
+// checkTestEventsAccess makes sure the teacher wrote the test whose events they ask for. The session is
+// closed before streaming starts, so open streams do not keep connections of the driver to themselves.
+func checkTestEventsAccess(r *http.Request, driver neo4j.Driver, path string) (int, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return 0, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	testID, err := helpers.GetIntParameter(r, repositories.TestID, true)
+	if err != nil {
+		return 0, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	defer session.Close()
+
+	err = datasources.CheckTestAuthor(session, path, token, testID)
+	if err != nil {
+		return 0, http.StatusForbidden, helpers.GetError(path, err)
+	}
+
+	return testID, http.StatusOK, nil
+}
+
+func writeTestEvent(w http.ResponseWriter, event repositories.TestEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+	return err
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandleTestExport(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		response, status, err = exportGradebook(w, r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+// exportGradebook exports the submissions of a single test, or of every test of a subject when no test is given.
+func exportGradebook(w http.ResponseWriter, r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	testID, err := helpers.GetIntParameter(r, repositories.TestID, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	subject, err := helpers.GetStringParameter(r, repositories.Subject, testID == helpers.EmptyIntParameter)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	format, err := helpers.GetStringParameter(r, repositories.Format, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	if format == helpers.EmptyStringParameter {
+		format = helpers.GradebookFormatCSV
+	}
+	format = strings.ToLower(format)
+	if err = helpers.ValidateGradebookFormat(format); err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	var gradebook []byte
+	var filename string
+	if testID != helpers.EmptyIntParameter {
+		gradebook, err = datasources.ExportTestGradebook(session, path, token, testID, format)
+		filename = fmt.Sprintf("test_%d_grades.%s", testID, format)
+	} else {
+		gradebook, err = datasources.ExportSubjectGradebook(session, path, token, subject, format)
+		filename = fmt.Sprintf("%s_grades.%s", getFilenameSafe(subject), format)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	w.Header().Set("Content-Type", helpers.GradebookContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
+	return gradebook, http.StatusOK, nil
+}
+
+func getFilenameSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
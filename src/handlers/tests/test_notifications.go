@@ -32,6 +32,8 @@ func HandleTestNotifications(w http.ResponseWriter, r *http.Request, logger *log
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getNotifications(r, session, path)
+	case http.MethodPut:
+		status, err = markNotificationsRead(r, session, path)
 	default:
 		status = http.StatusBadRequest
 		err = helpers.WrongMethodError(path)
@@ -66,16 +68,47 @@ func getNotifications(r *http.Request, session neo4j.Session, path string) ([]by
 	if err != nil {
 		return []byte{}, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
 	}
+	unreadOnly, err := helpers.GetBoolParameter(r, repositories.UnreadOnly, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
 
-	notificationTests, err := datasources.GetNotificationTests(session, path, token)
+	notifications, err := datasources.GetNotifications(session, path, token, unreadOnly)
 	if err != nil {
 		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
 	}
 
-	response, err := json.Marshal(notificationTests)
+	response, err := json.Marshal(notifications)
 	if err != nil {
 		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
 	}
 
 	return response, http.StatusOK, nil
 }
+
+func markNotificationsRead(r *http.Request, session neo4j.Session, path string) (int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	all, err := helpers.GetBoolParameter(r, repositories.All, false)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	if all {
+		err = datasources.MarkAllNotificationsRead(session, path, token)
+	} else {
+		notificationID, paramErr := helpers.GetIntParameter(r, repositories.NotificationID, true)
+		if paramErr != nil {
+			return http.StatusBadRequest, helpers.BadParameterError(path, paramErr)
+		}
+
+		err = datasources.MarkNotificationRead(session, path, token, notificationID)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
@@ -14,7 +14,7 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func HandleTests(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, s3Bucket string, s3Region string, s3Profile string) {
+func HandleTests(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, renderer *helpers.TemplateRenderer) {
 	var response []byte
 	var status int
 	var err error
@@ -35,7 +35,7 @@ func HandleTests(w http.ResponseWriter, r *http.Request, logger *log.Logger, dri
 	case http.MethodGet:
 		response, status, err = getTests(r, session, path)
 	case http.MethodPost, http.MethodPut:
-		response, status, err = addTest(r, session, path, s3Bucket, s3Region, s3Profile, logger)
+		response, status, err = addTest(r, session, path, renderer)
 	case http.MethodDelete:
 		status, err = deleteTest(r, session, path)
 	default:
@@ -101,7 +101,7 @@ func getTests(r *http.Request, session neo4j.Session, path string) ([]byte, int,
 	return response, http.StatusOK, nil
 }
 
-func addTest(r *http.Request, session neo4j.Session, path string, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) ([]byte, int, error) {
+func addTest(r *http.Request, session neo4j.Session, path string, renderer *helpers.TemplateRenderer) ([]byte, int, error) {
 	token, err := helpers.GetToken(r)
 	if err != nil {
 		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
@@ -111,7 +111,7 @@ func addTest(r *http.Request, session neo4j.Session, path string, s3Bucket strin
 		return nil, http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
 	}
 
-	testID, err := datasources.AddTest(session, path, token, test, s3Bucket, s3Region, s3Profile, logger)
+	testID, err := datasources.AddTest(session, path, token, test, renderer)
 	if err != nil {
 		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
 	}
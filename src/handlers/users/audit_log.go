@@ -0,0 +1,119 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandleAuditLog(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		response, status, err = getAuditLog(r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func getAuditLog(r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	filter, err := extractAuditFilter(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	entries, err := datasources.GetAuditLog(session, path, token, filter)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
+	}
+
+	response, err := json.Marshal(entries)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func extractAuditFilter(r *http.Request) (repositories.AuditFilter, error) {
+	var filter repositories.AuditFilter
+	var err error
+
+	filter.ActorType, err = helpers.GetStringParameter(r, repositories.ActorType, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+	filter.ActorType = strings.ToUpper(filter.ActorType)
+	filter.ActorID, err = helpers.GetIntParameter(r, repositories.ActorID, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+	filter.EntityType, err = helpers.GetStringParameter(r, repositories.EntityType, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+	filter.EntityID, err = helpers.GetIntParameter(r, repositories.EntityID, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+	filter.From, err = helpers.GetIntParameter(r, repositories.From, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+	filter.To, err = helpers.GetIntParameter(r, repositories.To, false)
+	if err != nil {
+		return repositories.AuditFilter{}, err
+	}
+
+	return filter, nil
+}
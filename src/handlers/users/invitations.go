@@ -0,0 +1,127 @@
+package users
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandleInvitations(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, accounts *helpers.AccountMailer) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		response, status, err = getInvitation(r, session, path, accounts)
+	case http.MethodPost:
+		response, status, err = inviteStudents(r, session, path, accounts)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func getInvitation(r *http.Request, session neo4j.Session, path string, accounts *helpers.AccountMailer) ([]byte, int, error) {
+	code, err := helpers.GetStringParameter(r, repositories.Code, true)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	invitation, err := datasources.GetInvitation(session, path, code, accounts)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.GetError(path, err)
+	}
+
+	response, err := json.Marshal(invitation)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func inviteStudents(r *http.Request, session neo4j.Session, path string, accounts *helpers.AccountMailer) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	gID, err := helpers.GetIntParameter(r, repositories.GroupID, true)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	emails, err := extractEmails(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+
+	reports, err := datasources.InviteStudents(session, path, token, gID, emails, accounts)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	response, err := json.Marshal(reports)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func extractEmails(r *http.Request) ([]string, error) {
+	var unmarshalledEmails []string
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(body, &unmarshalledEmails)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalledEmails, nil
+}
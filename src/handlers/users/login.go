@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 
@@ -13,7 +14,7 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func HandleLogin(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+func HandleLogin(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, limiter *helpers.LoginLimiter) {
 	var response []byte
 	var status int
 	var err error
@@ -32,7 +33,7 @@ func HandleLogin(w http.ResponseWriter, r *http.Request, logger *log.Logger, dri
 	case http.MethodOptions:
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodPost:
-		response, status, err = logIn(r, session, path)
+		response, status, err = logIn(w, r, session, path, limiter)
 	case http.MethodPut:
 		status, err = validateToken(r, session, path)
 	case http.MethodDelete:
@@ -66,15 +67,43 @@ func HandleLogin(w http.ResponseWriter, r *http.Request, logger *log.Logger, dri
 	helpers.PrintStatus(logger, status)
 }
 
-func logIn(r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+// logIn answers every failed login the same way and locks out addresses and accounts guessing passwords.
+// Why a login failed is only recorded for administrators.
+func logIn(w http.ResponseWriter, r *http.Request, session neo4j.Session, path string, limiter *helpers.LoginLimiter) ([]byte, int, error) {
 	user, err := extractUser(r)
 	if err != nil {
-		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
+		return nil, http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+	ip := helpers.GetClientIP(r)
+
+	wait, firstLocked := limiter.Check(ip, user.Email)
+	if wait > 0 {
+		// a locked out client may keep trying, only its first attempt of every lockout is recorded
+		if firstLocked {
+			err = datasources.RecordFailedLogin(session, user.Email, ip, "locked out", true)
+			if err != nil {
+				return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+			}
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+
+		return nil, http.StatusTooManyRequests, helpers.LoginLockedError(path, wait)
 	}
 
 	completeUser, err := datasources.GetUserByEmailAndPassword(session, path, user.Email, user.Password)
 	if err != nil {
-		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
+		limiter.Fail(ip, user.Email)
+		err = datasources.RecordFailedLogin(session, user.Email, ip, err.Error(), false)
+		if err != nil {
+			return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+		}
+
+		return nil, http.StatusUnauthorized, helpers.LoginFailedError(path)
+	}
+	limiter.Succeed(user.Email)
+	err = datasources.RecordLogin(session, user.Email, ip, helpers.LoginMethodPassword)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
 	}
 
 	response, err := json.Marshal(completeUser)
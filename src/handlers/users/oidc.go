@@ -0,0 +1,153 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+// HandleOIDCLogin sends the browser to the identity provider of the university, which sends it back to
+// HandleOIDCCallback.
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request, logger *log.Logger, path string, oidc *helpers.OIDCClient) {
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		status, err = startOIDCLogin(w, r, path, oidc)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	helpers.PrintStatus(logger, status)
+}
+
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, oidc *helpers.OIDCClient) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		response, status, err = finishOIDCLogin(w, r, session, path, oidc)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func startOIDCLogin(w http.ResponseWriter, r *http.Request, path string, oidc *helpers.OIDCClient) (int, error) {
+	if oidc == nil {
+		return http.StatusNotFound, helpers.GetError(path, fmt.Errorf("single sign-on is not configured"))
+	}
+
+	authURL, nonce, err := oidc.AuthURL()
+	if err != nil {
+		return http.StatusBadGateway, helpers.GetError(path, err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     helpers.OIDCStateCookie,
+		Value:    nonce,
+		Path:     "/users/oidc",
+		MaxAge:   int(helpers.OIDCLoginValidity.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+
+	return http.StatusFound, nil
+}
+
+func finishOIDCLogin(w http.ResponseWriter, r *http.Request, session neo4j.Session, path string, oidc *helpers.OIDCClient) ([]byte, int, error) {
+	if oidc == nil {
+		return nil, http.StatusNotFound, helpers.GetError(path, fmt.Errorf("single sign-on is not configured"))
+	}
+	code, err := helpers.GetStringParameter(r, repositories.Code, true)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	state, err := helpers.GetStringParameter(r, repositories.State, true)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	cookie, err := r.Cookie(helpers.OIDCStateCookie)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, fmt.Errorf("login was not started in this browser"))
+	}
+	http.SetCookie(w, &http.Cookie{Name: helpers.OIDCStateCookie, Path: "/users/oidc", MaxAge: -1})
+
+	identity, err := oidc.Exchange(code, state, cookie.Value)
+	if err != nil {
+		return nil, http.StatusUnauthorized, helpers.InvalidTokenError(path, err)
+	}
+
+	completeUser, err := datasources.GetUserByOIDCIdentity(session, path, identity)
+	if err != nil {
+		return nil, http.StatusUnauthorized, helpers.GetError(path, err)
+	}
+	err = datasources.RecordLogin(session, identity.Email, helpers.GetClientIP(r), helpers.LoginMethodOIDC)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	response, err := json.Marshal(completeUser)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+func HandlePasswordReset(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, accounts *helpers.AccountMailer) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodGet:
+		status, err = checkPasswordReset(r, session, path)
+	case http.MethodPost:
+		status, err = requestPasswordReset(r, session, path, accounts)
+	case http.MethodPut:
+		status, err = confirmPasswordReset(r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+func requestPasswordReset(r *http.Request, session neo4j.Session, path string, accounts *helpers.AccountMailer) (int, error) {
+	email, err := helpers.GetStringParameter(r, repositories.Email, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.RequestPasswordReset(session, path, email, accounts)
+	if err != nil {
+		return http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func checkPasswordReset(r *http.Request, session neo4j.Session, path string) (int, error) {
+	code, err := helpers.GetStringParameter(r, repositories.Code, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.CheckPasswordReset(session, path, code)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func confirmPasswordReset(r *http.Request, session neo4j.Session, path string) (int, error) {
+	code, err := helpers.GetStringParameter(r, repositories.Code, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	newPassword, err := helpers.GetStringParameter(r, repositories.NewPassword, true)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	err = datasources.ResetPassword(session, path, code, newPassword)
+	if err != nil {
+		return http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	return http.StatusOK, nil
+}
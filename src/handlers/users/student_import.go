@@ -0,0 +1,111 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/datasources"
+	helpers "qbot_webserver/src/helpers"
+	"qbot_webserver/src/repositories"
+)
+
+const maxImportSize = 10 << 20
+
+func HandleStudentImport(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+	var response []byte
+	var status int
+	var err error
+
+	helpers.SetContentType(w)
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+	defer session.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		helpers.SetAccessControlHeaders(w)
+	case http.MethodPost:
+		response, status, err = importStudents(w, r, session, path)
+	default:
+		status = http.StatusBadRequest
+		err = helpers.WrongMethodError(path)
+	}
+
+	if err != nil {
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	if response == nil {
+		response, _ = json.Marshal(repositories.ResponseItem{Message: helpers.Success})
+	}
+
+	_, err = w.Write(response)
+	if err != nil {
+		status = http.StatusInternalServerError
+		helpers.PrintError(logger, err, status)
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	status = http.StatusOK
+	helpers.PrintStatus(logger, status)
+}
+
+// importStudents reads the class list from the request body, which holds the CSV or XLSX file itself.
+func importStudents(w http.ResponseWriter, r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	format, err := helpers.GetStringParameter(r, repositories.Format, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	if format == helpers.EmptyStringParameter {
+		format = helpers.ImportFormatCSV
+	}
+	format = strings.ToLower(format)
+	if err = helpers.ValidateImportFormat(format); err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	dryRun, err := helpers.GetBoolParameter(r, repositories.DryRun, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, err)
+	}
+	rows, err := helpers.ReadImportRows(body, format)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.CouldNotExtractBodyError(path, fmt.Errorf("could not read %s file: %s", format, err.Error()))
+	}
+
+	report, err := datasources.ImportStudents(session, path, token, rows, dryRun)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -14,7 +14,7 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func HandleUsers(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string) {
+func HandleUsers(w http.ResponseWriter, r *http.Request, logger *log.Logger, driver neo4j.Driver, path string, accounts *helpers.AccountMailer) {
 	var response []byte
 	var status int
 	var err error
@@ -34,8 +34,10 @@ func HandleUsers(w http.ResponseWriter, r *http.Request, logger *log.Logger, dri
 		helpers.SetAccessControlHeaders(w)
 	case http.MethodGet:
 		response, status, err = getUser(r, session, path)
-	case http.MethodPost, http.MethodPut:
-		response, status, err = signUp(r, session, path)
+	case http.MethodPost:
+		response, status, err = signUp(r, session, path, accounts)
+	case http.MethodPut:
+		response, status, err = updateUser(r, session, path, accounts)
 	case http.MethodDelete:
 		status, err = deleteUser(r, session, path)
 	default:
@@ -100,12 +102,16 @@ func deleteUser(r *http.Request, session neo4j.Session, path string) (int, error
 	return http.StatusOK, nil
 }
 
-func signUp(r *http.Request, session neo4j.Session, path string) ([]byte, int, error) {
+func signUp(r *http.Request, session neo4j.Session, path string, accounts *helpers.AccountMailer) ([]byte, int, error) {
 	userType, err := helpers.GetStringParameter(r, repositories.UserType, true)
 	if err != nil {
 		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
 	userType = strings.ToUpper(userType)
+	invitationCode, err := helpers.GetStringParameter(r, repositories.InvitationCode, false)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
 	var user interface{}
 
 	if userType == repositories.StudentType {
@@ -117,7 +123,7 @@ func signUp(r *http.Request, session neo4j.Session, path string) ([]byte, int, e
 		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
 	}
 
-	tokenItem, err := datasources.AddUser(session, userType, user)
+	tokenItem, err := datasources.AddUser(session, userType, user, invitationCode, accounts)
 	if err != nil {
 		return nil, http.StatusInternalServerError, helpers.GetError(path, err)
 	}
@@ -130,6 +136,40 @@ func signUp(r *http.Request, session neo4j.Session, path string) ([]byte, int, e
 	return response, http.StatusOK, nil
 }
 
+func updateUser(r *http.Request, session neo4j.Session, path string, accounts *helpers.AccountMailer) ([]byte, int, error) {
+	token, err := helpers.GetToken(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.InvalidTokenError(path, err)
+	}
+	userType, err := helpers.GetStringParameter(r, repositories.UserType, true)
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+	userType = strings.ToUpper(userType)
+	var user interface{}
+
+	if userType == repositories.StudentType {
+		user, err = extractStudent(r)
+	} else {
+		user, err = extractTeacher(r)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, helpers.BadParameterError(path, err)
+	}
+
+	tokenItem, err := datasources.UpdateUser(session, path, token, userType, user, accounts)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.AddError(path, err)
+	}
+
+	response, err := json.Marshal(tokenItem)
+	if err != nil {
+		return nil, http.StatusInternalServerError, helpers.MarshalError(path, err)
+	}
+
+	return response, http.StatusOK, nil
+}
+
 func extractStudent(r *http.Request) (repositories.Student, error) {
 	var unmarshalledStudent repositories.Student
 
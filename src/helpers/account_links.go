@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	cryptoRand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LinkPurposeVerification = "verify"
+	LinkPurposeInvitation   = "invite"
+
+	VerificationLinkValidity = 48 * time.Hour
+	InvitationLinkValidity   = 14 * 24 * time.Hour
+	PasswordResetValidity    = time.Hour
+
+	linkSecretLength        = 32
+	linkSeparator           = "|"
+	passwordResetCodeLength = 32
+)
+
+// SignLink returns the code of a link which proves the server issued it for the purpose and subject until
+// it expires. The subject is readable, so it must not hold anything secret.
+func SignLink(secret []byte, purpose string, subject string, expiresAt time.Time) string {
+	payload := strings.Join([]string{purpose, strconv.FormatInt(expiresAt.Unix(), 10), subject}, linkSeparator)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(signLinkPayload(secret, payload))
+}
+
+// VerifyLink checks the code of a link made by SignLink for the purpose and returns its subject.
+func VerifyLink(secret []byte, purpose string, code string, now time.Time) (string, error) {
+	invalidErr := fmt.Errorf("link is not valid")
+
+	parts := strings.Split(code, ".")
+	if len(parts) != 2 {
+		return EmptyStringParameter, invalidErr
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return EmptyStringParameter, invalidErr
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signLinkPayload(secret, string(payload))) {
+		return EmptyStringParameter, invalidErr
+	}
+
+	fields := strings.SplitN(string(payload), linkSeparator, 3)
+	if len(fields) != 3 || fields[0] != purpose {
+		return EmptyStringParameter, invalidErr
+	}
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return EmptyStringParameter, invalidErr
+	}
+	if now.Unix() > expiresAt {
+		return EmptyStringParameter, fmt.Errorf("link has expired")
+	}
+
+	return fields[2], nil
+}
+
+// NewPasswordResetCode makes up the random code of a password reset link. Unlike signed links it can only
+// be used once, so the server keeps HashPasswordResetCode of it until it is used or expires.
+func NewPasswordResetCode() (string, error) {
+	return newRandomCode(passwordResetCodeLength)
+}
+
+func HashPasswordResetCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func newRandomCode(length int) (string, error) {
+	code := make([]byte, length)
+	_, err := cryptoRand.Read(code)
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(code), nil
+}
+
+func signLinkPayload(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	return mac.Sum(nil)
+}
+
+// AccountMailer emails the links users follow to verify their email address, to accept an invitation or
+// to reset a forgotten password.
+// Like the notification dispatcher, it sends the messages in the background.
+type AccountMailer struct {
+	mailer  MailSender
+	secret  []byte
+	baseURL string
+	logger  *log.Logger
+}
+
+// NewAccountMailer signs links with the given secret. Without one it makes up a secret, so links sent
+// before a restart stop working.
+func NewAccountMailer(mailer MailSender, secret string, baseURL string, logger *log.Logger) *AccountMailer {
+	key := []byte(secret)
+	if secret == EmptyStringParameter {
+		logger.Println("no link secret configured, links will not survive a restart")
+		key = make([]byte, linkSecretLength)
+		_, err := cryptoRand.Read(key)
+		if err != nil {
+			logger.Println(fmt.Sprintf("could not make up a link secret: %s", err))
+		}
+	}
+
+	return &AccountMailer{
+		mailer:  mailer,
+		secret:  key,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		logger:  logger,
+	}
+}
+
+func (am *AccountMailer) VerifyLink(purpose string, code string) (string, error) {
+	return VerifyLink(am.secret, purpose, code, time.Now())
+}
+
+// SendVerification emails the recipient a link confirming they own their address. The subject identifies
+// the account together with the address, so the link stops working when the address changes.
+func (am *AccountMailer) SendVerification(recipient EmailRecipient, subject string) error {
+	link := am.getLink("/users/verify", LinkPurposeVerification, subject, VerificationLinkValidity)
+	message, err := RenderVerificationEmail(recipient, link)
+	if err != nil {
+		return err
+	}
+
+	go am.send(message)
+
+	return nil
+}
+
+// SendInvitation emails a student the link to create the account a teacher added them with.
+func (am *AccountMailer) SendInvitation(invitation InvitationEmail, subject string) error {
+	invitation.Link = am.getLink("/users/invitations", LinkPurposeInvitation, subject, InvitationLinkValidity)
+	message, err := RenderInvitationEmail(invitation)
+	if err != nil {
+		return err
+	}
+
+	go am.send(message)
+
+	return nil
+}
+
+// SendPasswordReset emails the recipient the link to choose a new password with the reset code.
+func (am *AccountMailer) SendPasswordReset(recipient EmailRecipient, code string) error {
+	link := fmt.Sprintf("%s/users/passwordReset?code=%s", am.baseURL, url.QueryEscape(code))
+	message, err := RenderPasswordResetEmail(recipient, link)
+	if err != nil {
+		return err
+	}
+
+	go am.send(message)
+
+	return nil
+}
+
+func (am *AccountMailer) getLink(path string, purpose string, subject string, validity time.Duration) string {
+	code := SignLink(am.secret, purpose, subject, time.Now().Add(validity))
+
+	return fmt.Sprintf("%s%s?code=%s", am.baseURL, path, url.QueryEscape(code))
+}
+
+func (am *AccountMailer) send(message MailMessage) {
+	err := am.mailer.Send(message)
+	if err != nil {
+		am.logger.Printf("could not email '%s' to %s: %s", message.Subject, message.To, err.Error())
+	}
+}
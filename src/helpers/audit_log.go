@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	AuditActionGradeChange     = "gradeChange"
+	AuditActionAnswerKeyChange = "answerKeyChange"
+	AuditActionTestDeletion    = "testDeletion"
+	AuditActionTestRestore     = "testRestore"
+	AuditActionUserDeletion    = "userDeletion"
+	AuditActionUserRestore     = "userRestore"
+	AuditActionLogin           = "login"
+
+	AuditEntityTest = "test"
+	AuditEntityUser = "user"
+
+	LoginMethodPassword = "password"
+	LoginMethodOIDC     = "oidc"
+)
+
+func IsAuditEntityType(entityType string) bool {
+	return entityType == AuditEntityTest || entityType == AuditEntityUser
+}
+
+// CreateAuditEntry appends an entry for the actor a, the actor type actorType and the entity ID entityID the
+// match binds. It runs in the transaction of the change it is about, so the log has every change and only the
+// ones which happened. Entries copy what they need to know about the actor instead of pointing to it, so they
+// outlive the users and tests they are about. Nothing ever changes or removes them.
+func CreateAuditEntry(tx neo4j.Transaction, match string, params map[string]interface{}, entry repositories.AuditEntry) error {
+	query := fmt.Sprintf(`
+		%s 
+		CREATE (e:AuditEntry {action:$action, actorType:actorType, actorID:a.ID, actorEmail:a.email, 
+			entityType:$entityType, entityID:entityID, studentID:$studentID, before:$before, after:$after, 
+			details:$details, createdAt:$now})
+	`, match)
+	auditParams := map[string]interface{}{
+		"action":     entry.Action,
+		"entityType": entry.EntityType,
+		"studentID":  entry.StudentID,
+		"before":     entry.Before,
+		"after":      entry.After,
+		"details":    entry.Details,
+		"now":        time.Now().Unix(),
+	}
+	for key, value := range params {
+		auditParams[key] = value
+	}
+
+	fmt.Printf("query: %s\nparams: %+v\n", query, auditParams)
+
+	result, err := tx.Run(query, auditParams)
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume()
+
+	return err
+}
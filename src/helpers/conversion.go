@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
 )
 
 func GetAnswerMapFromQuery(record neo4j.Record, key string, shouldCheck bool, mandatory bool) (map[int][]string, error) {
@@ -53,6 +55,91 @@ func GetStringFromAnswerMap(answers map[int][]string) (string, error) {
 	return string(stringAnswers), nil
 }
 
+func GetLayoutFromQuery(record neo4j.Record, key string, shouldCheck bool, mandatory bool) (repositories.TemplateLayout, error) {
+	stringLayout, err := GetStringParameterFromQuery(record, key, shouldCheck, mandatory)
+	if err != nil {
+		return repositories.TemplateLayout{}, err
+	}
+	if stringLayout == "" {
+		return repositories.TemplateLayout{}, nil
+	}
+
+	var layout repositories.TemplateLayout
+	err = json.Unmarshal([]byte(stringLayout), &layout)
+	if err != nil {
+		return repositories.TemplateLayout{}, err
+	}
+
+	return layout, nil
+}
+
+func GetStringFromLayout(layout repositories.TemplateLayout) (string, error) {
+	if len(layout.Cells) == 0 {
+		return "", nil
+	}
+
+	stringLayout, err := json.Marshal(layout)
+	if err != nil {
+		return "", err
+	}
+
+	return string(stringLayout), nil
+}
+
+func GetTemplateFilesFromQuery(record neo4j.Record, key string, shouldCheck bool, mandatory bool) ([]repositories.TemplateFile, error) {
+	stringFiles, err := GetStringParameterFromQuery(record, key, shouldCheck, mandatory)
+	if err != nil {
+		return []repositories.TemplateFile{}, err
+	}
+	if stringFiles == "" {
+		return []repositories.TemplateFile{}, nil
+	}
+
+	var files []repositories.TemplateFile
+	err = json.Unmarshal([]byte(stringFiles), &files)
+	if err != nil {
+		return []repositories.TemplateFile{}, err
+	}
+
+	return files, nil
+}
+
+func GetStringFromTemplateFiles(files []repositories.TemplateFile) (string, error) {
+	stringFiles, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+
+	return string(stringFiles), nil
+}
+
+func GetTemplateStyleFromQuery(record neo4j.Record, key string, shouldCheck bool, mandatory bool) (repositories.TemplateStyle, error) {
+	stringStyle, err := GetStringParameterFromQuery(record, key, shouldCheck, mandatory)
+	if err != nil {
+		return repositories.TemplateStyle{}, err
+	}
+	if stringStyle == "" {
+		return repositories.TemplateStyle{}, nil
+	}
+
+	var style repositories.TemplateStyle
+	err = json.Unmarshal([]byte(stringStyle), &style)
+	if err != nil {
+		return repositories.TemplateStyle{}, err
+	}
+
+	return style, nil
+}
+
+func GetStringFromTemplateStyle(style repositories.TemplateStyle) (string, error) {
+	stringStyle, err := json.Marshal(style)
+	if err != nil {
+		return "", err
+	}
+
+	return string(stringStyle), nil
+}
+
 func GetStringSliceFromInterfaceSlice(slice []interface{}) []string {
 	var stringSlice []string
 	for _, param := range slice {
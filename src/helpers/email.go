@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	EmailModeImmediate = "immediate"
+	EmailModeDigest    = "digest"
+	EmailModeOff       = "off"
+)
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type MailSender interface {
+	Send(message MailMessage) error
+}
+
+type EmailRecipient struct {
+	Email       string
+	FirstName   string
+	LastName    string
+	Preferences repositories.EmailPreferences
+}
+
+// SMTPMailSender delivers messages through an SMTP server. Without a username it does not
+// authenticate, which is what a local stand-in server expects.
+type SMTPMailSender struct {
+	Address  string
+	Username string
+	Password string
+	Host     string
+	From     string
+}
+
+func NewSMTPMailSender(host string, port int, username string, password string, from string) *SMTPMailSender {
+	return &SMTPMailSender{
+		Address:  fmt.Sprintf("%s:%d", host, port),
+		Username: username,
+		Password: password,
+		Host:     host,
+		From:     from,
+	}
+}
+
+func (s *SMTPMailSender) Send(message MailMessage) error {
+	body, err := buildMimeMessage(s.From, message)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != EmptyStringParameter {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(s.Address, auth, s.From, []string{message.To}, body)
+}
+
+// LogMailSender only logs the messages it is given, for running the server without an SMTP server.
+type LogMailSender struct {
+	Logger *log.Logger
+}
+
+func (s *LogMailSender) Send(message MailMessage) error {
+	s.Logger.Printf("email to %s: %s\n%s", message.To, message.Subject, message.Text)
+
+	return nil
+}
+
+func ValidateEmailPreferences(preferences repositories.EmailPreferences) error {
+	switch preferences.Mode {
+	case EmailModeImmediate, EmailModeDigest, EmailModeOff:
+	default:
+		return fmt.Errorf("unknown email mode '%s'", preferences.Mode)
+	}
+
+	for _, notificationType := range preferences.MutedTypes {
+		switch notificationType {
+		case NotificationTypeTestGraded, NotificationTypeTestCorrection, NotificationTypeGradingError,
+			NotificationTypeGradesPublished, NotificationTypeObjectiveStatus, NotificationTypeObjectiveAssigned:
+		default:
+			return fmt.Errorf("unknown notification type '%s'", notificationType)
+		}
+	}
+
+	return nil
+}
+
+// WantsEmail tells whether a notification of the given type should be emailed in the given mode.
+// Users that never saved their preferences get every notification right away.
+func WantsEmail(preferences repositories.EmailPreferences, mode string, notificationType string) bool {
+	preferredMode := preferences.Mode
+	if preferredMode == EmptyStringParameter {
+		preferredMode = EmailModeImmediate
+	}
+	if preferredMode != mode {
+		return false
+	}
+
+	for _, mutedType := range preferences.MutedTypes {
+		if mutedType == notificationType {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (nd *NotificationDispatcher) mail(recipients []EmailRecipient, notification repositories.Notification) {
+	for _, recipient := range recipients {
+		if !WantsEmail(recipient.Preferences, EmailModeImmediate, notification.Type) {
+			continue
+		}
+
+		message, err := RenderNotificationEmail(recipient, notification)
+		if err == nil {
+			err = nd.mailer.Send(message)
+		}
+		if err != nil {
+			nd.logger.Printf("could not email '%s' to %s: %s", notification.Type, recipient.Email, err.Error())
+		}
+	}
+}
+
+func getEmailRecipients(session neo4j.Session, recipientQuery string, params map[string]interface{}) ([]EmailRecipient, error) {
+	query := fmt.Sprintf(`
+		%s 
+		WITH DISTINCT u 
+		WHERE NOT coalesce(u.archived, false) 
+		RETURN u.email, u.firstName, u.lastName, u.emailMode, u.emailMutedTypes
+	`, recipientQuery)
+
+	recipients, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []EmailRecipient
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []EmailRecipient{}, err
+		}
+		for records.Next() {
+			recipient, err := GetEmailRecipientFromQuery(records.Record(), "u")
+			if err != nil {
+				return []EmailRecipient{}, err
+			}
+
+			results = append(results, recipient)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []EmailRecipient{}, err
+	}
+
+	return recipients.([]EmailRecipient), nil
+}
+
+// GetEmailRecipientFromQuery reads the email, name and preferences of the user bound to nodeName.
+func GetEmailRecipientFromQuery(record neo4j.Record, nodeName string) (EmailRecipient, error) {
+	email, err := GetStringParameterFromQuery(record, fmt.Sprintf("%s.email", nodeName), true, true)
+	if err != nil {
+		return EmailRecipient{}, err
+	}
+	firstName, err := GetStringParameterFromQuery(record, fmt.Sprintf("%s.firstName", nodeName), true, false)
+	if err != nil {
+		return EmailRecipient{}, err
+	}
+	lastName, err := GetStringParameterFromQuery(record, fmt.Sprintf("%s.lastName", nodeName), true, false)
+	if err != nil {
+		return EmailRecipient{}, err
+	}
+	preferences, err := GetEmailPreferencesFromQuery(record, nodeName)
+	if err != nil {
+		return EmailRecipient{}, err
+	}
+
+	return EmailRecipient{
+		Email:       email,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Preferences: preferences,
+	}, nil
+}
+
+func GetEmailPreferencesFromQuery(record neo4j.Record, nodeName string) (repositories.EmailPreferences, error) {
+	mode, err := GetStringParameterFromQuery(record, fmt.Sprintf("%s.emailMode", nodeName), true, false)
+	if err != nil {
+		return repositories.EmailPreferences{}, err
+	}
+	if mode == EmptyStringParameter {
+		mode = EmailModeImmediate
+	}
+
+	mutedTypes := []string{}
+	value, ok := record.Get(fmt.Sprintf("%s.emailMutedTypes", nodeName))
+	if ok && value != nil {
+		mutedTypes = append(mutedTypes, GetStringSliceFromInterfaceSlice(value.([]interface{}))...)
+	}
+
+	return repositories.EmailPreferences{
+		Mode:       mode,
+		MutedTypes: mutedTypes,
+	}, nil
+}
+
+func buildMimeMessage(from string, message MailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	}
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		_, err = partWriter.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var mimeMessage bytes.Buffer
+	fmt.Fprintf(&mimeMessage, "From: %s\r\n", from)
+	fmt.Fprintf(&mimeMessage, "To: %s\r\n", message.To)
+	fmt.Fprintf(&mimeMessage, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&mimeMessage, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&mimeMessage, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	mimeMessage.Write(body.Bytes())
+
+	return mimeMessage.Bytes(), nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
+)
+
+// EmailDigest sends, once a day at the given hour, one email per user that opted for the digest with
+// every notification not sent in a digest yet, so none is lost when a digest could not be sent.
+type EmailDigest struct {
+	driver neo4j.Driver
+	mailer MailSender
+	hour   int
+	logger *log.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewEmailDigest(driver neo4j.Driver, mailer MailSender, hour int, logger *log.Logger) *EmailDigest {
+	digest := &EmailDigest{
+		driver: driver,
+		mailer: mailer,
+		hour:   hour,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+
+	digest.wg.Add(1)
+	go digest.run()
+
+	return digest
+}
+
+func (ed *EmailDigest) Close() {
+	close(ed.stop)
+	ed.wg.Wait()
+}
+
+func (ed *EmailDigest) run() {
+	defer ed.wg.Done()
+
+	for {
+		timer := time.NewTimer(time.Until(getNextDigestTime(time.Now(), ed.hour)))
+		select {
+		case <-ed.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			err := ed.Send()
+			if err != nil {
+				ed.logger.Printf("could not send email digests: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Send emails the pending digests right away.
+func (ed *EmailDigest) Send() error {
+	session, err := GetNeo4jSession(ed.driver)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	digests, err := getPendingDigests(session)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range digests {
+		message, err := RenderDigestEmail(digest.Recipient, digest.Notifications)
+		if err == nil {
+			err = ed.mailer.Send(message)
+		}
+		if err != nil {
+			ed.logger.Printf("could not send email digest to %s: %s", digest.Recipient.Email, err.Error())
+			continue
+		}
+
+		err = markNotificationsDigested(session, digest.Recipient.Email, digest.Notifications)
+		if err != nil {
+			ed.logger.Printf("could not mark email digest for %s as sent: %s", digest.Recipient.Email, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func getNextDigestTime(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+func getPendingDigests(session neo4j.Session) ([]digestEmail, error) {
+	query := fmt.Sprintf(`
+		MATCH (u)-[:HAS_NOTIFICATION]->(n:Notification) 
+		WHERE (u:%s OR u:%s) AND u.emailMode = $emailMode AND n.digestedAt IS NULL 
+			AND NOT n.type IN coalesce(u.emailMutedTypes, []) AND NOT coalesce(u.archived, false) 
+		OPTIONAL MATCH (n)-[:ABOUT]->(t:Test)-[:BELONGS_TO]->(subj:Subject) 
+		RETURN u.email, u.firstName, u.lastName, u.emailMode, u.emailMutedTypes, 
+			n.ID, n.type, n.message, n.payload, n.createdAt, n.readAt, t.testID, t.name, subj.name 
+		ORDER BY u.email, n.createdAt
+	`, repositories.StudentLabel, repositories.TeacherLabel)
+	params := map[string]interface{}{
+		"emailMode": EmailModeDigest,
+	}
+
+	digests, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []digestEmail
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []digestEmail{}, err
+		}
+		for records.Next() {
+			record := records.Record()
+			recipient, err := GetEmailRecipientFromQuery(record, "u")
+			if err != nil {
+				return []digestEmail{}, err
+			}
+			notification, err := GetNotificationFromQuery(record)
+			if err != nil {
+				return []digestEmail{}, err
+			}
+
+			if len(results) == 0 || results[len(results)-1].Recipient.Email != recipient.Email {
+				results = append(results, digestEmail{Recipient: recipient})
+			}
+			results[len(results)-1].Notifications = append(results[len(results)-1].Notifications, notification)
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []digestEmail{}, err
+	}
+
+	return digests.([]digestEmail), nil
+}
+
+// markNotificationsDigested matches the notifications through their recipient, since notification IDs
+// are only unique per user.
+func markNotificationsDigested(session neo4j.Session, email string, notifications []repositories.Notification) error {
+	var notificationIDs []int
+	for _, notification := range notifications {
+		notificationIDs = append(notificationIDs, notification.ID)
+	}
+
+	query := fmt.Sprintf(`
+		MATCH (u)-[:HAS_NOTIFICATION]->(n:Notification) 
+		WHERE (u:%s OR u:%s) AND u.email = $email AND n.ID IN $notificationIDs 
+		SET n.digestedAt = $digestedAt
+	`, repositories.StudentLabel, repositories.TeacherLabel)
+	params := map[string]interface{}{
+		"email":           email,
+		"notificationIDs": notificationIDs,
+		"digestedAt":      time.Now().Unix(),
+	}
+
+	return WriteTX(session, query, params)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	DigestEmailSubject = "Your QBot daily digest"
+)
+
+// notificationLineTemplate describes one notification in a sentence. It is shared by the plain text
+// and HTML emails, the HTML one escaping the values on its own.
+var notificationLineTemplate = fmt.Sprintf(`{{define "line"}}`+
+	`{{if eq .Type "%s"}}{{.Payload.TestName}} ({{.Payload.Subject}}) has been graded: {{.Payload.Grade}} points.`+
+	`{{else if eq .Type "%s"}}The grade for {{.Payload.TestName}} ({{.Payload.Subject}}) has been corrected to {{.Payload.Grade}} points.`+
+	`{{else if eq .Type "%s"}}A student flagged a grading error on {{.Payload.TestName}} ({{.Payload.Subject}}).`+
+	`{{else if eq .Type "%s"}}The grades for {{.Payload.TestName}} ({{.Payload.Subject}}) have been published.`+
+	`{{else if or (eq .Type "%s") (eq .Type "%s")}}{{.Message}} ({{.Payload.Subject}})`+
+	`{{else}}{{.Message}}{{end}}{{end}}`,
+	NotificationTypeTestGraded, NotificationTypeTestCorrection, NotificationTypeGradingError, NotificationTypeGradesPublished,
+	NotificationTypeObjectiveStatus, NotificationTypeObjectiveAssigned)
+
+var notificationTextTemplate = texttemplate.Must(texttemplate.New("notification").Parse(notificationLineTemplate + `Hello {{.Recipient.FirstName}},
+
+{{template "line" .Notification}}
+
+Open QBot to see the details.
+`))
+
+var notificationHTMLTemplate = htmltemplate.Must(htmltemplate.New("notification").Parse(notificationLineTemplate + `<html>
+<body>
+<p>Hello {{.Recipient.FirstName}},</p>
+<p>{{template "line" .Notification}}</p>
+<p>Open QBot to see the details.</p>
+</body>
+</html>
+`))
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Parse(notificationLineTemplate + `Hello {{.Recipient.FirstName}},
+
+Here is what happened since your last digest:
+{{range .Notifications}}
+- {{template "line" .}}{{end}}
+
+Open QBot to see the details.
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(notificationLineTemplate + `<html>
+<body>
+<p>Hello {{.Recipient.FirstName}},</p>
+<p>Here is what happened since your last digest:</p>
+<ul>
+{{range .Notifications}}<li>{{template "line" .}}</li>
+{{end}}</ul>
+<p>Open QBot to see the details.</p>
+</body>
+</html>
+`))
+
+type notificationEmail struct {
+	Recipient    EmailRecipient
+	Notification repositories.Notification
+}
+
+type digestEmail struct {
+	Recipient     EmailRecipient
+	Notifications []repositories.Notification
+}
+
+func RenderNotificationEmail(recipient EmailRecipient, notification repositories.Notification) (MailMessage, error) {
+	data := notificationEmail{Recipient: recipient, Notification: notification}
+
+	return renderEmail(recipient.Email, notification.Message, data, notificationTextTemplate, notificationHTMLTemplate)
+}
+
+func RenderDigestEmail(recipient EmailRecipient, notifications []repositories.Notification) (MailMessage, error) {
+	data := digestEmail{Recipient: recipient, Notifications: notifications}
+
+	return renderEmail(recipient.Email, DigestEmailSubject, data, digestTextTemplate, digestHTMLTemplate)
+}
+
+func renderEmail(to string, subject string, data interface{}, textTemplate *texttemplate.Template, htmlTemplate *htmltemplate.Template) (MailMessage, error) {
+	var text, html bytes.Buffer
+
+	err := textTemplate.Execute(&text, data)
+	if err != nil {
+		return MailMessage{}, err
+	}
+	err = htmlTemplate.Execute(&html, data)
+	if err != nil {
+		return MailMessage{}, err
+	}
+
+	return MailMessage{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+const (
+	VerificationEmailSubject  = "Confirm your QBot email address"
+	InvitationEmailSubject    = "You have been invited to QBot"
+	PasswordResetEmailSubject = "Reset your QBot password"
+)
+
+var verificationTextTemplate = texttemplate.Must(texttemplate.New("verification").Parse(`Hello {{.Recipient.FirstName}},
+
+Please confirm this is your email address by opening the link below:
+{{.Link}}
+
+Until you do, you cannot grade or submit tests.
+`))
+
+var verificationHTMLTemplate = htmltemplate.Must(htmltemplate.New("verification").Parse(`<html>
+<body>
+<p>Hello {{.Recipient.FirstName}},</p>
+<p>Please confirm this is your email address by opening <a href="{{.Link}}">this link</a>.</p>
+<p>Until you do, you cannot grade or submit tests.</p>
+</body>
+</html>
+`))
+
+var invitationTextTemplate = texttemplate.Must(texttemplate.New("invitation").Parse(`Hello,
+
+{{.TeacherName}} invited you to join group {{.Group}} on QBot. Create your account by opening the link below:
+{{.Link}}
+`))
+
+var invitationHTMLTemplate = htmltemplate.Must(htmltemplate.New("invitation").Parse(`<html>
+<body>
+<p>Hello,</p>
+<p>{{.TeacherName}} invited you to join group {{.Group}} on QBot. Create your account by opening <a href="{{.Link}}">this link</a>.</p>
+</body>
+</html>
+`))
+
+var passwordResetTextTemplate = texttemplate.Must(texttemplate.New("passwordReset").Parse(`Hello {{.Recipient.FirstName}},
+
+Someone asked to reset the password of your QBot account. Choose a new password by opening the link below:
+{{.Link}}
+
+The link works once and expires in an hour. If you did not ask for it, you can ignore this email.
+`))
+
+var passwordResetHTMLTemplate = htmltemplate.Must(htmltemplate.New("passwordReset").Parse(`<html>
+<body>
+<p>Hello {{.Recipient.FirstName}},</p>
+<p>Someone asked to reset the password of your QBot account. Choose a new password by opening <a href="{{.Link}}">this link</a>.</p>
+<p>The link works once and expires in an hour. If you did not ask for it, you can ignore this email.</p>
+</body>
+</html>
+`))
+
+type verificationEmail struct {
+	Recipient EmailRecipient
+	Link      string
+}
+
+// InvitationEmail holds what the invitation of a student says.
+type InvitationEmail struct {
+	Email       string
+	TeacherName string
+	Group       int
+	Link        string
+}
+
+func RenderVerificationEmail(recipient EmailRecipient, link string) (MailMessage, error) {
+	data := verificationEmail{Recipient: recipient, Link: link}
+
+	return renderEmail(recipient.Email, VerificationEmailSubject, data, verificationTextTemplate, verificationHTMLTemplate)
+}
+
+func RenderInvitationEmail(invitation InvitationEmail) (MailMessage, error) {
+	return renderEmail(invitation.Email, InvitationEmailSubject, invitation, invitationTextTemplate, invitationHTMLTemplate)
+}
+
+func RenderPasswordResetEmail(recipient EmailRecipient, link string) (MailMessage, error) {
+	data := verificationEmail{Recipient: recipient, Link: link}
+
+	return renderEmail(recipient.Email, PasswordResetEmailSubject, data, passwordResetTextTemplate, passwordResetHTMLTemplate)
+}
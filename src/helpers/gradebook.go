@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	GradebookFormatCSV  = "csv"
+	GradebookFormatXLSX = "xlsx"
+	GradebookFormatPDF  = "pdf"
+
+	gradebookTimeLayout   = "2006-01-02 15:04"
+	gradebookMargin       = 10
+	gradebookLineHeight   = 5
+	gradebookTitleSize    = 16
+	gradebookFontSize     = 8
+	gradebookAnswersIndex = 4
+)
+
+var GradebookContentTypes = map[string]string{
+	GradebookFormatCSV:  "text/csv",
+	GradebookFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	GradebookFormatPDF:  "application/pdf",
+}
+
+var gradebookHeader = []string{
+	"Test", "Subject", "Last name", "First name", "Email", "Group",
+	"Grade", "Corrected grade", "Final grade", "Total points", "Graded at", "Corrected at",
+}
+
+// gradebookPDFHeader holds the columns of the printable report, which lists the answers of a
+// submission in a single column instead of one column for every question.
+var gradebookPDFHeader = []string{"Test", "Student", "Email", "Group", "Answers", "Grade", "Corrected", "Graded at", "Corrected at"}
+
+var gradebookPDFWidths = []float64{32, 38, 48, 12, 75, 12, 16, 22, 22}
+
+func ValidateGradebookFormat(format string) error {
+	if _, ok := GradebookContentTypes[format]; !ok {
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+
+	return nil
+}
+
+// ExportGradebook writes the submissions as a gradebook in the given format. Submissions are ordered by
+// test and then by student name, and CSV and XLSX exports get one column with the answers to every question.
+func ExportGradebook(title string, submissions []repositories.CompletedTest, format string) ([]byte, error) {
+	sorted := make([]repositories.CompletedTest, len(submissions))
+	copy(sorted, submissions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Test.Name != sorted[j].Test.Name {
+			return sorted[i].Test.Name < sorted[j].Test.Name
+		}
+		if sorted[i].Author.LastName != sorted[j].Author.LastName {
+			return sorted[i].Author.LastName < sorted[j].Author.LastName
+		}
+
+		return sorted[i].Author.FirstName < sorted[j].Author.FirstName
+	})
+
+	switch format {
+	case GradebookFormatCSV:
+		return writeGradebookCSV(getGradebookRows(sorted))
+	case GradebookFormatXLSX:
+		return WriteXLSX(title, getGradebookRows(sorted))
+	case GradebookFormatPDF:
+		return writeGradebookPDF(title, sorted)
+	}
+
+	return nil, ValidateGradebookFormat(format)
+}
+
+func getGradebookRows(submissions []repositories.CompletedTest) [][]string {
+	nrQuestions := 0
+	for _, submission := range submissions {
+		if submission.Test.NrQuestions > nrQuestions {
+			nrQuestions = submission.Test.NrQuestions
+		}
+	}
+
+	header := append([]string{}, gradebookHeader...)
+	for question := 1; question <= nrQuestions; question++ {
+		header = append(header, fmt.Sprintf("Q%d", question))
+	}
+
+	rows := [][]string{header}
+	for _, submission := range submissions {
+		row := []string{
+			submission.Test.Name,
+			submission.Test.Subject,
+			submission.Author.LastName,
+			submission.Author.FirstName,
+			submission.Author.Email,
+			strconv.Itoa(submission.Author.Group),
+			strconv.Itoa(submission.Grade),
+			getCorrectedGradeCell(submission),
+			strconv.Itoa(GetFinalGrade(submission)),
+			strconv.Itoa(submission.Test.TotalPoints),
+			getTimestampCell(submission.GradeTimestamp),
+			getTimestampCell(submission.CorrectedGradeTimestamp),
+		}
+		for question := 0; question < nrQuestions; question++ {
+			row = append(row, strings.Join(submission.Answers[question], ","))
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func writeGradebookCSV(rows [][]string) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	err := writer.WriteAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// writeGradebookPDF prints the submissions as a landscape table, wrapping long cells and repeating the
+// header on every page.
+func writeGradebookPDF(title string, submissions []repositories.CompletedTest) ([]byte, error) {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetMargins(gradebookMargin, gradebookMargin, gradebookMargin)
+	pdf.SetAutoPageBreak(false, gradebookMargin)
+	pdf.AddPage()
+
+	pdf.SetFont(defaultTemplateFont, "B", gradebookTitleSize)
+	pdf.CellFormat(0, 10, translate(title), "", 1, "L", false, 0, "")
+	pdf.SetFont(defaultTemplateFont, "", gradebookFontSize)
+	pdf.CellFormat(0, gradebookLineHeight, fmt.Sprintf("%d submissions, exported on %s", len(submissions), time.Now().Format(gradebookTimeLayout)),
+		"", 1, "L", false, 0, "")
+	pdf.Ln(gradebookLineHeight)
+
+	addGradebookPDFRow(pdf, gradebookPDFHeader, "B", translate)
+	for _, submission := range submissions {
+		row := []string{
+			submission.Test.Name,
+			fmt.Sprintf("%s %s", submission.Author.LastName, submission.Author.FirstName),
+			submission.Author.Email,
+			strconv.Itoa(submission.Author.Group),
+			getAnswersCell(submission.Answers),
+			strconv.Itoa(submission.Grade),
+			getCorrectedGradeCell(submission),
+			getTimestampCell(submission.GradeTimestamp),
+			getTimestampCell(submission.CorrectedGradeTimestamp),
+		}
+
+		_, pageHeight := pdf.GetPageSize()
+		if pdf.GetY()+getGradebookPDFRowHeight(pdf, row, translate) > pageHeight-gradebookMargin {
+			pdf.AddPage()
+			addGradebookPDFRow(pdf, gradebookPDFHeader, "B", translate)
+		}
+		addGradebookPDFRow(pdf, row, "", translate)
+	}
+
+	var buffer bytes.Buffer
+	err := pdf.Output(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func addGradebookPDFRow(pdf *gofpdf.Fpdf, row []string, style string, translate func(string) string) {
+	pdf.SetFont(defaultTemplateFont, style, gradebookFontSize)
+	height := getGradebookPDFRowHeight(pdf, row, translate)
+	x, y := pdf.GetXY()
+	for index, value := range row {
+		width := gradebookPDFWidths[index]
+		pdf.Rect(x, y, width, height, "D")
+		pdf.SetXY(x, y)
+		align := "L"
+		if index > gradebookAnswersIndex {
+			align = "C"
+		}
+		pdf.MultiCell(width, gradebookLineHeight, translate(value), "", align, false)
+		x += width
+	}
+
+	pdf.SetXY(gradebookMargin, y+height)
+}
+
+func getGradebookPDFRowHeight(pdf *gofpdf.Fpdf, row []string, translate func(string) string) float64 {
+	nrLines := 1
+	for index, value := range row {
+		lines := pdf.SplitLines([]byte(translate(value)), gradebookPDFWidths[index])
+		if len(lines) > nrLines {
+			nrLines = len(lines)
+		}
+	}
+
+	return float64(nrLines * gradebookLineHeight)
+}
+
+// getAnswersCell lists the answers as question number and options, e.g. "1:A 2:B,C".
+func getAnswersCell(answers map[int][]string) string {
+	questions := make([]int, 0, len(answers))
+	for question := range answers {
+		questions = append(questions, question)
+	}
+	sort.Ints(questions)
+
+	var cells []string
+	for _, question := range questions {
+		cells = append(cells, fmt.Sprintf("%d:%s", question+1, strings.Join(answers[question], ",")))
+	}
+
+	return strings.Join(cells, " ")
+}
+
+func getCorrectedGradeCell(submission repositories.CompletedTest) string {
+	if submission.CorrectedGradeTimestamp == 0 {
+		return EmptyStringParameter
+	}
+
+	return strconv.Itoa(submission.CorrectedGrade)
+}
+
+func getTimestampCell(timestamp int) string {
+	if timestamp == 0 {
+		return EmptyStringParameter
+	}
+
+	return time.Unix(int64(timestamp), 0).Format(gradebookTimeLayout)
+}
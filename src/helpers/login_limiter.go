@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	loginAccountFreeAttempts = 5
+	loginIPFreeAttempts      = 20
+	loginBaseLockout         = 30 * time.Second
+	loginMaxLockout          = time.Hour
+	loginFailureMemory       = 24 * time.Hour
+	loginPruneInterval       = time.Minute
+)
+
+// LoginLimiter slows down password guessing. After a few failed logins an account, or an address logging
+// in to any account, is locked out for a while, and every further failure doubles the lockout. Addresses
+// get more attempts than accounts, since a whole faculty can share one.
+type LoginLimiter struct {
+	mu        sync.Mutex
+	accounts  map[string]*loginFailures
+	ips       map[string]*loginFailures
+	lastPrune time.Time
+}
+
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+	// reportedUntil is the end of the last lockout a blocked login was reported for.
+	reportedUntil time.Time
+}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{
+		accounts:  make(map[string]*loginFailures),
+		ips:       make(map[string]*loginFailures),
+		lastPrune: time.Now(),
+	}
+}
+
+// Check returns how long logins from the address or to the account are still locked out, and whether
+// this is the first login attempted during that lockout.
+func (l *LoginLimiter) Check(ip string, account string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Duration(0)
+	first := false
+	for _, failures := range []*loginFailures{l.ips[ip], l.accounts[normalizeLoginAccount(account)]} {
+		if failures == nil || !failures.lockedUntil.After(now) {
+			continue
+		}
+		if failures.lockedUntil.Sub(now) > wait {
+			wait = failures.lockedUntil.Sub(now)
+		}
+		if !failures.reportedUntil.Equal(failures.lockedUntil) {
+			failures.reportedUntil = failures.lockedUntil
+			first = true
+		}
+	}
+
+	return wait, first
+}
+
+// Fail counts a failed login. Failures are forgotten after a day without any.
+func (l *LoginLimiter) Fail(ip string, account string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	recordLoginFailure(l.ips, ip, loginIPFreeAttempts, now)
+	recordLoginFailure(l.accounts, normalizeLoginAccount(account), loginAccountFreeAttempts, now)
+}
+
+// Succeed forgets the failures of the account. The ones of the address are kept, so an attacker cannot
+// keep guessing by logging in to an account of their own in between.
+func (l *LoginLimiter) Succeed(account string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.accounts, normalizeLoginAccount(account))
+}
+
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < loginPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	for _, entries := range []map[string]*loginFailures{l.ips, l.accounts} {
+		for key, failures := range entries {
+			if now.Sub(failures.lastFailure) > loginFailureMemory {
+				delete(entries, key)
+			}
+		}
+	}
+}
+
+func recordLoginFailure(entries map[string]*loginFailures, key string, freeAttempts int, now time.Time) {
+	failures, ok := entries[key]
+	if !ok || now.Sub(failures.lastFailure) > loginFailureMemory {
+		failures = &loginFailures{}
+		entries[key] = failures
+	}
+
+	failures.count++
+	failures.lastFailure = now
+	failures.lockedUntil = now.Add(getLoginLockout(failures.count, freeAttempts))
+}
+
+func getLoginLockout(count int, freeAttempts int) time.Duration {
+	if count < freeAttempts {
+		return 0
+	}
+
+	lockout := loginBaseLockout
+	for i := freeAttempts; i < count && lockout < loginMaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > loginMaxLockout {
+		return loginMaxLockout
+	}
+
+	return lockout
+}
+
+func normalizeLoginAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+// GetClientIP returns the address the request comes from. Forwarding headers are ignored, since anyone
+// could set them to get around the login limits.
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
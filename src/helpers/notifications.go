@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	GradingErrorNotification      = "Test requires correction!"
+	TestGradedNotification        = "Test has been graded!"
+	TestCorrectionNotification    = "Test has been corrected!"
+	GradesPublishedNotification   = "Grades have been published!"
+	ObjectiveAtRiskNotification   = "Objective is at risk!"
+	ObjectiveAchievedNotification = "Objective has been achieved!"
+	ObjectiveMissedNotification   = "Objective has been missed!"
+	ObjectiveAssignedNotification = "A new objective has been set!"
+
+	NotificationTypeGradingError      = "gradingError"
+	NotificationTypeTestGraded        = "testGraded"
+	NotificationTypeTestCorrection    = "testCorrection"
+	NotificationTypeGradesPublished   = "gradesPublished"
+	NotificationTypeObjectiveStatus   = "objectiveStatus"
+	NotificationTypeObjectiveAssigned = "objectiveAssigned"
+)
+
+// ObjectiveStatusNotifications holds the message for every objective status worth notifying about.
+var ObjectiveStatusNotifications = map[string]string{
+	ObjectiveStatusAtRisk:   ObjectiveAtRiskNotification,
+	ObjectiveStatusAchieved: ObjectiveAchievedNotification,
+	ObjectiveStatusMissed:   ObjectiveMissedNotification,
+}
+
+// AddNotification creates one notification for every user matched by recipientQuery, which has to
+// bind them to u. Deleted users are skipped, here as well as when pushing and emailing. Notifications
+// about a test are linked to it so the test details can be read back with the notification.
+// Notification IDs are counted per user in lastNotificationID. The recipient is locked by writing to it
+// before the counter is read, so notifications added at the same time never get the same ID.
+func AddNotification(session neo4j.Session, recipientQuery string, params map[string]interface{}, notification repositories.Notification) error {
+	payload, err := json.Marshal(notification.Payload)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		%s 
+		WITH DISTINCT u 
+		WHERE NOT coalesce(u.archived, false) 
+		WITH collect(u) AS recipients 
+		OPTIONAL MATCH (aboutTest:Test {testID:$notificationTestID}) 
+		UNWIND recipients AS recipient 
+		SET recipient.notificationLock = true 
+		REMOVE recipient.notificationLock 
+		WITH recipient, aboutTest 
+		SET recipient.lastNotificationID = coalesce(recipient.lastNotificationID, 
+			reduce(lastID = 0, notificationID IN [(recipient)-[:HAS_NOTIFICATION]->(n:Notification) | n.ID] | 
+				CASE WHEN notificationID > lastID THEN notificationID ELSE lastID END)) + 1 
+		WITH recipient, aboutTest, recipient.lastNotificationID AS nextID 
+		CREATE (recipient)-[:HAS_NOTIFICATION]->(notification:Notification {ID:nextID, type:$notificationType, 
+			message:$notificationMessage, payload:$notificationPayload, createdAt:$notificationCreatedAt}) 
+		FOREACH (test IN CASE WHEN aboutTest IS NULL THEN [] ELSE [aboutTest] END | CREATE (notification)-[:ABOUT]->(test))
+	`, recipientQuery)
+
+	notificationParams := map[string]interface{}{
+		"notificationTestID":    notification.Payload.TestID,
+		"notificationType":      notification.Type,
+		"notificationMessage":   notification.Message,
+		"notificationPayload":   string(payload),
+		"notificationCreatedAt": time.Now().Unix(),
+	}
+	for key, value := range params {
+		notificationParams[key] = value
+	}
+
+	return WriteTX(session, query, notificationParams)
+}
+
+// NotificationDispatcher adds notifications to the inbox of their recipients, pushes them to every
+// device the recipients registered and emails the recipients that did not opt for the daily digest.
+type NotificationDispatcher struct {
+	sender PushSender
+	mailer MailSender
+	logger *log.Logger
+}
+
+func NewNotificationDispatcher(sender PushSender, mailer MailSender, logger *log.Logger) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		sender: sender,
+		mailer: mailer,
+		logger: logger,
+	}
+}
+
+// Notify takes the same arguments as AddNotification. The devices and email addresses are read with
+// the given session, the messages are sent in the background.
+func (nd *NotificationDispatcher) Notify(session neo4j.Session, recipientQuery string, params map[string]interface{}, notification repositories.Notification) error {
+	notification, err := addTestToPayload(session, notification)
+	if err != nil {
+		return err
+	}
+
+	err = AddNotification(session, recipientQuery, params, notification)
+	if err != nil {
+		return err
+	}
+
+	devices, err := getRecipientDevices(session, recipientQuery, params)
+	if err != nil {
+		return err
+	}
+	recipients, err := getEmailRecipients(session, recipientQuery, params)
+	if err != nil {
+		return err
+	}
+
+	go nd.push(devices, notification)
+	go nd.mail(recipients, notification)
+
+	return nil
+}
+
+// addTestToPayload fills in the test name and subject, so the messages sent outside the app can be
+// understood without looking the test up.
+func addTestToPayload(session neo4j.Session, notification repositories.Notification) (repositories.Notification, error) {
+	if notification.Payload.TestID == 0 || notification.Payload.TestName != EmptyStringParameter {
+		return notification, nil
+	}
+
+	query := `
+		MATCH (t:Test {testID:$testID})-[:BELONGS_TO]->(subj:Subject) 
+		RETURN t.name, subj.name
+	`
+
+	payload, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		result := notification.Payload
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, map[string]interface{}{"testID": notification.Payload.TestID})
+		if err != nil {
+			return repositories.NotificationPayload{}, err
+		}
+		if records.Next() {
+			record := records.Record()
+			result.TestName, err = GetStringParameterFromQuery(record, "t.name", true, true)
+			if err != nil {
+				return repositories.NotificationPayload{}, err
+			}
+			result.Subject, err = GetStringParameterFromQuery(record, "subj.name", true, true)
+			if err != nil {
+				return repositories.NotificationPayload{}, err
+			}
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+
+	notification.Payload = payload.(repositories.NotificationPayload)
+
+	return notification, nil
+}
+
+// GetNotificationFromQuery reads a notification bound to n, along with the test it is about bound to
+// t and its subject bound to subj when the query returns them.
+func GetNotificationFromQuery(record neo4j.Record) (repositories.Notification, error) {
+	ID, err := GetIntParameterFromQuery(record, "n.ID", true, true)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	notificationType, err := GetStringParameterFromQuery(record, "n.type", true, true)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	message, err := GetStringParameterFromQuery(record, "n.message", true, false)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	payloadString, err := GetStringParameterFromQuery(record, "n.payload", true, false)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	createdAt, err := GetIntParameterFromQuery(record, "n.createdAt", true, true)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	readAt, err := GetIntParameterFromQuery(record, "n.readAt", true, false)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+
+	var payload repositories.NotificationPayload
+	if payloadString != EmptyStringParameter {
+		err = json.Unmarshal([]byte(payloadString), &payload)
+		if err != nil {
+			return repositories.Notification{}, err
+		}
+	}
+
+	testID, err := GetIntParameterFromQuery(record, "t.testID", true, false)
+	if err != nil {
+		return repositories.Notification{}, err
+	}
+	if testID != 0 {
+		payload.TestID = testID
+		payload.TestName, err = GetStringParameterFromQuery(record, "t.name", true, false)
+		if err != nil {
+			return repositories.Notification{}, err
+		}
+		payload.Subject, err = GetStringParameterFromQuery(record, "subj.name", true, false)
+		if err != nil {
+			return repositories.Notification{}, err
+		}
+	}
+
+	return repositories.Notification{
+		ID:        ID,
+		Type:      notificationType,
+		Message:   message,
+		Payload:   payload,
+		CreatedAt: createdAt,
+		ReadAt:    readAt,
+	}, nil
+}
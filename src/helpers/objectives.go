@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	ObjectiveStatusOnTrack  = "onTrack"
+	ObjectiveStatusAtRisk   = "atRisk"
+	ObjectiveStatusAchieved = "achieved"
+	ObjectiveStatusMissed   = "missed"
+
+	ObjectiveStateActive    = "active"
+	ObjectiveStateCompleted = "completed"
+	ObjectiveStateAbandoned = "abandoned"
+)
+
+func ValidateObjective(objective repositories.Objective) error {
+	if objective.EndTimestamp <= objective.StartTimestamp {
+		return fmt.Errorf("objective has to end after it starts")
+	}
+	if objective.TargetGrade <= 0 || objective.TargetGrade > 100 {
+		return fmt.Errorf("objective target has to be a percentage between 1 and 100")
+	}
+	if objective.NrTests < 0 {
+		return fmt.Errorf("objective cannot plan a negative number of tests")
+	}
+
+	return nil
+}
+
+func ValidateGroupObjective(groupObjective repositories.GroupObjective) error {
+	if groupObjective.Subject == EmptyStringParameter {
+		return fmt.Errorf("group objective needs a subject")
+	}
+	if groupObjective.TargetShare <= 0 || groupObjective.TargetShare > 100 {
+		return fmt.Errorf("group objective share has to be a percentage between 1 and 100")
+	}
+
+	return ValidateObjective(GetDerivedObjective(groupObjective))
+}
+
+// GetDerivedObjective returns the objective each student covered by a group objective gets.
+func GetDerivedObjective(groupObjective repositories.GroupObjective) repositories.Objective {
+	return repositories.Objective{
+		Subject:          groupObjective.Subject,
+		TargetGrade:      groupObjective.TargetGrade,
+		StartTimestamp:   groupObjective.StartTimestamp,
+		EndTimestamp:     groupObjective.EndTimestamp,
+		NrTests:          groupObjective.NrTests,
+		GroupObjectiveID: groupObjective.ID,
+	}
+}
+
+func IsObjectiveState(state string) bool {
+	return state == ObjectiveStateActive || state == ObjectiveStateCompleted || state == ObjectiveStateAbandoned
+}
+
+// EvaluateObjective compares the tests taken within the objective window with its target. Grades are
+// percentages of the test points. Without a planned number of tests, the grade needed is the one to
+// get on the next test.
+func EvaluateObjective(objective repositories.Objective, tests []repositories.CompletedTest, now int) repositories.ObjectiveEvaluation {
+	var percentages []float64
+	for _, test := range GetTestsInObjectiveWindow(objective, tests) {
+		if test.Test.TotalPoints == 0 {
+			continue
+		}
+		percentages = append(percentages, float64(GetFinalGrade(test))*100/float64(test.Test.TotalPoints))
+	}
+
+	evaluation := repositories.ObjectiveEvaluation{
+		NrTestsTaken: len(percentages),
+	}
+	sum := 0.0
+	if len(percentages) > 0 {
+		evaluation.Average = getMean(percentages)
+		sum = evaluation.Average * float64(len(percentages))
+	}
+
+	windowOver := now > objective.EndTimestamp
+	evaluation.RemainingTests = 1
+	if objective.NrTests > 0 {
+		evaluation.RemainingTests = int(math.Max(float64(objective.NrTests-len(percentages)), 0))
+	}
+	if windowOver {
+		evaluation.RemainingTests = 0
+	}
+
+	target := float64(objective.TargetGrade)
+	if evaluation.RemainingTests > 0 {
+		total := len(percentages) + evaluation.RemainingTests
+		evaluation.GradeNeeded = math.Max((target*float64(total)-sum)/float64(evaluation.RemainingTests), 0)
+	}
+
+	switch {
+	case evaluation.RemainingTests == 0 && evaluation.Average >= target:
+		evaluation.Status = ObjectiveStatusAchieved
+	case evaluation.RemainingTests == 0:
+		evaluation.Status = ObjectiveStatusMissed
+	case len(percentages) == 0 || evaluation.Average >= target:
+		evaluation.Status = ObjectiveStatusOnTrack
+	default:
+		evaluation.Status = ObjectiveStatusAtRisk
+	}
+
+	return evaluation
+}
+
+// EvaluateGroupObjective aggregates the evaluations of the derived student objectives. A student is on
+// target once their average reaches the target grade, and the group objective is met when the share of
+// students on target reaches the target share.
+func EvaluateGroupObjective(groupObjective repositories.GroupObjective, students []repositories.StudentObjectiveProgress, now int) repositories.GroupObjectiveProgress {
+	progress := repositories.GroupObjectiveProgress{
+		NrStudents: len(students),
+		Students:   students,
+	}
+
+	var averages []float64
+	for _, student := range students {
+		if student.Evaluation.NrTestsTaken == 0 {
+			continue
+		}
+		averages = append(averages, student.Evaluation.Average)
+		if student.Evaluation.Average >= float64(groupObjective.TargetGrade) {
+			progress.NrOnTarget++
+		}
+	}
+	if len(averages) > 0 {
+		progress.Average = getMean(averages)
+	}
+	progress.Share = percentOf(progress.NrOnTarget, progress.NrStudents)
+
+	target := float64(groupObjective.TargetShare)
+	switch {
+	case now > groupObjective.EndTimestamp && progress.Share >= target:
+		progress.Status = ObjectiveStatusAchieved
+	case now > groupObjective.EndTimestamp:
+		progress.Status = ObjectiveStatusMissed
+	case len(averages) == 0 || progress.Share >= target:
+		progress.Status = ObjectiveStatusOnTrack
+	default:
+		progress.Status = ObjectiveStatusAtRisk
+	}
+
+	return progress
+}
+
+func GetTestsInObjectiveWindow(objective repositories.Objective, tests []repositories.CompletedTest) []repositories.CompletedTest {
+	inWindow := []repositories.CompletedTest{}
+	for _, test := range tests {
+		if test.GradeTimestamp >= objective.StartTimestamp && test.GradeTimestamp <= objective.EndTimestamp {
+			inWindow = append(inWindow, test)
+		}
+	}
+
+	return inWindow
+}
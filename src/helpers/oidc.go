@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"crypto"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	LinkPurposeOIDC = "oidc"
+
+	OIDCStateCookie   = "qbot_oidc_state"
+	OIDCLoginValidity = 10 * time.Minute
+
+	oidcRequestTimeout = 10 * time.Second
+	oidcNonceLength    = 16
+)
+
+// OIDCConfig describes the identity provider of the university. The role claim of the ID token decides
+// whether someone logging in for the first time becomes a student or a teacher.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	RoleClaim    string
+	StudentRoles []string
+	TeacherRoles []string
+}
+
+// OIDCIdentity is who the identity provider says logged in.
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	UserType      string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// OIDCClient logs users in with the authorization code flow of OpenID Connect. The state of a login is a
+// link signed like the account links, so the server does not have to remember logins in progress.
+type OIDCClient struct {
+	config    OIDCConfig
+	secret    []byte
+	client    *http.Client
+	logger    *log.Logger
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewOIDCClient(config OIDCConfig, secret string, logger *log.Logger) *OIDCClient {
+	key := []byte(secret)
+	if secret == EmptyStringParameter {
+		key = make([]byte, linkSecretLength)
+		_, err := cryptoRand.Read(key)
+		if err != nil {
+			logger.Println(fmt.Sprintf("could not make up a login secret: %s", err))
+		}
+	}
+	if config.RoleClaim == EmptyStringParameter {
+		config.RoleClaim = "roles"
+	}
+
+	return &OIDCClient{
+		config: config,
+		secret: key,
+		client: &http.Client{Timeout: oidcRequestTimeout},
+		logger: logger,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// AuthURL returns where to send the browser to log in, along with the nonce the state cookie must hold
+// when the browser comes back.
+func (c *OIDCClient) AuthURL() (string, string, error) {
+	discovery, err := c.getDiscovery()
+	if err != nil {
+		return EmptyStringParameter, EmptyStringParameter, err
+	}
+	nonce, err := newRandomCode(oidcNonceLength)
+	if err != nil {
+		return EmptyStringParameter, EmptyStringParameter, err
+	}
+	state := SignLink(c.secret, LinkPurposeOIDC, nonce, time.Now().Add(OIDCLoginValidity))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.config.ClientID)
+	params.Set("redirect_uri", c.config.RedirectURL)
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nonce, nil
+}
+
+// Exchange redeems the code the identity provider sent the browser back with and checks the ID token it
+// returns. The nonce comes from the state cookie, so a login started in another browser is refused.
+func (c *OIDCClient) Exchange(code string, state string, nonce string) (OIDCIdentity, error) {
+	stateNonce, err := VerifyLink(c.secret, LinkPurposeOIDC, state, time.Now())
+	if err != nil || stateNonce != nonce {
+		return OIDCIdentity{}, fmt.Errorf("login is not valid or has expired")
+	}
+	discovery, err := c.getDiscovery()
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.config.RedirectURL)
+	form.Set("client_id", c.config.ClientID)
+	form.Set("client_secret", c.config.ClientSecret)
+
+	resp, err := c.client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	defer resp.Body.Close()
+
+	var token oidcTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == EmptyStringParameter {
+		return OIDCIdentity{}, fmt.Errorf("identity provider refused the login: %s", token.Error)
+	}
+
+	claims, err := c.verifyIDToken(token.IDToken, discovery)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if claimString(claims, "nonce") != nonce {
+		return OIDCIdentity{}, fmt.Errorf("login is not valid or has expired")
+	}
+
+	return c.getIdentity(discovery.Issuer, claims)
+}
+
+func (c *OIDCClient) verifyIDToken(idToken string, discovery oidcDiscovery) (map[string]interface{}, error) {
+	invalidErr := fmt.Errorf("ID token is not valid")
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, invalidErr
+	}
+	var header jwtHeader
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil || header.Alg != "RS256" {
+		return nil, invalidErr
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidErr
+	}
+	key, err := c.getKey(header.Kid, discovery)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	if err != nil {
+		return nil, invalidErr
+	}
+
+	var claims map[string]interface{}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return nil, invalidErr
+	}
+	if claimString(claims, "iss") != discovery.Issuer || !containsString(claimStrings(claims, "aud"), c.config.ClientID) {
+		return nil, invalidErr
+	}
+	expiresAt, ok := claims["exp"].(float64)
+	if !ok || time.Now().Unix() > int64(expiresAt) {
+		return nil, fmt.Errorf("ID token has expired")
+	}
+
+	return claims, nil
+}
+
+// getIdentity maps the claims of the ID token to a user. Teacher roles win over student roles, since
+// teachers who also study keep using their teacher account.
+func (c *OIDCClient) getIdentity(issuer string, claims map[string]interface{}) (OIDCIdentity, error) {
+	identity := OIDCIdentity{
+		Issuer:        issuer,
+		Subject:       claimString(claims, "sub"),
+		Email:         strings.ToLower(claimString(claims, "email")),
+		EmailVerified: claims["email_verified"] == true || claims["email_verified"] == "true",
+		FirstName:     claimString(claims, "given_name"),
+		LastName:      claimString(claims, "family_name"),
+	}
+	if identity.Subject == EmptyStringParameter || identity.Email == EmptyStringParameter {
+		return OIDCIdentity{}, fmt.Errorf("identity provider did not share the subject and email of the user")
+	}
+
+	roles := claimStrings(claims, c.config.RoleClaim)
+	for _, role := range roles {
+		if containsString(c.config.TeacherRoles, role) {
+			identity.UserType = repositories.TeacherType
+
+			return identity, nil
+		}
+	}
+	for _, role := range roles {
+		if containsString(c.config.StudentRoles, role) {
+			identity.UserType = repositories.StudentType
+		}
+	}
+
+	return identity, nil
+}
+
+func (c *OIDCClient) getDiscovery() (oidcDiscovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil {
+		return *c.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	err := c.getJSON(strings.TrimSuffix(c.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return oidcDiscovery{}, fmt.Errorf("could not discover identity provider: %s", err)
+	}
+	if discovery.Issuer != strings.TrimSuffix(c.config.Issuer, "/") {
+		return oidcDiscovery{}, fmt.Errorf("identity provider reports issuer '%s'", discovery.Issuer)
+	}
+	c.discovery = &discovery
+
+	return discovery, nil
+}
+
+// getKey returns the signing key with the ID, fetching the keys again when the provider rotated them.
+func (c *OIDCClient) getKey(kid string, discovery oidcDiscovery) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	var keySet jsonWebKeySet
+	err := c.getJSON(discovery.JWKSURI, &keySet)
+	if err != nil {
+		return nil, fmt.Errorf("could not get signing keys of identity provider: %s", err)
+	}
+	for _, jwk := range keySet.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		key, err := jwk.getPublicKey()
+		if err != nil {
+			c.logger.Printf("skipping signing key '%s': %s", jwk.Kid, err.Error())
+			continue
+		}
+		c.keys[jwk.Kid] = key
+	}
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("ID token is signed with unknown key '%s'", kid)
+	}
+
+	return key, nil
+}
+
+func (c *OIDCClient) getJSON(url string, v interface{}) error {
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered with status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (jwk jsonWebKey) getPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+
+	return value
+}
+
+// claimStrings reads a claim which holds either one string or a list of them.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	}
+
+	return []string{}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"crypto"
+	cryptoRand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mockOIDCKeyID       = "mock"
+	mockOIDCKeyBits     = 2048
+	mockOIDCTokenExpiry = 5 * time.Minute
+)
+
+var mockOIDCLoginTemplate = htmltemplate.Must(htmltemplate.New("mockOIDCLogin").Parse(`<html>
+<body>
+<h1>Mock identity provider</h1>
+<form method="get">
+{{range $name, $value := .}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Email <input name="email"></label></p>
+<p><label>First name <input name="given_name"></label></p>
+<p><label>Last name <input name="family_name"></label></p>
+<p><label>Role <select name="role"><option>student</option><option>teacher</option></select></label></p>
+<p><button type="submit">Log in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// MockOIDCProvider is an identity provider for local development which logs in whoever fills in its form.
+// It implements just enough of OpenID Connect for the authorization code flow of OIDCClient.
+type MockOIDCProvider struct {
+	issuer string
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	logins map[string]mockOIDCLogin
+}
+
+type mockOIDCLogin struct {
+	clientID    string
+	redirectURI string
+	claims      map[string]interface{}
+}
+
+func NewMockOIDCProvider(issuer string) (*MockOIDCProvider, error) {
+	key, err := rsa.GenerateKey(cryptoRand.Reader, mockOIDCKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MockOIDCProvider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		key:    key,
+		logins: make(map[string]mockOIDCLogin),
+	}, nil
+}
+
+func (p *MockOIDCProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	SetContentType(w)
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+		err = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.issuer,
+			AuthorizationEndpoint: p.issuer + "/authorize",
+			TokenEndpoint:         p.issuer + "/token",
+			JWKSURI:               p.issuer + "/jwks",
+		})
+	case strings.HasSuffix(r.URL.Path, "/jwks"):
+		err = json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "RSA",
+			Kid: mockOIDCKeyID,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}}})
+	case strings.HasSuffix(r.URL.Path, "/authorize"):
+		err = p.authorize(w, r)
+	case strings.HasSuffix(r.URL.Path, "/token") && r.Method == http.MethodPost:
+		err = p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// authorize shows the login form and sends the browser back to the client with a code once it is filled in.
+func (p *MockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	email := query.Get("email")
+	if email == EmptyStringParameter {
+		params := make(map[string]string)
+		for _, name := range []string{"client_id", "redirect_uri", "state", "nonce"} {
+			params[name] = query.Get(name)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		return mockOIDCLoginTemplate.Execute(w, params)
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == EmptyStringParameter {
+		return fmt.Errorf("redirect_uri is not valid")
+	}
+	code, err := newRandomCode(linkSecretLength)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.logins[code] = mockOIDCLogin{
+		clientID:    query.Get("client_id"),
+		redirectURI: redirectURI.String(),
+		claims: map[string]interface{}{
+			"sub":            "mock:" + strings.ToLower(email),
+			"email":          email,
+			"email_verified": true,
+			"given_name":     query.Get("given_name"),
+			"family_name":    query.Get("family_name"),
+			"roles":          []string{query.Get("role")},
+			"nonce":          query.Get("nonce"),
+		},
+	}
+	p.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+
+	return nil
+}
+
+// token redeems a code once for an ID token signed with the key of the provider.
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) error {
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	login, ok := p.logins[r.PostForm.Get("code")]
+	delete(p.logins, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || login.clientID != r.PostForm.Get("client_id") || login.redirectURI != r.PostForm.Get("redirect_uri") {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+	}
+
+	now := time.Now()
+	claims := login.claims
+	claims["iss"] = p.issuer
+	claims["aud"] = login.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(mockOIDCTokenExpiry).Unix()
+	idToken, err := p.sign(claims)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: idToken})
+}
+
+func (p *MockOIDCProvider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "RS256", Kid: mockOIDCKeyID})
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(cryptoRand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
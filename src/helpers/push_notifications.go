@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	DevicePlatformAndroid = "android"
+	DevicePlatformIOS     = "ios"
+
+	pushRequestTimeout = 10 * time.Second
+)
+
+type PushSender interface {
+	Send(device repositories.Device, notification repositories.Notification) error
+}
+
+// HTTPPushSender posts FCM style messages, which the FCM gateway also delivers to APNs devices.
+type HTTPPushSender struct {
+	URL       string
+	ServerKey string
+	Client    *http.Client
+}
+
+type pushMessage struct {
+	To           string                           `json:"to"`
+	Notification pushMessageNotification          `json:"notification"`
+	Data         repositories.NotificationPayload `json:"data"`
+}
+
+type pushMessageNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func NewHTTPPushSender(url string, serverKey string) *HTTPPushSender {
+	return &HTTPPushSender{
+		URL:       url,
+		ServerKey: serverKey,
+		Client:    &http.Client{Timeout: pushRequestTimeout},
+	}
+}
+
+func (s *HTTPPushSender) Send(device repositories.Device, notification repositories.Notification) error {
+	body, err := json.Marshal(pushMessage{
+		To: device.Token,
+		Notification: pushMessageNotification{
+			Title: notification.Message,
+			Body:  getPushBody(notification),
+		},
+		Data: notification.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("key=%s", s.ServerKey))
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("push gateway answered with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// LogPushSender only logs the messages it is given, for running the server without a push gateway.
+type LogPushSender struct {
+	Logger *log.Logger
+}
+
+func (s *LogPushSender) Send(device repositories.Device, notification repositories.Notification) error {
+	s.Logger.Printf("push to %s device %s: %s %s", device.Platform, device.Token, notification.Message, getPushBody(notification))
+
+	return nil
+}
+
+// FakePushSender keeps every message it is given so they can be checked offline.
+type FakePushSender struct {
+	mutex    sync.Mutex
+	Messages []PushedMessage
+}
+
+type PushedMessage struct {
+	Device       repositories.Device
+	Notification repositories.Notification
+}
+
+func (s *FakePushSender) Send(device repositories.Device, notification repositories.Notification) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Messages = append(s.Messages, PushedMessage{Device: device, Notification: notification})
+
+	return nil
+}
+
+func (nd *NotificationDispatcher) push(devices []repositories.Device, notification repositories.Notification) {
+	for _, device := range devices {
+		err := nd.sender.Send(device, notification)
+		if err != nil {
+			nd.logger.Printf("could not push '%s' to %s device: %s", notification.Type, device.Platform, err.Error())
+		}
+	}
+}
+
+func getRecipientDevices(session neo4j.Session, recipientQuery string, params map[string]interface{}) ([]repositories.Device, error) {
+	query := fmt.Sprintf(`
+		%s 
+		WITH DISTINCT u 
+		WHERE NOT coalesce(u.archived, false) 
+		MATCH (u)-[:HAS_DEVICE]->(d:Device) 
+		RETURN DISTINCT d.token, d.platform
+	`, recipientQuery)
+
+	devices, err := session.ReadTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		var results []repositories.Device
+
+		fmt.Printf("query: %s\n", query)
+
+		records, err := tx.Run(query, params)
+		if err != nil {
+			return []repositories.Device{}, err
+		}
+		for records.Next() {
+			record := records.Record()
+			token, err := GetStringParameterFromQuery(record, "d.token", true, true)
+			if err != nil {
+				return []repositories.Device{}, err
+			}
+			platform, err := GetStringParameterFromQuery(record, "d.platform", true, false)
+			if err != nil {
+				return []repositories.Device{}, err
+			}
+
+			results = append(results, repositories.Device{Token: token, Platform: platform})
+		}
+
+		return results, nil
+	})
+	if err != nil {
+		return []repositories.Device{}, err
+	}
+
+	return devices.([]repositories.Device), nil
+}
+
+func getPushBody(notification repositories.Notification) string {
+	if notification.Payload.TestName != EmptyStringParameter {
+		return fmt.Sprintf("%s - %s", notification.Payload.Subject, notification.Payload.TestName)
+	}
+
+	return notification.Payload.Subject
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 )
 
 const (
@@ -60,3 +61,12 @@ func InvalidTokenError(path string, err error) error {
 func MarshalError(path string, err error) error {
 	return fmt.Errorf("could not marshal response json for %s: %s", path, err.Error())
 }
+
+// LoginFailedError is the same whatever went wrong, so failed logins do not tell which accounts exist.
+func LoginFailedError(path string) error {
+	return fmt.Errorf("could not log in for %s: invalid email or password", path)
+}
+
+func LoginLockedError(path string, wait time.Duration) error {
+	return fmt.Errorf("could not log in for %s: too many failed attempts, try again in %d seconds", path, int(wait.Seconds())+1)
+}
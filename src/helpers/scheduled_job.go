@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+)
+
+// ScheduledJob runs a task with a session of its own at a fixed interval until it is closed.
+type ScheduledJob struct {
+	driver   neo4j.Driver
+	name     string
+	interval time.Duration
+	task     func(session neo4j.Session) error
+	logger   *log.Logger
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewScheduledJob(driver neo4j.Driver, name string, interval time.Duration, task func(session neo4j.Session) error, logger *log.Logger) *ScheduledJob {
+	job := &ScheduledJob{
+		driver:   driver,
+		name:     name,
+		interval: interval,
+		task:     task,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+
+	job.wg.Add(1)
+	go job.run()
+
+	return job
+}
+
+func (sj *ScheduledJob) Close() {
+	close(sj.stop)
+	sj.wg.Wait()
+}
+
+func (sj *ScheduledJob) run() {
+	defer sj.wg.Done()
+
+	ticker := time.NewTicker(sj.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sj.stop:
+			return
+		case <-ticker.C:
+			err := sj.runOnce()
+			if err != nil {
+				sj.logger.Printf("scheduled job %s failed: %s", sj.name, err.Error())
+			}
+		}
+	}
+}
+
+func (sj *ScheduledJob) runOnce() error {
+	session, err := GetNeo4jSession(sj.driver)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return sj.task(session)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatXLSX = "xlsx"
+
+	ImportStatusCreated = "created"
+	ImportStatusUpdated = "updated"
+	ImportStatusInvalid = "invalid"
+
+	importColumnFirstName      = "firstname"
+	importColumnLastName       = "lastname"
+	importColumnEmail          = "email"
+	importColumnYear           = "year"
+	importColumnGroup          = "group"
+	importColumnSpecialization = "specialization"
+	importColumnFaculty        = "faculty"
+	importColumnSubjects       = "subjects"
+	importSubjectSeparator     = ";"
+)
+
+var requiredImportColumns = []string{
+	importColumnFirstName, importColumnLastName, importColumnEmail, importColumnYear, importColumnGroup, importColumnSpecialization,
+}
+
+func ValidateImportFormat(format string) error {
+	if format != ImportFormatCSV && format != ImportFormatXLSX {
+		return fmt.Errorf("unknown import format '%s'", format)
+	}
+
+	return nil
+}
+
+// ReadImportRows reads a class list sent as CSV or XLSX. The first row has to be the header.
+func ReadImportRows(data []byte, format string) ([][]string, error) {
+	if format == ImportFormatXLSX {
+		return ReadXLSX(data)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	return reader.ReadAll()
+}
+
+// ParseStudentImport maps the rows of a class list to students using its header, which is matched without
+// case, spaces or underscores, so "First Name" and "first_name" both fill the first name. Subjects are
+// separated by semicolons and the faculty is only needed to create a missing specialization. Rows are
+// numbered as in the file and empty rows are skipped. Every row gets the errors found without looking at
+// the database, and a header missing a required column fails the whole import.
+func ParseStudentImport(rows [][]string) ([]repositories.ImportedStudent, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("import file is empty")
+	}
+
+	columns := make(map[string]int)
+	for index, name := range rows[0] {
+		name = strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name))
+		columns[name] = index
+	}
+	for _, column := range requiredImportColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("import file has no '%s' column", column)
+		}
+	}
+
+	var students []repositories.ImportedStudent
+	emails := make(map[string]int)
+	for index, row := range rows[1:] {
+		cell := func(column string) string {
+			columnIndex, ok := columns[column]
+			if !ok || columnIndex >= len(row) {
+				return EmptyStringParameter
+			}
+
+			return strings.TrimSpace(row[columnIndex])
+		}
+		if strings.TrimSpace(strings.Join(row, EmptyStringParameter)) == EmptyStringParameter {
+			continue
+		}
+
+		imported := repositories.ImportedStudent{
+			Row: index + 2,
+			Student: repositories.Student{
+				User: repositories.User{
+					FirstName: cell(importColumnFirstName),
+					LastName:  cell(importColumnLastName),
+					Email:     cell(importColumnEmail),
+					Faculty:   cell(importColumnFaculty),
+					Subjects:  []string{},
+				},
+				Year:           cell(importColumnYear),
+				Specialization: cell(importColumnSpecialization),
+			},
+			Errors: []string{},
+		}
+		for _, subject := range strings.Split(cell(importColumnSubjects), importSubjectSeparator) {
+			if subject = strings.TrimSpace(subject); subject != EmptyStringParameter {
+				imported.Student.Subjects = append(imported.Student.Subjects, subject)
+			}
+		}
+
+		for _, column := range requiredImportColumns {
+			if cell(column) == EmptyStringParameter {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("'%s' is missing", column))
+			}
+		}
+		if email := imported.Student.Email; email != EmptyStringParameter {
+			address, err := mail.ParseAddress(email)
+			if err != nil || address.Address != email {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("'%s' is not a valid email address", email))
+			}
+			if previousRow, ok := emails[strings.ToLower(email)]; ok {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("email '%s' is already used on row %d", email, previousRow))
+			} else {
+				emails[strings.ToLower(email)] = imported.Row
+			}
+		}
+		if group := cell(importColumnGroup); group != EmptyStringParameter {
+			gID, err := strconv.Atoi(group)
+			if err != nil || gID <= 0 {
+				imported.Errors = append(imported.Errors, fmt.Sprintf("group '%s' is not a group number", group))
+			}
+			imported.Student.Group = gID
+		}
+
+		students = append(students, imported)
+	}
+
+	return students, nil
+}
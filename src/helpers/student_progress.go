@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"sort"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	rollingAverageWindow = 3
+)
+
+// GroupGrade is one graded submission of a student from the group of the student asking for progress.
+type GroupGrade struct {
+	StudentID  int
+	Subject    string
+	TestID     int
+	TestName   string
+	Timestamp  int
+	Grade      int
+	Points     int
+	Percentage float64
+}
+
+// CalculateStudentProgress builds the per subject timeline of a student out of the grades of their
+// whole group. Grades are percentages of the test points, the same scale as AverageGrade and the
+// objective targets.
+func CalculateStudentProgress(studentID int, groupGrades []GroupGrade, objectives []repositories.Objective) []repositories.SubjectProgress {
+	gradesBySubject := make(map[string][]GroupGrade)
+	var subjects []string
+	for _, grade := range groupGrades {
+		if grade.StudentID != studentID {
+			continue
+		}
+		if _, ok := gradesBySubject[grade.Subject]; !ok {
+			subjects = append(subjects, grade.Subject)
+		}
+		gradesBySubject[grade.Subject] = append(gradesBySubject[grade.Subject], grade)
+	}
+	sort.Strings(subjects)
+
+	progress := []repositories.SubjectProgress{}
+	for _, subject := range subjects {
+		grades := gradesBySubject[subject]
+		sort.Slice(grades, func(i, j int) bool { return grades[i].Timestamp < grades[j].Timestamp })
+
+		subjectProgress := repositories.SubjectProgress{
+			Subject:    subject,
+			Timeline:   []repositories.ProgressPoint{},
+			Objectives: []repositories.ObjectiveProgress{},
+		}
+
+		var percentages []float64
+		for _, grade := range grades {
+			percentages = append(percentages, grade.Percentage)
+			window := percentages
+			if len(window) > rollingAverageWindow {
+				window = window[len(window)-rollingAverageWindow:]
+			}
+
+			subjectProgress.Timeline = append(subjectProgress.Timeline, repositories.ProgressPoint{
+				TestID:          grade.TestID,
+				TestName:        grade.TestName,
+				Timestamp:       grade.Timestamp,
+				Grade:           grade.Grade,
+				Points:          grade.Points,
+				Percentage:      grade.Percentage,
+				RollingAverage:  getMean(window),
+				GroupPercentile: getPercentile(grade.Percentage, getTestPercentages(groupGrades, grade.TestID)),
+			})
+		}
+
+		subjectProgress.Average = getMean(percentages)
+		subjectProgress.GroupPercentile = getPercentile(subjectProgress.Average, getSubjectAverages(groupGrades, subject))
+
+		for _, objective := range objectives {
+			if objective.Subject == subject {
+				subjectProgress.Objectives = append(subjectProgress.Objectives, getObjectiveProgress(objective, grades))
+			}
+		}
+
+		progress = append(progress, subjectProgress)
+	}
+
+	return progress
+}
+
+func getObjectiveProgress(objective repositories.Objective, grades []GroupGrade) repositories.ObjectiveProgress {
+	var percentages []float64
+	for _, grade := range grades {
+		if grade.Timestamp >= objective.StartTimestamp && grade.Timestamp <= objective.EndTimestamp {
+			percentages = append(percentages, grade.Percentage)
+		}
+	}
+
+	objectiveProgress := repositories.ObjectiveProgress{
+		ObjectiveID:    objective.ID,
+		TargetGrade:    objective.TargetGrade,
+		StartTimestamp: objective.StartTimestamp,
+		EndTimestamp:   objective.EndTimestamp,
+	}
+	if len(percentages) > 0 {
+		objectiveProgress.Average = getMean(percentages)
+		objectiveProgress.Difference = objectiveProgress.Average - float64(objective.TargetGrade)
+	}
+
+	return objectiveProgress
+}
+
+func getTestPercentages(groupGrades []GroupGrade, testID int) []float64 {
+	var percentages []float64
+	for _, grade := range groupGrades {
+		if grade.TestID == testID {
+			percentages = append(percentages, grade.Percentage)
+		}
+	}
+
+	return percentages
+}
+
+func getSubjectAverages(groupGrades []GroupGrade, subject string) []float64 {
+	studentPercentages := make(map[int][]float64)
+	for _, grade := range groupGrades {
+		if grade.Subject == subject {
+			studentPercentages[grade.StudentID] = append(studentPercentages[grade.StudentID], grade.Percentage)
+		}
+	}
+
+	var averages []float64
+	for _, percentages := range studentPercentages {
+		averages = append(averages, getMean(percentages))
+	}
+
+	return averages
+}
+
+// getPercentile returns the share of values below the given one, counting ties as half.
+func getPercentile(value float64, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	below := 0.0
+	for _, other := range values {
+		if other < value {
+			below++
+		} else if other == value {
+			below += 0.5
+		}
+	}
+
+	return below * 100 / float64(len(values))
+}
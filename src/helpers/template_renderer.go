@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"gopkg.in/gographics/imagick.v2/imagick"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	TemplateStatusPending = "pending"
+	TemplateStatusReady   = "ready"
+	TemplateStatusFailed  = "failed"
+
+	templateQueueSize = 64
+)
+
+type TemplateJob struct {
+	Test  repositories.Test
+	Style repositories.TemplateStyle
+	// OnDone is called from the renderer with a session of its own, since the request that queued
+	// the job has usually finished by then.
+	OnDone func(session neo4j.Session, test repositories.Test, err error) error
+
+	file *templateFileRequest
+}
+
+// templateFileRequest asks the renderer for a single file, which it sends back instead of saving.
+type templateFileRequest struct {
+	format     string
+	resolution int
+	result     chan templateFileResult
+}
+
+type templateFileResult struct {
+	file repositories.TemplateFile
+	err  error
+}
+
+// TemplateRenderer generates test templates in the background. ImageMagick is initialised once when
+// the renderer is created and terminated when it is closed, so every conversion has to go through it.
+type TemplateRenderer struct {
+	driver    neo4j.Driver
+	s3Bucket  string
+	s3Region  string
+	s3Profile string
+	logger    *log.Logger
+	jobs      chan TemplateJob
+	wg        sync.WaitGroup
+	// mu guards closed, so no job is sent on the channel after Close has closed it.
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewTemplateRenderer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) *TemplateRenderer {
+	imagick.Initialize()
+
+	renderer := &TemplateRenderer{
+		driver:    driver,
+		s3Bucket:  s3Bucket,
+		s3Region:  s3Region,
+		s3Profile: s3Profile,
+		logger:    logger,
+		jobs:      make(chan TemplateJob, templateQueueSize),
+	}
+
+	renderer.wg.Add(1)
+	go renderer.run()
+
+	return renderer
+}
+
+func (tr *TemplateRenderer) Enqueue(job TemplateJob) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.closed {
+		return fmt.Errorf("template renderer is shutting down")
+	}
+
+	select {
+	case tr.jobs <- job:
+		return nil
+	default:
+		return fmt.Errorf("template queue is full")
+	}
+}
+
+// RenderFile generates a single template file while the caller waits for it. It is queued like every
+// other job, so it waits for the templates queued before it.
+func (tr *TemplateRenderer) RenderFile(test repositories.Test, style repositories.TemplateStyle, format string, resolution int) (repositories.TemplateFile, error) {
+	result := make(chan templateFileResult, 1)
+	err := tr.Enqueue(TemplateJob{
+		Test:  test,
+		Style: style,
+		file:  &templateFileRequest{format: format, resolution: resolution, result: result},
+	})
+	if err != nil {
+		return repositories.TemplateFile{}, err
+	}
+
+	rendered := <-result
+
+	return rendered.file, rendered.err
+}
+
+func (tr *TemplateRenderer) DownloadFile(fileURL string) ([]byte, error) {
+	return DownloadTemplateFromS3(tr.s3Bucket, tr.s3Region, tr.s3Profile, fileURL)
+}
+
+func (tr *TemplateRenderer) Close() {
+	tr.mu.Lock()
+	tr.closed = true
+	close(tr.jobs)
+	tr.mu.Unlock()
+
+	tr.wg.Wait()
+	imagick.Terminate()
+}
+
+func (tr *TemplateRenderer) run() {
+	defer tr.wg.Done()
+
+	for job := range tr.jobs {
+		err := tr.render(job)
+		if err != nil {
+			tr.logger.Printf("could not save template for test %d: %s", job.Test.ID, err.Error())
+		}
+	}
+}
+
+func (tr *TemplateRenderer) render(job TemplateJob) error {
+	if job.file != nil {
+		file, err := GenerateTemplateFile(job.Test, job.Style, job.file.format, job.file.resolution, tr.s3Bucket, tr.s3Region, tr.s3Profile, tr.logger)
+		job.file.result <- templateFileResult{file: file, err: err}
+
+		return nil
+	}
+
+	test, renderErr := GenerateTestTemplate(job.Test, job.Style, tr.s3Bucket, tr.s3Region, tr.s3Profile, tr.logger)
+	if renderErr != nil {
+		tr.logger.Printf("could not generate template for test %d: %s", job.Test.ID, renderErr.Error())
+	} else {
+		tr.logger.Printf("generated template for test %d at %s", test.ID, test.TemplateImageURL)
+	}
+
+	session, err := GetNeo4jSession(tr.driver)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return job.OnDone(session, test, renderErr)
+}
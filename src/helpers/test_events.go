@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	TestEventGraded    = "graded"
+	TestEventFailed    = "failed"
+	TestEventCorrected = "corrected"
+	TestEventDisputed  = "disputed"
+
+	testEventBufferSize = 16
+)
+
+// TestEventBroker hands the grading events of a test to everybody following it. Events are dropped
+// for subscribers that do not keep up rather than holding up grading.
+type TestEventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[int]map[chan repositories.TestEvent]struct{}
+}
+
+func NewTestEventBroker() *TestEventBroker {
+	return &TestEventBroker{
+		subscribers: make(map[int]map[chan repositories.TestEvent]struct{}),
+	}
+}
+
+// Subscribe returns the events of the test along with the function that stops them.
+func (b *TestEventBroker) Subscribe(testID int) (<-chan repositories.TestEvent, func()) {
+	events := make(chan repositories.TestEvent, testEventBufferSize)
+
+	b.mutex.Lock()
+	if b.subscribers[testID] == nil {
+		b.subscribers[testID] = make(map[chan repositories.TestEvent]struct{})
+	}
+	b.subscribers[testID][events] = struct{}{}
+	b.mutex.Unlock()
+
+	return events, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		delete(b.subscribers[testID], events)
+		if len(b.subscribers[testID]) == 0 {
+			delete(b.subscribers, testID)
+		}
+	}
+}
+
+func (b *TestEventBroker) Publish(event repositories.TestEvent) {
+	if event.Timestamp == 0 {
+		event.Timestamp = int(time.Now().Unix())
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for events := range b.subscribers[event.TestID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/DataDog/go-python3"
@@ -12,8 +15,14 @@ import (
 	"qbot_webserver/src/repositories"
 )
 
-func GradeTestImage(logger *log.Logger, session neo4j.Session, teacherID int, test repositories.CompletedTest,
-	s3Bucket string, s3Region string, s3Profile string,
+const (
+	TestPublicationDraft     = "draft"
+	TestPublicationGraded    = "graded"
+	TestPublicationPublished = "published"
+)
+
+func GradeTestImage(logger *log.Logger, driver neo4j.Driver, teacherID int, test repositories.CompletedTest,
+	s3Bucket string, s3Region string, s3Profile string, dispatcher *NotificationDispatcher, events *TestEventBroker,
 ) {
 	var err error
 	attempts := 3
@@ -27,8 +36,27 @@ func GradeTestImage(logger *log.Logger, session neo4j.Session, teacherID int, te
 		}
 	}
 	if err != nil {
+		events.Publish(repositories.TestEvent{
+			Type:         TestEventFailed,
+			TestID:       test.ID,
+			StudentEmail: test.Author.Email,
+			Error:        err.Error(),
+		})
+		return
+	}
+
+	session, err := GetNeo4jSession(driver)
+	if err != nil {
+		logger.Printf("grading error for test %d: could not open session: %s", test.ID, err.Error())
+		events.Publish(repositories.TestEvent{
+			Type:         TestEventFailed,
+			TestID:       test.ID,
+			StudentEmail: test.Author.Email,
+			Error:        err.Error(),
+		})
 		return
 	}
+	defer session.Close()
 
 	answerString, err := GetStringFromAnswerMap(test.Answers)
 	if err != nil {
@@ -36,11 +64,15 @@ func GradeTestImage(logger *log.Logger, session neo4j.Session, teacherID int, te
 	}
 
 	query := fmt.Sprintf(`
-		MATCH (s:Student {email:'%s'}), (t:Test {testID:$testID})-[tp:ADDED_BY]->(p:Teacher {ID:$teacherID})
-		MERGE (s)-[st:COMPLETED]->(t)
-		SET st.grade = $grade, st.timestamp = $timestamp, st.gradedTestImage = $gradedTestImage,
-				st.testImage = $testImage, st.notificationMessage = '%s', st.answers = '%s'
-	`, test.Author.Email, TestGradedNotification, answerString)
+		MATCH (s:Student {email:'%s'}), (t:Test {testID:$testID})-[tp:ADDED_BY]->(p:Teacher {ID:$teacherID}) 
+		OPTIONAL MATCH (s)-[old:COMPLETED]->(t) 
+		WITH s, t, old IS NOT NULL AS regraded, toString(old.grade) AS oldGrade 
+		MERGE (s)-[st:COMPLETED]->(t) 
+		SET st.grade = $grade, st.timestamp = $timestamp, st.gradedTestImage = $gradedTestImage, 
+				st.testImage = $testImage, st.answers = '%s', 
+			t.publication = CASE WHEN t.publication = $draft THEN $graded ELSE t.publication END 
+		RETURN s.ID, regraded, oldGrade
+	`, test.Author.Email, answerString)
 	params := map[string]interface{}{
 		"testID":          test.ID,
 		"teacherID":       teacherID,
@@ -48,21 +80,115 @@ func GradeTestImage(logger *log.Logger, session neo4j.Session, teacherID int, te
 		"timestamp":       time.Now().Unix(),
 		"gradedTestImage": test.GradedTestImageURL,
 		"testImage":       test.TestImageURL,
+		"draft":           TestPublicationDraft,
+		"graded":          TestPublicationGraded,
 	}
 
-	err = WriteTX(session, query, params)
+	_, err = session.WriteTransaction(func(tx neo4j.Transaction) (interface{}, error) {
+		return nil, saveGrade(tx, query, params, teacherID, test)
+	})
 	if err != nil {
 		logger.Printf("grading error for test %d: transaction failed: %s", test.ID, err.Error())
+		events.Publish(repositories.TestEvent{
+			Type:         TestEventFailed,
+			TestID:       test.ID,
+			StudentEmail: test.Author.Email,
+			Error:        err.Error(),
+		})
+		return
+	}
+
+	events.Publish(repositories.TestEvent{
+		Type:         TestEventGraded,
+		TestID:       test.ID,
+		StudentEmail: test.Author.Email,
+		Grade:        test.Grade,
+	})
+
+	// Students only hear about their grade here once the test is published, until then the
+	// release notifies them.
+	err = dispatcher.Notify(session, `
+		MATCH (t:Test {testID:$testID}) 
+		MATCH (u) 
+		WHERE (u:Teacher AND u.ID = $teacherID) OR 
+			(u:Student AND u.email = $email AND coalesce(t.publication, $published) = $published)
+	`, map[string]interface{}{
+		"testID":    test.ID,
+		"email":     test.Author.Email,
+		"teacherID": teacherID,
+		"published": TestPublicationPublished,
+	}, repositories.Notification{
+		Type:    NotificationTypeTestGraded,
+		Message: TestGradedNotification,
+		Payload: repositories.NotificationPayload{
+			TestID: test.ID,
+			Grade:  test.Grade,
+		},
+	})
+	if err != nil {
+		logger.Printf("grading error for test %d: could not add notifications: %s", test.ID, err.Error())
+	}
+}
+
+// saveGrade stores the grade of a scanned test. Grading a scan of a test the student already has a grade for
+// replaces that grade, which is recorded in the audit log as a change by the teacher.
+func saveGrade(tx neo4j.Transaction, query string, params map[string]interface{}, teacherID int, test repositories.CompletedTest) error {
+
+	fmt.Printf("query: %s\nparams: %+v\n", query, params)
+
+	records, err := tx.Run(query, params)
+	if err != nil {
+		return err
 	}
+	if !records.Next() {
+		return records.Err()
+	}
+	record := records.Record()
+	studentID, err := GetIntParameterFromQuery(record, "s.ID", true, true)
+	if err != nil {
+		return err
+	}
+	regraded, err := GetBoolParameterFromQuery(record, "regraded", true, true)
+	if err != nil {
+		return err
+	}
+	oldGrade, err := GetStringParameterFromQuery(record, "oldGrade", true, false)
+	if err != nil {
+		return err
+	}
+	_, err = records.Consume()
+	if err != nil || !regraded {
+		return err
+	}
+
+	return CreateAuditEntry(tx, `
+		MATCH (a:Teacher {ID:$teacherID}) 
+		WITH a, $teacherType AS actorType, $testID AS entityID
+	`, map[string]interface{}{
+		"teacherID":   teacherID,
+		"teacherType": repositories.TeacherType,
+		"testID":      test.ID,
+	}, repositories.AuditEntry{
+		Action:     AuditActionGradeChange,
+		EntityType: AuditEntityTest,
+		EntityID:   test.ID,
+		StudentID:  studentID,
+		Before:     oldGrade,
+		After:      strconv.Itoa(test.Grade),
+		Details:    "scan graded again",
+	})
 }
 
 func runPythonScriptToGrade(test repositories.CompletedTest, s3Bucket string, s3Region string, s3Profile string) (repositories.CompletedTest, error) {
 	if !python3.Py_IsInitialized() {
 		python3.Py_Initialize()
 	}
-	python3.PyRun_SimpleString(getGradingScript(
-		test, s3Bucket, s3Region, s3Profile,
-	))
+	gradingInput, err := getGradingInput(test, s3Bucket, s3Region, s3Profile)
+	if err != nil {
+		return test, fmt.Errorf("grading error for test %d: could not encode grading input: %s\n", test.ID, err.Error())
+	}
+
+	python3.PyRun_SimpleString(getGradingScript(gradingInput))
 
 	evalModule := python3.PyImport_AddModule("__main__")
 	evalDict := python3.PyModule_GetDict(evalModule)
@@ -115,9 +241,56 @@ func runPythonScriptToGrade(test repositories.CompletedTest, s3Bucket string, s3
 	return test, nil
 }
 
-func getGradingScript(test repositories.CompletedTest, s3Bucket string, s3Region string, s3Profile string) string {
+// gradingInput holds the values handed to find_rotated_perspective_answers. They
+// reach the script as base64 encoded JSON, so nothing taken from tests or styles
+// is ever pasted into the Python source.
+type gradingInput struct {
+	ImageURL        string                       `json:"image_url"`
+	TemplateURL     string                       `json:"template_url"`
+	Layout          *repositories.TemplateLayout `json:"layout"`
+	CorrectAnswers  [][]string                   `json:"correct_answers"`
+	NrQuestions     int                          `json:"nr_questions"`
+	NrAnswers       int                          `json:"nr_answers"`
+	MultipleAnswers bool                         `json:"multiple_answers"`
+	PartialScoring  bool                         `json:"partial_scoring"`
+	TotalPoints     int                          `json:"total_points"`
+	ExOfficio       int                          `json:"ex_officio"`
+	S3Bucket        string                       `json:"s3_bucket"`
+	S3Region        string                       `json:"s3_region"`
+	S3Profile       string                       `json:"s3_profile"`
+}
+
+func getGradingInput(test repositories.CompletedTest, s3Bucket string, s3Region string, s3Profile string) (string, error) {
+	input := gradingInput{
+		ImageURL:        test.TestImageURL,
+		TemplateURL:     test.Test.TemplateImageURL,
+		CorrectAnswers:  getListOfListsFromMap(test.Test.CorrectAnswers),
+		NrQuestions:     test.Test.NrQuestions,
+		NrAnswers:       test.Test.NrAnswerOptions,
+		MultipleAnswers: test.Test.MultipleAnswersAllowed,
+		PartialScoring:  test.Test.EnablePartialScoring,
+		TotalPoints:     test.Test.TotalPoints,
+		ExOfficio:       test.Test.ExOfficioPoints,
+		S3Bucket:        s3Bucket,
+		S3Region:        s3Region,
+		S3Profile:       s3Profile,
+	}
+	if len(test.Test.TemplateLayout.Cells) > 0 {
+		input.Layout = &test.Test.TemplateLayout
+	}
+
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(inputJSON), nil
+}
+
+func getGradingScript(gradingInput string) string {
 	return fmt.Sprintf(`
 
+import base64
 import json
 import math
 import os
@@ -244,44 +417,129 @@ def find_table(grayscale_image, threshold_mean_difference, threshold_min_differe
                        cv.FONT_HERSHEY_COMPLEX, 0.55, (0, 0, 0), 1)
             cv.rectangle(color_image, (x_min, y_min), (x_max, y_max), color=(211, 211, 211), thickness=line_thickness)
 
-        if not multiple_answers:
-            if len(answers_considered) == 1:
-                choice = answers_considered[0][0]
-                complete_choice = answers_considered[0]
-            elif len(answers_considered) == 0:
-                choice = -1
-            else:
-                min_mean_patch = answers_considered[0]
-                max_mean_patch = answers_considered[0]
-
-                for answer in answers_considered:
-                    if answer[1] < min_mean_patch[1]:
-                        min_mean_patch = answer
-                    elif answer[1] > max_mean_patch[1]:
-                        max_mean_patch = answer
-
-                if max_mean_patch[1] - min_mean_patch[1] >= threshold_min_difference_for_choice:
-                    choice = min_mean_patch[0]
-                    complete_choice = min_mean_patch
-                else:
-                    choice = -1
+        answers.append(choose_answers(color_image, answers_considered, threshold_min_difference_for_choice,
+                                      multiple_answers, line_thickness))
+
+    return answers, color_image
 
-            answers.append([choice_nr_to_answer(choice)])
 
-            if choice != -1:
-                cv.rectangle(color_image, complete_choice[2], complete_choice[3], color=(0, 200, 0),
-                             thickness=line_thickness)
+def choose_answers(color_image, answers_considered, threshold_min_difference_for_choice, multiple_answers,
+                   line_thickness):
+    if not multiple_answers:
+        if len(answers_considered) == 1:
+            choice = answers_considered[0][0]
+            complete_choice = answers_considered[0]
+        elif len(answers_considered) == 0:
+            choice = -1
         else:
-            current_answers = []
-            for complete_choice in answers_considered:
-                cv.rectangle(color_image, complete_choice[2], complete_choice[3], color=(0, 200, 0),
-                             thickness=line_thickness)
+            min_mean_patch = answers_considered[0]
+            max_mean_patch = answers_considered[0]
+
+            for answer in answers_considered:
+                if answer[1] < min_mean_patch[1]:
+                    min_mean_patch = answer
+                elif answer[1] > max_mean_patch[1]:
+                    max_mean_patch = answer
+
+            if max_mean_patch[1] - min_mean_patch[1] >= threshold_min_difference_for_choice:
+                choice = min_mean_patch[0]
+                complete_choice = min_mean_patch
+            else:
+                choice = -1
 
-                current_answers.append(choice_nr_to_answer(complete_choice[0]))
+        if choice != -1:
+            cv.rectangle(color_image, complete_choice[2], complete_choice[3], color=(0, 200, 0),
+                         thickness=line_thickness)
 
-            answers.append(current_answers)
+        return [choice_nr_to_answer(choice)]
 
-    return answers, color_image
+    current_answers = []
+    for complete_choice in answers_considered:
+        cv.rectangle(color_image, complete_choice[2], complete_choice[3], color=(0, 200, 0),
+                     thickness=line_thickness)
+
+        current_answers.append(choice_nr_to_answer(complete_choice[0]))
+
+    return current_answers
+
+
+# layout coordinates are in millimetres on the printed page, the aligned image covers the whole page
+def layout_to_pixels(region, layout, image_shape):
+    image_height, image_width = image_shape[:2]
+    scale_x = image_width / layout['pageWidth']
+    scale_y = image_height / layout['pageHeight']
+
+    x_min = int(region['x'] * scale_x)
+    y_min = int(region['y'] * scale_y)
+    x_max = int((region['x'] + region['width']) * scale_x)
+    y_max = int((region['y'] + region['height']) * scale_y)
+
+    return x_min, y_min, x_max, y_max
+
+
+def get_layout_region(layout, regions_key, name):
+    for region in layout[regions_key]:
+        if region['name'] == name:
+            return region
+
+    return None
+
+
+def find_layout_answers(grayscale_image, layout, threshold_mean_difference, threshold_min_difference_for_choice,
+                        nr_questions, multiple_answers=False):
+    line_thickness = 2
+    padding = 0.25
+
+    mean_color = grayscale_image.mean(axis=0).mean(axis=0)
+    color_image = np.dstack((grayscale_image, grayscale_image, grayscale_image))
+
+    cells_by_question = {}
+    for cell in layout['cells']:
+        cells_by_question.setdefault(cell['question'], []).append(cell)
+
+    answers = []
+
+    for question in range(nr_questions):
+        answers_considered = []
+        cells = sorted(cells_by_question.get(question, []), key=lambda c: c['option'])
+
+        for cell in cells:
+            x_min, y_min, x_max, y_max = layout_to_pixels(cell, layout, grayscale_image.shape)
+            x_window = (x_max - x_min) * padding
+            y_window = (y_max - y_min) * padding
+            x_min, x_max = int(x_min + x_window), int(x_max - x_window)
+            y_min, y_max = int(y_min + y_window), int(y_max - y_window)
+
+            patch = grayscale_image[y_min:y_max, x_min:x_max]
+            mean_patch = np.round(patch.mean())
+            choice = ord(cell['option']) - 65
+
+            if mean_color - mean_patch > threshold_mean_difference:
+                answers_considered.append((choice, mean_patch, (x_min, y_min), (x_max, y_max)))
+
+            cv.rectangle(color_image, (x_min, y_min), (x_max, y_max), color=(211, 211, 211), thickness=line_thickness)
+
+        answers.append(choose_answers(color_image, answers_considered, threshold_min_difference_for_choice,
+                                      multiple_answers, line_thickness))
+
+    tables = [layout_to_pixels(table, layout, grayscale_image.shape) for table in layout['tables']]
+    x_min = min(table[0] for table in tables)
+    y_min = min(table[1] for table in tables)
+    x_max = max(table[2] for table in tables)
+    y_max = max(table[3] for table in tables)
+
+    return answers, color_image[y_min:y_max, x_min:x_max]
+
+
+def get_layout_email_area(image, layout, normalize_kernel):
+    image = normalize(image, normalize_kernel)
+    email_region = get_layout_region(layout, 'header', 'email')
+    x_min, y_min, x_max, y_max = layout_to_pixels(email_region, layout, image.shape)
+
+    # handwriting rarely stays on the line, so look at half a row above and below it
+    y_window = (y_max - y_min) // 2
+
+    return image, image[max(y_min - y_window, 0):y_max + y_window, x_min:x_max]
 
 
 def get_image_name(image_name):
@@ -353,7 +611,7 @@ def get_image_areas(image, normalize_kernel):
     return left_image, right_image, header
 
 
-def get_tables(image, template, orb, matcher, normalize_kernel):
+def align_to_template(image, template, orb, matcher):
     key_point_template, descriptor_template = orb.detectAndCompute(template, None)
     key_point_image, descriptor_image = orb.detectAndCompute(image, None)
 
@@ -370,18 +628,16 @@ def get_tables(image, template, orb, matcher, normalize_kernel):
     homography, mask = cv.findHomography(points_image, points_template, cv.RANSAC)
 
     height, width, _ = template.shape
-    aligned_image = cv.warpPerspective(image, homography, (width, height), flags=cv.INTER_NEAREST)
 
-    return get_image_areas(aligned_image, normalize_kernel)
+    return cv.warpPerspective(image, homography, (width, height), flags=cv.INTER_NEAREST)
 
 
-def send_image_to_s3(image_url, table_left, table_right, s3_bucket, s3_region, s3_profile):
+def send_image_to_s3(image_url, graded_image, s3_bucket, s3_region, s3_profile):
     image_name = get_image_name(image_url)
     graded_image_name = get_image_name_prefix(str(image_name)) + "_graded.png"
     s3_graded_image_path = 'test_graded/' + graded_image_name
 
-    h_img = cv.hconcat([table_left, table_right])
-    cv.imwrite(graded_image_name, h_img)
+    cv.imwrite(graded_image_name, graded_image)
 
     session = boto3.Session(profile_name=s3_profile)
     client = session.client('s3', s3_region)
@@ -493,7 +749,7 @@ def find_page_contours(edges):
     return contour_offset(page_contour, (-5, -5))
 
 
-def persp_transform(img, s_points):
+def persp_transform(img, s_points, crop=True):
     # Euclidean distance - calculate maximum height and width
     height = max(np.linalg.norm(s_points[0] - s_points[1]),
                  np.linalg.norm(s_points[2] - s_points[3]))
@@ -513,13 +769,105 @@ def persp_transform(img, s_points):
     M = cv.getPerspectiveTransform(s_points, t_points)
 
     img = cv.warpPerspective(img, M, (int(width), int(height)))
+    if not crop:
+        return img
+
     image_height, image_width, _ = img.shape
     img = img[int(image_height * 0.015):int(image_height * 0.985), int(image_width * 0.015):int(image_width * 0.985)]
 
     return img
 
 
-def find_rotated_perspective_answers(image_url, template_url, correct_answers, nr_questions, nr_answers,
+def align_image(image, template, align, crop=True):
+    if align:
+        orb = cv.ORB_create(nfeatures=1000)
+        bf = cv.BFMatcher(cv.NORM_HAMMING, crossCheck=True)
+
+        return align_to_template(image, template, orb, bf)
+
+    edges_image = edges_det(image, 200, 250)
+
+    # Close gaps between edges (double page close => rectangle kernel)
+    edges_image = cv.morphologyEx(edges_image, cv.MORPH_CLOSE, np.ones((5, 11)))
+
+    page_contour = find_page_contours(edges_image)
+
+    return persp_transform(image, page_contour, crop)
+
+
+def find_fiducials(image):
+    gray = cv.cvtColor(image, cv.COLOR_RGB2GRAY)
+    gray = cv.GaussianBlur(gray, (5, 5), 0)
+    _, binary = cv.threshold(gray, 0, 255, cv.THRESH_BINARY_INV + cv.THRESH_OTSU)
+
+    contours, hierarchy = cv.findContours(binary, cv.RETR_TREE, cv.CHAIN_APPROX_SIMPLE)
+    if hierarchy is None:
+        return []
+
+    hierarchy = hierarchy[0]
+    candidates = []
+
+    for index, cnt in enumerate(contours):
+        perimeter = cv.arcLength(cnt, True)
+        approx = cv.approxPolyDP(cnt, 0.05 * perimeter, True)
+        if len(approx) != 4 or not cv.isContourConvex(approx):
+            continue
+
+        # a finder pattern is a square holding a square holding a square
+        child = hierarchy[index][2]
+        if child == -1 or hierarchy[child][2] == -1:
+            continue
+
+        outer_area = cv.contourArea(approx)
+        inner_area = cv.contourArea(contours[hierarchy[child][2]])
+        if outer_area == 0 or not 0.08 < inner_area / outer_area < 0.35:
+            continue
+
+        moments = cv.moments(cnt)
+        if moments['m00'] == 0:
+            continue
+
+        candidates.append((moments['m10'] / moments['m00'], moments['m01'] / moments['m00']))
+
+    return candidates
+
+
+def align_to_fiducials(image, template, layout):
+    if not layout.get('fiducials'):
+        return None
+
+    candidates = find_fiducials(image)
+    if len(candidates) < 4:
+        return None
+
+    image_height, image_width, _ = image.shape
+    image_corners = {
+        'topLeft': (0, 0),
+        'topRight': (image_width, 0),
+        'bottomRight': (image_width, image_height),
+        'bottomLeft': (0, image_height),
+    }
+
+    height, width, _ = template.shape
+    source_points = []
+    target_points = []
+
+    for fiducial in layout['fiducials']:
+        corner = image_corners[fiducial['name']]
+        closest = min(candidates, key=lambda point: (point[0] - corner[0]) ** 2 + (point[1] - corner[1]) ** 2)
+        if closest in source_points:
+            return None
+
+        x_min, y_min, x_max, y_max = layout_to_pixels(fiducial, layout, template.shape)
+        source_points.append(closest)
+        target_points.append(((x_min + x_max) / 2, (y_min + y_max) / 2))
+
+    M = cv.getPerspectiveTransform(np.array(source_points, np.float32), np.array(target_points, np.float32))
+
+    return cv.warpPerspective(image, M, (width, height))
+
+
+def find_rotated_perspective_answers(image_url, template_url, layout, correct_answers, nr_questions, nr_answers,
                                      multiple_answers, partial_scoring, total_points, ex_officio, s3_bucket, s3_region,
                                      s3_profile, align=True):
     # current_image = cv.imread("test.png")
@@ -532,39 +880,39 @@ def find_rotated_perspective_answers(image_url, template_url, correct_answers, n
     template = cv.blur(template, (3, 3))
     template = cv.cvtColor(template, cv.COLOR_BGR2RGB)
 
-    orb = cv.ORB_create(nfeatures=1000)
-    bf = cv.BFMatcher(cv.NORM_HAMMING, crossCheck=True)
     normalize_kernel = cv.getStructuringElement(cv.MORPH_ELLIPSE, (50, 50))
 
-    if align:
-        left_image, right_image, student_email_area = get_tables(current_image, template, orb, bf, normalize_kernel)
-    else:
-        edges_image = edges_det(current_image, 200, 250)
-
-        # Close gaps between edges (double page close => rectangle kernel)
-        edges_image = cv.morphologyEx(edges_image, cv.MORPH_CLOSE, np.ones((5, 11)))
+    if layout:
+        aligned_image = align_to_fiducials(current_image, template, layout)
+        if aligned_image is None:
+            aligned_image = align_image(current_image, template, align, crop=False)
+        normalized_image, student_email_area = get_layout_email_area(aligned_image, layout, normalize_kernel)
 
-        page_contour = find_page_contours(edges_image)
-        current_image = persp_transform(current_image, page_contour)
-
-        left_image, right_image, student_email_area = get_image_areas(current_image, normalize_kernel)
+        all_answers, graded_image = find_layout_answers(normalized_image, layout, 10, 5, nr_questions,
+                                                        multiple_answers)
+    else:
+        aligned_image = align_image(current_image, template, align)
+        left_image, right_image, student_email_area = get_image_areas(aligned_image, normalize_kernel)
 
-    answers_left, table_left = find_table(left_image, 10, 5, math.ceil(nr_questions / 2), nr_answers, multiple_answers)
-    answers_right, table_right = find_table(right_image, 10, 5, math.floor(nr_questions / 2), nr_answers,
-                                            multiple_answers)
-    all_answers = answers_left + answers_right
+        answers_left, table_left = find_table(left_image, 10, 5, math.ceil(nr_questions / 2), nr_answers,
+                                              multiple_answers)
+        answers_right, table_right = find_table(right_image, 10, 5, math.floor(nr_questions / 2), nr_answers,
+                                                multiple_answers)
+        all_answers = answers_left + answers_right
+        graded_image = cv.hconcat([table_left, table_right])
 
     # student_email = get_student_email(student_email_area)
     student_email = detect_email(student_email_area, s3_profile)
-    graded_image_link = send_image_to_s3(image_url, table_left, table_right, s3_bucket, s3_region, s3_profile)
+    graded_image_link = send_image_to_s3(image_url, graded_image, s3_bucket, s3_region, s3_profile)
     grade, percentage = calculate_grade(all_answers, correct_answers, multiple_answers, partial_scoring, total_points,
                                         ex_officio)
 
     return student_email, '"%%s"' %% all_answers, grade, percentage, graded_image_link
 
 
+grading_input = json.loads(base64.b64decode('%s'))
 student_email, answers, grade, percentage, graded_image_link = find_rotated_perspective_answers(
-	"%s", "%s", %v, %d, %d, %s, %s, %d, %d, "%s", "%s", "%s", False
+	**grading_input, align=False
 )
 
 #print(student_email)
@@ -573,30 +921,10 @@ student_email, answers, grade, percentage, graded_image_link = find_rotated_pers
 #print(percentage)
 #print(graded_image_link)
 
-	`, test.TestImageURL,
-		test.Test.TemplateImageURL,
-		getListOfListsFromMap(test.Test.CorrectAnswers),
-		test.Test.NrQuestions,
-		test.Test.NrAnswerOptions,
-		getPythonBoolean(test.Test.MultipleAnswersAllowed),
-		getPythonBoolean(test.Test.EnablePartialScoring),
-		test.Test.TotalPoints,
-		test.Test.ExOfficioPoints,
-		s3Bucket,
-		s3Region,
-		s3Profile,
-	)
+	`, gradingInput)
 }
 
-func getPythonBoolean(b bool) string {
-	if b {
-		return "True"
-	}
-
-	return "False"
-}
-
-func getListOfListsFromMap(inputMap map[int][]string) string {
+func getListOfListsFromMap(inputMap map[int][]string) [][]string {
 	keys := make([]int, len(inputMap))
 	i := 0
 	for k := range inputMap {
@@ -605,15 +933,10 @@ func getListOfListsFromMap(inputMap map[int][]string) string {
 	}
 	sort.Ints(keys)
 
-	listString := `[`
+	lists := make([][]string, 0, len(keys))
 	for _, k := range keys {
-		insideString := ``
-		for _, value := range inputMap[k] {
-			insideString += fmt.Sprintf("'%s',", value)
-		}
-		listString += fmt.Sprintf("[%s],", insideString)
+		lists = append(lists, append([]string{}, inputMap[k]...))
 	}
-	listString += `]`
 
-	return listString
+	return lists
 }
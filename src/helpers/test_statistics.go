@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+
+	"qbot_webserver/src/repositories"
+)
+
+const (
+	passPercentage = 50
+)
+
+// CalculateTestStats computes the grade distribution of a test and how every question behaved. Corrected
+// grades replace the graded ones and answers are compared by position, the same way the grader does.
+func CalculateTestStats(test repositories.Test, submissions []repositories.CompletedTest) repositories.TestStats {
+	stats := repositories.TestStats{
+		TestID:        test.ID,
+		NrSubmissions: len(submissions),
+		TotalPoints:   test.TotalPoints,
+		Histogram:     []repositories.GradeCount{},
+		PassThreshold: float64(test.TotalPoints) * passPercentage / 100,
+		Questions:     []repositories.QuestionStats{},
+	}
+
+	grades := make([]float64, len(submissions))
+	for i, submission := range submissions {
+		grades[i] = float64(GetFinalGrade(submission))
+	}
+
+	stats.Histogram = getGradeHistogram(grades, test.TotalPoints)
+	if len(grades) == 0 {
+		return stats
+	}
+
+	stats.Mean = getMean(grades)
+	stats.Median = getMedian(grades)
+	stats.StdDev = getStdDev(grades, stats.Mean)
+
+	// A test that does not have to be passed cannot be failed, so it has no pass rate.
+	if test.MandatoryToPass {
+		passed := 0
+		for _, grade := range grades {
+			if grade >= stats.PassThreshold {
+				passed++
+			}
+		}
+		passRate := percentOf(passed, len(grades))
+		stats.PassRate = &passRate
+	}
+
+	correctAnswers := getOrderedAnswers(test.CorrectAnswers)
+	for question, correctAnswer := range correctAnswers {
+		stats.Questions = append(stats.Questions, getQuestionStats(test, question, correctAnswer, submissions, grades, stats.Mean, stats.StdDev))
+	}
+
+	return stats
+}
+
+// GetFinalGrade returns the corrected grade of a submission when the teacher overwrote it.
+func GetFinalGrade(submission repositories.CompletedTest) int {
+	if submission.CorrectedGradeTimestamp != 0 {
+		return submission.CorrectedGrade
+	}
+
+	return submission.Grade
+}
+
+func getQuestionStats(test repositories.Test, question int, correctAnswer []string, submissions []repositories.CompletedTest,
+	grades []float64, mean float64, stdDev float64,
+) repositories.QuestionStats {
+	optionCounts := make(map[string]int, test.NrAnswerOptions)
+	for option := 1; option <= test.NrAnswerOptions; option++ {
+		optionCounts[string(rune('A'+option-1))] = 0
+	}
+
+	correct := make([]bool, len(submissions))
+	nrCorrect, nrBlank := 0, 0
+	for i, submission := range submissions {
+		answers := getOrderedAnswers(submission.Answers)
+		var answer []string
+		if question < len(answers) {
+			answer = answers[question]
+		}
+
+		if len(answer) == 0 {
+			nrBlank++
+		}
+		for _, option := range answer {
+			optionCounts[option]++
+		}
+		if isSameAnswer(answer, correctAnswer) {
+			correct[i] = true
+			nrCorrect++
+		}
+	}
+
+	optionFrequency := make(map[string]float64, len(optionCounts))
+	for option, count := range optionCounts {
+		optionFrequency[option] = percentOf(count, len(submissions))
+	}
+
+	return repositories.QuestionStats{
+		Question:        question + 1,
+		CorrectAnswers:  correctAnswer,
+		PercentCorrect:  percentOf(nrCorrect, len(submissions)),
+		PercentBlank:    percentOf(nrBlank, len(submissions)),
+		OptionFrequency: optionFrequency,
+		Discrimination:  getPointBiserial(correct, grades, mean, stdDev),
+	}
+}
+
+// getPointBiserial correlates answering a question correctly with the grade on the whole test. Questions
+// everybody (or nobody) got right do not discriminate at all.
+func getPointBiserial(correct []bool, grades []float64, mean float64, stdDev float64) float64 {
+	var correctGrades, wrongGrades []float64
+	for i, grade := range grades {
+		if correct[i] {
+			correctGrades = append(correctGrades, grade)
+		} else {
+			wrongGrades = append(wrongGrades, grade)
+		}
+	}
+	if stdDev == 0 || len(correctGrades) == 0 || len(wrongGrades) == 0 {
+		return 0
+	}
+
+	p := float64(len(correctGrades)) / float64(len(grades))
+
+	return (getMean(correctGrades) - getMean(wrongGrades)) / stdDev * math.Sqrt(p*(1-p))
+}
+
+func getGradeHistogram(grades []float64, totalPoints int) []repositories.GradeCount {
+	histogram := make([]repositories.GradeCount, totalPoints+1)
+	for grade := range histogram {
+		histogram[grade].Grade = grade
+	}
+	for _, grade := range grades {
+		bucket := int(math.Max(0, math.Min(grade, float64(totalPoints))))
+		histogram[bucket].Count++
+	}
+
+	return histogram
+}
+
+func getOrderedAnswers(answers map[int][]string) [][]string {
+	keys := make([]int, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	ordered := make([][]string, len(keys))
+	for i, key := range keys {
+		ordered[i] = answers[key]
+	}
+
+	return ordered
+}
+
+func isSameAnswer(answer []string, correctAnswer []string) bool {
+	if len(answer) != len(correctAnswer) {
+		return false
+	}
+
+	chosen := make(map[string]bool, len(answer))
+	for _, option := range answer {
+		chosen[option] = true
+	}
+	for _, option := range correctAnswer {
+		if !chosen[option] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getMean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	return sum / float64(len(values))
+}
+
+func getMedian(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
+
+func getStdDev(values []float64, mean float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += (value - mean) * (value - mean)
+	}
+
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+func percentOf(count int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(count) * 100 / float64(total)
+}
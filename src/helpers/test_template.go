@@ -1,12 +1,22 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -20,10 +30,6 @@ import (
 )
 
 const (
-	GradingErrorNotification   = "Test requires correction!"
-	TestGradedNotification     = "Test has been graded!"
-	TestCorrectionNotification = "Test has been corrected!"
-
 	margin           = 25
 	topMargin        = 20
 	headerCellWidth  = 65
@@ -34,37 +40,190 @@ const (
 	spacingSmall     = 12
 	a4height         = 297
 	a4width          = 210
+	fiducialSize     = 10.5
+	fiducialMargin   = 8
 
 	testTemplatesFolder = "test_templates"
+
+	TemplateEmailField        = "email"
+	templateFontsFolder       = "fonts"
+	defaultTemplateFont       = "Times"
+	logoHeight                = 15
+	logoDownloadTimeout       = 10 * time.Second
+	maxLogoSize               = 2 << 20
+	minTemplateQuestions      = 30
+	maxTemplateContentY       = a4height - topMargin
+	instructionsLineHeight    = 5
+	TemplateFormatPDF         = "pdf"
+	TemplateFormatJPG         = "jpg"
+	TemplateFormatPNG         = "png"
+	DefaultTemplateResolution = 300
+	minTemplateResolution     = 72
+	maxTemplateResolution     = 600
 )
 
-func GenerateTestTemplate(test repositories.Test, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) (string, error) {
-	filenamePrefix := strings.ReplaceAll(fmt.Sprintf("/tmp/%s_%s", test.Subject, test.Name), " ", "_")
-	filenamePDF := fmt.Sprintf("%s.pdf", filenamePrefix)
-	filenameJPG := fmt.Sprintf("%s.jpg", filenamePrefix)
+// logoClient downloads faculty logos. Templates are rendered one at a time, so a slow logo host must not
+// hold up the ones waiting behind it. It only connects to public addresses over https, so a logo URL cannot
+// be used to reach services inside our network, not even through a redirect or a DNS record changed after
+// the style was saved.
+var logoClient = &http.Client{
+	Timeout: logoDownloadTimeout,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: logoDownloadTimeout,
+			Control: checkLogoAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: logoDownloadTimeout,
+	},
+	CheckRedirect: func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("too many redirects")
+		}
+
+		return validateLogoURL(r.URL.String())
+	},
+}
+
+var headerFieldName = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// nonPublicNetworks are the ranges a logo may not be downloaded from, on top of the loopback, link-local and
+// unspecified addresses net.IP already recognizes.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fc00::/7"),
+}
+
+var TemplateContentTypes = map[string]string{
+	TemplateFormatPDF: "application/pdf",
+	TemplateFormatJPG: "image/jpeg",
+	TemplateFormatPNG: "image/png",
+}
 
-	err := createLocalPDF(test, filenamePDF)
+var templateHeaderFields = []repositories.HeaderField{
+	{Name: "firstName", Label: "First Name:"},
+	{Name: "lastName", Label: "Last Name:"},
+	{Name: TemplateEmailField, Label: "University e-mail address:"},
+	{Name: "year", Label: "Year:"},
+	{Name: "group", Label: "Group:"},
+	{Name: "specialization", Label: "Specialization:"},
+}
+
+// GenerateTestTemplate renders the answer sheet of the test as a PDF in the style of its faculty, rasterises it into the JPG the
+// grader aligns photos against and into every preview requested on the test, uploads all of them and
+// returns the test with its template fields filled in.
+func GenerateTestTemplate(test repositories.Test, style repositories.TemplateStyle, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) (repositories.Test, error) {
+	filenamePDF := getTemplateFilename(test, TemplateFormatPDF, 0)
+
+	layout, err := createLocalPDF(test, style, filenamePDF)
 	if err != nil {
-		return "", err
+		return test, err
 	}
+	defer deleteFromLocal(logger, filenamePDF)
 
-	err = convertPdfToJPG(filenamePDF, filenameJPG)
+	pdfFile, err := uploadTemplateFile(test, filenamePDF, TemplateFormatPDF, 0, s3Bucket, s3Region, s3Profile, logger)
+	if err != nil {
+		return test, err
+	}
+	imageFile, err := uploadTemplateFile(test, filenamePDF, TemplateFormatJPG, DefaultTemplateResolution, s3Bucket, s3Region, s3Profile, logger)
 	if err != nil {
-		return "", err
+		return test, err
+	}
+
+	previews := make([]repositories.TemplateFile, 0, len(test.TemplatePreviews))
+	for _, preview := range test.TemplatePreviews {
+		err = ValidateTemplateFile(preview.Format, preview.Resolution)
+		if err != nil {
+			return test, err
+		}
+
+		previewFile, err := uploadTemplateFile(test, filenamePDF, preview.Format, preview.Resolution, s3Bucket, s3Region, s3Profile, logger)
+		if err != nil {
+			return test, err
+		}
+
+		previews = append(previews, previewFile)
 	}
-	defer deleteFromLocal(filenamePDF, filenameJPG, logger)
 
-	return uploadToS3(s3Bucket, s3Region, s3Profile, filenameJPG, testTemplatesFolder)
+	test.TemplateLayout = layout
+	test.TemplatePDFURL = pdfFile.URL
+	test.TemplateImageURL = imageFile.URL
+	test.TemplatePreviews = previews
+
+	return test, nil
 }
 
-func convertPdfToJPG(filenamePDF string, filenameJPG string) error {
-	imagick.Initialize()
-	defer imagick.Terminate()
+// GenerateTemplateFile renders a single template file again, for tests created before the format was
+// kept or for previews nobody asked for when the test was added.
+func GenerateTemplateFile(test repositories.Test, style repositories.TemplateStyle, format string, resolution int, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) (repositories.TemplateFile, error) {
+	filenamePDF := getTemplateFilename(test, TemplateFormatPDF, 0)
+
+	_, err := createLocalPDF(test, style, filenamePDF)
+	if err != nil {
+		return repositories.TemplateFile{}, err
+	}
+	defer deleteFromLocal(logger, filenamePDF)
 
+	return uploadTemplateFile(test, filenamePDF, format, resolution, s3Bucket, s3Region, s3Profile, logger)
+}
+
+func ValidateTemplateFile(format string, resolution int) error {
+	if _, ok := TemplateContentTypes[format]; !ok {
+		return fmt.Errorf("unknown template format '%s'", format)
+	}
+	if format != TemplateFormatPDF && (resolution < minTemplateResolution || resolution > maxTemplateResolution) {
+		return fmt.Errorf("template resolution must be between %d and %d dpi", minTemplateResolution, maxTemplateResolution)
+	}
+
+	return nil
+}
+
+func uploadTemplateFile(test repositories.Test, filenamePDF string, format string, resolution int, s3Bucket string, s3Region string, s3Profile string, logger *log.Logger) (repositories.TemplateFile, error) {
+	filename := filenamePDF
+	if format != TemplateFormatPDF {
+		filename = getTemplateFilename(test, format, resolution)
+
+		err := convertPdfToImage(filenamePDF, filename, format, resolution)
+		if err != nil {
+			return repositories.TemplateFile{}, err
+		}
+		defer deleteFromLocal(logger, filename)
+	} else {
+		resolution = 0
+	}
+
+	fileURL, err := uploadToS3(s3Bucket, s3Region, s3Profile, filename, testTemplatesFolder)
+	if err != nil {
+		return repositories.TemplateFile{}, err
+	}
+
+	return repositories.TemplateFile{
+		Format:     format,
+		Resolution: resolution,
+		URL:        fileURL,
+	}, nil
+}
+
+// getTemplateFilename names the files of a test after its ID, which is unique and safe to use in a path
+// unlike the names teachers give their tests. The files are uploaded under the same name.
+func getTemplateFilename(test repositories.Test, format string, resolution int) string {
+	filenamePrefix := fmt.Sprintf("/tmp/test_%d", test.ID)
+	if format == TemplateFormatPDF || (format == TemplateFormatJPG && resolution == DefaultTemplateResolution) {
+		return fmt.Sprintf("%s.%s", filenamePrefix, format)
+	}
+
+	return fmt.Sprintf("%s_%ddpi.%s", filenamePrefix, resolution, format)
+}
+
+// convertPdfToImage expects ImageMagick to be initialised already, see TemplateRenderer.
+func convertPdfToImage(filenamePDF string, filenameImage string, format string, resolution int) error {
 	mw := imagick.NewMagickWand()
 	defer mw.Destroy()
 
-	if err := mw.SetResolution(300, 300); err != nil {
+	if err := mw.SetResolution(float64(resolution), float64(resolution)); err != nil {
 		return err
 	}
 	if err := mw.ReadImage(filenamePDF); err != nil {
@@ -77,22 +236,21 @@ func convertPdfToJPG(filenamePDF string, filenameJPG string) error {
 		return err
 	}
 	mw.SetIteratorIndex(0)
-	if err := mw.SetFormat("jpg"); err != nil {
+	if err := mw.SetFormat(format); err != nil {
 		return err
 	}
 
-	return mw.WriteImage(filenameJPG)
+	return mw.WriteImage(filenameImage)
 }
 
-func createLocalPDF(test repositories.Test, filename string) error {
+// createLocalPDF writes the answer sheet for the test and returns the position, in millimetres,
+// of every region the grader has to read back from a photo of the filled in sheet.
+func createLocalPDF(test repositories.Test, style repositories.TemplateStyle, filename string) (repositories.TemplateLayout, error) {
 	header := make([]string, test.NrAnswerOptions+1)
-	gridSizes := make([]uint, test.NrAnswerOptions+1)
 	header[0] = "Nr."
-	gridSizes[0] = 1
 
 	for i := 1; i <= test.NrAnswerOptions; i++ {
 		header[i] = string(rune('A' + i - 1))
-		gridSizes[i] = 1
 	}
 
 	contents := make([][]string, test.NrQuestions)
@@ -105,98 +263,419 @@ func createLocalPDF(test repositories.Test, filename string) error {
 		contents[i] = row
 	}
 
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.SetMargins(margin, topMargin, margin)
-	pdf.AddPage()
-	pdf.SetFont("Times", "B", 14)
-	pdf.Cell(headerCellWidth, headerCellHeight, "First Name:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
-	pdf.Ln(headerLineHeight)
-	pdf.Cell(headerCellWidth, headerCellHeight, "Last Name:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
-	pdf.Ln(headerLineHeight)
-	pdf.Cell(headerCellWidth, headerCellHeight, "University e-mail address:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
-	pdf.Ln(headerLineHeight)
-	pdf.Cell(headerCellWidth, headerCellHeight, "Year:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
-	pdf.Ln(headerLineHeight)
-	pdf.Cell(headerCellWidth, headerCellHeight, "Group:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
-	pdf.Ln(headerLineHeight)
-	pdf.Cell(headerCellWidth, headerCellHeight, "Specialization:")
-	pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
+	layout := repositories.TemplateLayout{
+		PageWidth:  a4width,
+		PageHeight: a4height,
+	}
 
-	pdf.Ln(spacingLarge)
-	pdf.SetFont("Times", "B", 20)
-	pdf.CellFormat(0, 10, test.Name, "", 0, "C", false, 0, "")
-	pdf.Ln(spacingSmall)
-	pdf.SetFont("Times", "B", 17)
-	pdf.CellFormat(0, 10, test.Subject, "", 0, "C", false, 0, "")
-	pdf.Ln(spacingLarge)
+	// The grader and the fiducials expect a single page, so the instructions are left out when the grid
+	// would not fit below them.
+	gridHeight := getTemplateGridHeight(test.NrQuestions)
+	if getTemplateHeaderHeight(test, style)+gridHeight > maxTemplateContentY {
+		style.Instructions = EmptyStringParameter
+		if getTemplateHeaderHeight(test, style)+gridHeight > maxTemplateContentY {
+			return repositories.TemplateLayout{}, fmt.Errorf("the answer grid of %d questions does not fit on one page", test.NrQuestions)
+		}
+	}
 
-	pdf.SetFont("Times", "B", 14)
+	pdf := newTemplatePDF()
+	font, translate := setupTemplateFont(pdf, style)
+	pdf.AddPage()
+	addFiducials(pdf, &layout)
+	err := addTemplateHeader(pdf, test, style, font, translate, &layout)
+	if err != nil {
+		return repositories.TemplateLayout{}, err
+	}
+
+	pdf.SetFont(font, "B", 14)
 	pdf.SetFillColor(255, 255, 255)
 	tableWidth := float64(0)
-	for index, str := range header {
-		width := float64(tableCellSize)
-		if index == 0 {
-			width = tableCellSize * 2
-		}
-		pdf.CellFormat(width, tableCellSize, str, "1", 0, "C", true, 0, "")
-		tableWidth += width
+	for index := range header {
+		tableWidth += getTableCellWidth(index)
 	}
 	spaceBetweenTables := a4width - 2*margin - 2*tableWidth
+
+	nrRows := int(math.Ceil(float64(test.NrQuestions) / float64(2)))
+	tablesX := []float64{margin, margin + tableWidth + spaceBetweenTables}
+	_, tablesY := pdf.GetXY()
+	layout.Tables = []repositories.LayoutRegion{
+		{Name: "left", X: tablesX[0], Y: tablesY, Width: tableWidth, Height: float64((nrRows + 1) * tableCellSize)},
+	}
+	if test.NrQuestions > nrRows {
+		layout.Tables = append(layout.Tables, repositories.LayoutRegion{
+			Name: "right", X: tablesX[1], Y: tablesY, Width: tableWidth, Height: float64((test.NrQuestions - nrRows + 1) * tableCellSize),
+		})
+	}
+
+	for index, str := range header {
+		pdf.CellFormat(getTableCellWidth(index), tableCellSize, str, "1", 0, "C", true, 0, "")
+	}
 	pdf.Cell(spaceBetweenTables, tableCellSize, "")
 	for index, str := range header {
-		width := float64(tableCellSize)
-		if index == 0 {
-			width = tableCellSize * 2
-		}
-		pdf.CellFormat(width, tableCellSize, str, "1", 0, "C", true, 0, "")
+		pdf.CellFormat(getTableCellWidth(index), tableCellSize, str, "1", 0, "C", true, 0, "")
 	}
 
 	pdf.Ln(-1)
 
-	nrRows := int(math.Ceil(float64(test.NrQuestions) / float64(2)))
-
 	for questionNr := 0; questionNr < nrRows; questionNr++ {
-		for index, str := range contents[questionNr] {
-			width := float64(tableCellSize)
-			if index == 0 {
-				width = tableCellSize * 2
-			}
-			pdf.CellFormat(width, tableCellSize, str, "1", 0, "C", true, 0, "")
-		}
+		addTableRow(pdf, &layout, questionNr, contents[questionNr])
 		pdf.Cell(spaceBetweenTables, tableCellSize, "")
 		if nrRows+questionNr < len(contents) {
-			for index, str := range contents[nrRows+questionNr] {
-				width := float64(tableCellSize)
-				if index == 0 {
-					width = tableCellSize * 2
-				}
-				pdf.CellFormat(width, tableCellSize, str, "1", 0, "C", true, 0, "")
-			}
+			addTableRow(pdf, &layout, nrRows+questionNr, contents[nrRows+questionNr])
 		}
 
 		pdf.Ln(-1)
 	}
 
-	return pdf.OutputFileAndClose(filename)
+	return layout, pdf.OutputFileAndClose(filename)
 }
 
-func uploadToS3(s3Bucket string, s3Region string, s3Profile string, filename string, folder string) (string, error) {
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region:      aws.String(s3Region),
-		Credentials: credentials.NewSharedCredentials("", s3Profile),
-	}))
+func newTemplatePDF() *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, topMargin, margin)
+	pdf.SetAutoPageBreak(false, 0)
+
+	return pdf
+}
+
+// addTemplateHeader prints the fields students fill in, the logo, the test name and subject and the
+// instructions, leaving the cursor where the answer grid starts.
+func addTemplateHeader(pdf *gofpdf.Fpdf, test repositories.Test, style repositories.TemplateStyle, font string,
+	translate func(string) string, layout *repositories.TemplateLayout,
+) error {
+	pdf.SetFont(font, "B", 14)
+	for index, field := range getTemplateHeaderFields(style) {
+		if index > 0 {
+			pdf.Ln(headerLineHeight)
+		}
+		pdf.Cell(headerCellWidth, headerCellHeight, translate(field.Label))
+		x, y := pdf.GetXY()
+		pdf.Cell(headerCellWidth, headerCellHeight, "_________________________________")
+		layout.Header = append(layout.Header, repositories.LayoutRegion{
+			Name:   field.Name,
+			X:      x,
+			Y:      y,
+			Width:  a4width - margin - x,
+			Height: headerCellHeight,
+		})
+	}
+
+	pdf.Ln(spacingLarge)
+	if style.LogoURL != EmptyStringParameter {
+		err := addLogo(pdf, style.LogoURL)
+		if err != nil {
+			return err
+		}
+	}
+	pdf.SetFont(font, "B", 20)
+	pdf.CellFormat(0, 10, translate(test.Name), "", 0, "C", false, 0, "")
+	pdf.Ln(spacingSmall)
+	pdf.SetFont(font, "B", 17)
+	pdf.CellFormat(0, 10, translate(test.Subject), "", 0, "C", false, 0, "")
+	pdf.Ln(spacingSmall)
+	if style.Instructions != EmptyStringParameter {
+		pdf.SetFont(font, "", 11)
+		pdf.MultiCell(0, instructionsLineHeight, translate(style.Instructions), "", "L", false)
+	}
+	pdf.Ln(spacingLarge - spacingSmall)
+
+	return pdf.Error()
+}
+
+// getTemplateHeaderHeight measures where the answer grid starts below the header of the style by printing
+// the header on a page which is thrown away. The logo sits in a gap of the header and is left out.
+func getTemplateHeaderHeight(test repositories.Test, style repositories.TemplateStyle) float64 {
+	style.LogoURL = EmptyStringParameter
+	pdf := newTemplatePDF()
+	font, translate := setupTemplateFont(pdf, style)
+	pdf.AddPage()
+	_ = addTemplateHeader(pdf, test, style, font, translate, &repositories.TemplateLayout{})
+	_, y := pdf.GetXY()
+
+	return y
+}
+
+// getTemplateGridHeight returns the height of the answer grid, whose two tables share the questions.
+func getTemplateGridHeight(nrQuestions int) float64 {
+	nrRows := int(math.Ceil(float64(nrQuestions) / float64(2)))
+
+	return float64((nrRows + 1) * tableCellSize)
+}
+
+func addTableRow(pdf *gofpdf.Fpdf, layout *repositories.TemplateLayout, questionNr int, row []string) {
+	for index, str := range row {
+		width := getTableCellWidth(index)
+		if index > 0 {
+			x, y := pdf.GetXY()
+			layout.Cells = append(layout.Cells, repositories.LayoutCell{
+				Question: questionNr,
+				Option:   string(rune('A' + index - 1)),
+				X:        x,
+				Y:        y,
+				Width:    width,
+				Height:   tableCellSize,
+			})
+		}
+		pdf.CellFormat(width, tableCellSize, str, "1", 0, "C", true, 0, "")
+	}
+}
+
+// setupTemplateFont registers the faculty font, which has to be a TrueType font in the fonts folder
+// to print diacritics, and falls back to the core Times font with its text translated to cp1252.
+func setupTemplateFont(pdf *gofpdf.Fpdf, style repositories.TemplateStyle) (string, func(string) string) {
+	if style.Font == EmptyStringParameter {
+		return defaultTemplateFont, pdf.UnicodeTranslatorFromDescriptor("")
+	}
 
-	uploader := s3manager.NewUploader(sess)
+	regular, bold := getTemplateFontFiles(style.Font)
+	pdf.AddUTF8Font(style.Font, "", regular)
+	pdf.AddUTF8Font(style.Font, "B", bold)
+
+	return style.Font, func(text string) string { return text }
+}
+
+func getTemplateFontFiles(font string) (string, string) {
+	return filepath.Join(templateFontsFolder, fmt.Sprintf("%s.ttf", font)),
+		filepath.Join(templateFontsFolder, fmt.Sprintf("%s-Bold.ttf", font))
+}
+
+// getTemplateHeaderFields relabels the default header fields with the faculty labels, drops the hidden
+// ones and appends the fields the faculty added, such as the date, room or duration of the exam.
+func getTemplateHeaderFields(style repositories.TemplateStyle) []repositories.HeaderField {
+	labels := make(map[string]string, len(style.HeaderFields))
+	for _, field := range style.HeaderFields {
+		labels[field.Name] = field.Label
+	}
+	hidden := make(map[string]bool, len(style.HiddenFields))
+	for _, name := range style.HiddenFields {
+		hidden[name] = true
+	}
+
+	var fields []repositories.HeaderField
+	for _, field := range templateHeaderFields {
+		if hidden[field.Name] {
+			continue
+		}
+		if label, ok := labels[field.Name]; ok {
+			field.Label = label
+			delete(labels, field.Name)
+		}
+
+		fields = append(fields, field)
+	}
+	for _, field := range style.HeaderFields {
+		if _, ok := labels[field.Name]; ok {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+func addLogo(pdf *gofpdf.Fpdf, logoURL string) error {
+	err := validateLogoURL(logoURL)
+	if err != nil {
+		return err
+	}
+	response, err := logoClient.Get(logoURL)
+	if err != nil {
+		return fmt.Errorf("failed to download logo %q, %v", logoURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download logo %q, status %d", logoURL, response.StatusCode)
+	}
+	logo, err := ioutil.ReadAll(io.LimitReader(response.Body, maxLogoSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download logo %q, %v", logoURL, err)
+	}
+	if len(logo) > maxLogoSize {
+		return fmt.Errorf("logo %q is larger than %d bytes", logoURL, maxLogoSize)
+	}
+
+	options := gofpdf.ImageOptions{ImageType: getLogoImageType(logoURL, response.Header.Get("Content-Type"))}
+	info := pdf.RegisterImageOptionsReader(logoURL, options, bytes.NewReader(logo))
+	if err = pdf.Error(); err != nil {
+		return err
+	}
+
+	logoWidth := logoHeight * info.Width() / info.Height()
+	// the logo sits in the gap left between the header and the test name
+	_, y := pdf.GetXY()
+	logoY := y - spacingLarge + headerCellHeight + (spacingLarge-headerCellHeight-logoHeight)/2
+	pdf.ImageOptions(logoURL, (a4width-logoWidth)/2, logoY, logoWidth, logoHeight, false, options, 0, "")
+
+	return pdf.Error()
+}
+
+func getLogoImageType(logoURL string, contentType string) string {
+	switch contentType {
+	case "image/png":
+		return "PNG"
+	case "image/jpeg":
+		return "JPG"
+	case "image/gif":
+		return "GIF"
+	}
+
+	return strings.ToUpper(strings.TrimPrefix(filepath.Ext(strings.Split(logoURL, "?")[0]), "."))
+}
+
+func validateLogoURL(logoURL string) error {
+	parsedURL, err := url.Parse(logoURL)
+	if err != nil {
+		return fmt.Errorf("logo URL %q is not valid, %v", logoURL, err)
+	}
+	if parsedURL.Scheme != "https" || parsedURL.Hostname() == EmptyStringParameter || parsedURL.User != nil {
+		return fmt.Errorf("logo URL %q must be an https address without credentials", logoURL)
+	}
+	if ip := net.ParseIP(parsedURL.Hostname()); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("logo URL %q does not point to a public address", logoURL)
+	}
+
+	return nil
+}
+
+func checkLogoAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("logo host %s is not a public address", host)
+	}
+
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return network
+}
+
+func ValidateTemplateStyle(style repositories.TemplateStyle) error {
+	for _, name := range style.HiddenFields {
+		if name == TemplateEmailField {
+			return fmt.Errorf("the '%s' field is needed for grading and cannot be hidden", TemplateEmailField)
+		}
+	}
+	for _, field := range style.HeaderFields {
+		if field.Name == EmptyStringParameter || field.Label == EmptyStringParameter {
+			return fmt.Errorf("header fields need both a name and a label")
+		}
+		if !headerFieldName.MatchString(field.Name) {
+			return fmt.Errorf("header field name '%s' may only contain letters, digits and underscores", field.Name)
+		}
+	}
+	if style.Font != EmptyStringParameter {
+		if filepath.Base(style.Font) != style.Font {
+			return fmt.Errorf("font name '%s' is not valid", style.Font)
+		}
+		regular, bold := getTemplateFontFiles(style.Font)
+		for _, fontFile := range []string{regular, bold} {
+			if _, err := os.Stat(fontFile); err != nil {
+				return fmt.Errorf("font file %s not found", fontFile)
+			}
+		}
+	}
+	if style.LogoURL != EmptyStringParameter {
+		err := validateLogoURL(style.LogoURL)
+		if err != nil {
+			return err
+		}
+	}
+	headerHeight := getTemplateHeaderHeight(repositories.Test{}, style)
+	if headerHeight+getTemplateGridHeight(minTemplateQuestions) > maxTemplateContentY {
+		return fmt.Errorf("the header is too tall to leave room for %d questions, use fewer header fields or shorter instructions",
+			minTemplateQuestions)
+	}
+
+	return nil
+}
+
+// addFiducials prints a finder pattern in every corner of the page (a black square holding a white
+// square holding a smaller black square, in a 7:5:3 ratio) so a photo of the sheet can be aligned
+// from the markers alone, whatever else is in the picture.
+func addFiducials(pdf *gofpdf.Fpdf, layout *repositories.TemplateLayout) {
+	corners := []repositories.LayoutRegion{
+		{Name: "topLeft", X: fiducialMargin, Y: fiducialMargin},
+		{Name: "topRight", X: a4width - fiducialMargin - fiducialSize, Y: fiducialMargin},
+		{Name: "bottomRight", X: a4width - fiducialMargin - fiducialSize, Y: a4height - fiducialMargin - fiducialSize},
+		{Name: "bottomLeft", X: fiducialMargin, Y: a4height - fiducialMargin - fiducialSize},
+	}
+
+	module := float64(fiducialSize) / 7
+	for _, corner := range corners {
+		pdf.SetFillColor(0, 0, 0)
+		pdf.Rect(corner.X, corner.Y, fiducialSize, fiducialSize, "F")
+		pdf.SetFillColor(255, 255, 255)
+		pdf.Rect(corner.X+module, corner.Y+module, 5*module, 5*module, "F")
+		pdf.SetFillColor(0, 0, 0)
+		pdf.Rect(corner.X+2*module, corner.Y+2*module, 3*module, 3*module, "F")
+
+		corner.Width = fiducialSize
+		corner.Height = fiducialSize
+		layout.Fiducials = append(layout.Fiducials, corner)
+	}
+
+	pdf.SetFillColor(255, 255, 255)
+}
+
+func getTableCellWidth(column int) float64 {
+	if column == 0 {
+		return tableCellSize * 2
+	}
+
+	return tableCellSize
+}
+
+func DownloadTemplateFromS3(s3Bucket string, s3Region string, s3Profile string, fileURL string) ([]byte, error) {
+	split := strings.Split(fileURL, "/")
+	filename, err := url.PathUnescape(split[len(split)-1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file url %q, %v", fileURL, err)
+	}
+
+	downloader := s3manager.NewDownloader(getS3Session(s3Region, s3Profile))
+
+	buffer := aws.NewWriteAtBuffer([]byte{})
+	_, err = downloader.Download(buffer, &s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(fmt.Sprintf("%s/%s", testTemplatesFolder, filename)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file, %v", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func uploadToS3(s3Bucket string, s3Region string, s3Profile string, filename string, folder string) (string, error) {
+	uploader := s3manager.NewUploader(getS3Session(s3Region, s3Profile))
 
 	f, err := os.Open(filename)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file %q, %v", filename, err)
 	}
+	defer f.Close()
 
 	split := strings.Split(filename, "/")
 	filename = split[len(split)-1]
@@ -214,13 +693,18 @@ func uploadToS3(s3Bucket string, s3Region string, s3Profile string, filename str
 	return aws.StringValue(&result.Location), nil
 }
 
-func deleteFromLocal(filenamePDF string, filenameJPG string, logger *log.Logger) {
-	err := os.Remove(filenamePDF)
-	if err != nil {
-		logger.Printf("could not delete %s: %s", filenamePDF, err.Error())
-	}
-	err = os.Remove(filenameJPG)
-	if err != nil {
-		logger.Printf("could not delete %s: %s", filenameJPG, err.Error())
+func getS3Session(s3Region string, s3Profile string) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(s3Region),
+		Credentials: credentials.NewSharedCredentials("", s3Profile),
+	}))
+}
+
+func deleteFromLocal(logger *log.Logger, filenames ...string) {
+	for _, filename := range filenames {
+		err := os.Remove(filename)
+		if err != nil {
+			logger.Printf("could not delete %s: %s", filename, err.Error())
+		}
 	}
 }
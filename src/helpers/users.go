@@ -6,10 +6,13 @@ import (
 	"crypto/md5"
 	cryptoRand "crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"math/rand"
 	"time"
 	"unsafe"
+
+	"qbot_webserver/src/repositories"
 )
 
 const (
@@ -19,8 +22,48 @@ const (
 	letterIdxBits = 6
 	letterIdxMask = 1<<letterIdxBits - 1
 	letterIdxMax  = 63 / letterIdxBits
+
+	UserStatusPending     = "pending"
+	UserStatusActive      = "active"
+	UserStatusDeactivated = "deactivated"
+	UserStatusInvited     = "invited"
+
+	InvitationStatusInvited    = "invited"
+	InvitationStatusRegistered = "registered"
+	InvitationStatusInvalid    = "invalid"
 )
 
+func IsUserStatus(status string) bool {
+	return status == UserStatusPending || status == UserStatusActive || status == UserStatusDeactivated || status == UserStatusInvited
+}
+
+// CheckUserStatus fails for accounts which cannot be used, i.e. teachers waiting for approval, deactivated
+// accounts and students who did not accept their invitation yet.
+func CheckUserStatus(status string) error {
+	switch status {
+	case UserStatusPending:
+		return fmt.Errorf("account is waiting for the approval of an administrator")
+	case UserStatusDeactivated:
+		return fmt.Errorf("account is deactivated")
+	case UserStatusInvited:
+		return fmt.Errorf("account has not been created yet, follow the link in the invitation")
+	}
+
+	return nil
+}
+
+// GetUserLabel returns the node label of a user type, "S" for students and "P" for teachers.
+func GetUserLabel(userType string) (string, error) {
+	switch userType {
+	case repositories.StudentType:
+		return repositories.StudentLabel, nil
+	case repositories.TeacherType:
+		return repositories.TeacherLabel, nil
+	}
+
+	return EmptyStringParameter, fmt.Errorf("unknown user type '%s'", userType)
+}
+
 func GenerateToken(n int) string {
 	src := rand.NewSource(time.Now().UnixNano())
 	b := make([]byte, n)
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbookRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxMaxSheetName = 31
+)
+
+var xlsxNumber = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// xlsxSheetNameReplacer removes the characters spreadsheet applications do not allow in sheet names.
+var xlsxSheetNameReplacer = strings.NewReplacer("[", " ", "]", " ", ":", " ", "*", " ", "?", " ", "/", " ", "\\", " ")
+
+// WriteXLSX writes the rows as the only sheet of an XLSX workbook. Cells holding a number are written as
+// numbers so they can be used in formulas, everything else is written as an inline string.
+func WriteXLSX(sheetName string, rows [][]string) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for rowIndex, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, rowIndex+1)
+		for columnIndex, value := range row {
+			reference := fmt.Sprintf("%s%d", getXLSXColumnName(columnIndex), rowIndex+1)
+			if xlsxNumber.MatchString(value) {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, reference, value)
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, reference, escapeXML(value))
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	sheetName = xlsxSheetNameReplacer.Replace(sheetName)
+	if runes := []rune(sheetName); len(runes) > xlsxMaxSheetName {
+		sheetName = string(runes[:xlsxMaxSheetName])
+	}
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRootRelationships)},
+		{"xl/workbook.xml", []byte(fmt.Sprintf(xlsxWorkbook, escapeXML(sheetName)))},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRelationships)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	}
+
+	var workbook bytes.Buffer
+	archive := zip.NewWriter(&workbook)
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = writer.Write(file.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return workbook.Bytes(), nil
+}
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Reference string   `xml:"r,attr"`
+			Type      string   `xml:"t,attr"`
+			Value     string   `xml:"v"`
+			Inline    xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX reads the cells of the first sheet of an XLSX workbook as text. Empty rows and cells left out of
+// the sheet are filled in, so rows keep their numbers and columns stay aligned with the header.
+func ReadXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetName, err := getFirstXLSXSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var sharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		err = readXLSXFile(files, "xl/sharedStrings.xml", &sharedStrings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sheet xlsxSheet
+	err = readXLSXFile(files, sheetName, &sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, sheetRow := range sheet.Rows {
+		for len(rows) < sheetRow.Number-1 {
+			rows = append(rows, []string{})
+		}
+
+		var row []string
+		for index, cell := range sheetRow.Cells {
+			column := index
+			if cell.Reference != EmptyStringParameter {
+				column = getXLSXColumnIndex(cell.Reference)
+			}
+			for len(row) < column {
+				row = append(row, EmptyStringParameter)
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				var sharedIndex int
+				_, err = fmt.Sscanf(cell.Value, "%d", &sharedIndex)
+				if err != nil || sharedIndex < 0 || sharedIndex >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("cell %s points to a missing shared string", cell.Reference)
+				}
+				value = sharedStrings.Items[sharedIndex].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+			row = append(row, value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func (text xlsxText) String() string {
+	if len(text.Runs) == 0 {
+		return text.Text
+	}
+
+	var runs strings.Builder
+	for _, run := range text.Runs {
+		runs.WriteString(run.Text)
+	}
+
+	return runs.String()
+}
+
+// getFirstXLSXSheet follows the workbook relationships to the file holding the first sheet.
+func getFirstXLSXSheet(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			RelationshipID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	err := readXLSXFile(files, "xl/workbook.xml", &workbook)
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return EmptyStringParameter, fmt.Errorf("workbook has no sheets")
+	}
+
+	var relationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	err = readXLSXFile(files, "xl/_rels/workbook.xml.rels", &relationships)
+	if err != nil {
+		return EmptyStringParameter, err
+	}
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID != workbook.Sheets[0].RelationshipID {
+			continue
+		}
+		if strings.HasPrefix(relationship.Target, "/") {
+			return strings.TrimPrefix(relationship.Target, "/"), nil
+		}
+
+		return path.Join("xl", relationship.Target), nil
+	}
+
+	return EmptyStringParameter, fmt.Errorf("first sheet of the workbook not found")
+}
+
+func readXLSXFile(files map[string]*zip.File, name string, value interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("'%s' not found in workbook", name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(content, value)
+}
+
+// getXLSXColumnIndex turns a cell reference such as AB12 into the zero based index of its column.
+func getXLSXColumnIndex(reference string) int {
+	index := 0
+	for _, r := range reference {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+
+	return index - 1
+}
+
+// getXLSXColumnName turns a zero based column index into its spreadsheet name, e.g. 0 is A and 27 is AB.
+func getXLSXColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+
+	return name
+}
+
+func escapeXML(value string) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(value))
+
+	return escaped.String()
+}
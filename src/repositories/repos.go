@@ -14,11 +14,38 @@ const (
 	Search         = "search"
 	Password       = "password"
 	NewPassword    = "newPassword"
+	NotificationID = "notification"
+	UnreadOnly     = "unread"
+	All            = "all"
+	Format         = "format"
+	Resolution     = "resolution"
+	DeviceToken    = "device"
+	ReleaseAt      = "releaseAt"
+	ObjectiveID    = "objective"
+	State          = "state"
+	DryRun         = "dryRun"
+	GroupID        = "group"
+	MergeInto      = "into"
+	UserID         = "user"
+	Reason         = "reason"
+	Code           = "code"
+	InvitationCode = "invitation"
+	Email          = "email"
+	Since          = "since"
+	ActorType      = "actorType"
+	ActorID        = "actor"
+	EntityType     = "entityType"
+	EntityID       = "entity"
+	From           = "from"
+	To             = "to"
+	Archived       = "archived"
 
 	StudentLabel = "Student"
 	StudentType  = "S"
 	TeacherLabel = "Teacher"
 	TeacherType  = "P"
+	AdminLabel   = "Admin"
+	AdminType    = "A"
 )
 
 type Item struct {
@@ -30,21 +57,26 @@ type ResponseItem struct {
 	Error   string `json:"error"`
 }
 
+// TokenInfo is who a token belongs to. ImpersonatorID is the administrator using it, for impersonation tokens.
 type TokenInfo struct {
-	ID    int    `json:"id"`
-	Label string `json:"label"`
+	ID             int    `json:"id"`
+	Label          string `json:"label"`
+	Verified       bool   `json:"verified"`
+	ImpersonatorID int    `json:"impersonatorID,omitempty"`
 }
 
 type User struct {
-	ID        int      `json:"id"`
-	Type      string   `json:"type"`
-	Token     string   `json:"token"`
-	Email     string   `json:"email"`
-	Password  string   `json:"password"`
-	FirstName string   `json:"firstName"`
-	LastName  string   `json:"lastName"`
-	Faculty   string   `json:"faculty"`
-	Subjects  []string `json:"subjects"`
+	ID                  int      `json:"id"`
+	Type                string   `json:"type"`
+	Token               string   `json:"token"`
+	Email               string   `json:"email"`
+	Password            string   `json:"password"`
+	FirstName           string   `json:"firstName"`
+	LastName            string   `json:"lastName"`
+	Faculty             string   `json:"faculty"`
+	Subjects            []string `json:"subjects"`
+	UnreadNotifications int      `json:"unreadNotifications"`
+	EmailVerified       bool     `json:"emailVerified"`
 }
 
 type Professor struct {
@@ -73,11 +105,27 @@ type Test struct {
 	EnablePartialScoring   bool             `json:"enablePartialScoring"`
 	MandatoryToPass        bool             `json:"mandatoryToPass"`
 	TemplateImageURL       string           `json:"templateImageURL"`
+	TemplateLayout         TemplateLayout   `json:"templateLayout"`
+	TemplatePDFURL         string           `json:"templatePDFURL"`
+	TemplatePreviews       []TemplateFile   `json:"templatePreviews"`
+	TemplateStatus         string           `json:"templateStatus"`
+	TemplateError          string           `json:"templateError"`
+	Publication            string           `json:"publication"`
+	ReleaseAt              int              `json:"releaseAt"`
+	PublishedAt            int              `json:"publishedAt"`
 	NrTestsGraded          int              `json:"nrTestsGraded"`
 	Teacher                Professor        `json:"professor"`
 	CorrectAnswers         map[int][]string `json:"correctAnswers"`
 }
 
+// ArchivedTest is a test its teacher deleted, which can be restored until it is purged.
+type ArchivedTest struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Subject    string `json:"subject"`
+	ArchivedAt int    `json:"archivedAt"`
+}
+
 type CompletedTest struct {
 	Test
 	TestImageURL            string           `json:"testImageURL"`
@@ -86,18 +134,310 @@ type CompletedTest struct {
 	GradeTimestamp          int              `json:"gradeTimestamp"`
 	CorrectedGrade          int              `json:"correctedGrade"`
 	CorrectedGradeTimestamp int              `json:"correctedGradeTimestamp"`
-	NotificationMessage     string           `json:"notificationMessage"`
 	ImageBytes              string           `json:"imageBytes"`
 	Feedback                string           `json:"feedback"`
 	Author                  Student          `json:"student"`
 	Answers                 map[int][]string `json:"answers"`
 }
 
+type Notification struct {
+	ID        int                 `json:"id"`
+	Type      string              `json:"type"`
+	Message   string              `json:"message"`
+	Payload   NotificationPayload `json:"payload"`
+	CreatedAt int                 `json:"createdAt"`
+	ReadAt    int                 `json:"readAt"`
+}
+
+type NotificationPayload struct {
+	TestID    int    `json:"testId,omitempty"`
+	TestName  string `json:"testName,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	StudentID int    `json:"studentId,omitempty"`
+	Grade     int    `json:"grade,omitempty"`
+	Objective int    `json:"objectiveId,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+type TestStats struct {
+	TestID        int             `json:"testId"`
+	NrSubmissions int             `json:"nrSubmissions"`
+	TotalPoints   int             `json:"totalPoints"`
+	Histogram     []GradeCount    `json:"histogram"`
+	Mean          float64         `json:"mean"`
+	Median        float64         `json:"median"`
+	StdDev        float64         `json:"stdDev"`
+	PassThreshold float64         `json:"passThreshold"`
+	PassRate      *float64        `json:"passRate,omitempty"`
+	Questions     []QuestionStats `json:"questions"`
+}
+
+type GradeCount struct {
+	Grade int `json:"grade"`
+	Count int `json:"count"`
+}
+
+type QuestionStats struct {
+	Question        int                `json:"question"`
+	CorrectAnswers  []string           `json:"correctAnswers"`
+	PercentCorrect  float64            `json:"percentCorrect"`
+	PercentBlank    float64            `json:"percentBlank"`
+	OptionFrequency map[string]float64 `json:"optionFrequency"`
+	Discrimination  float64            `json:"discrimination"`
+}
+
+type SubjectProgress struct {
+	Subject         string              `json:"subject"`
+	Average         float64             `json:"average"`
+	GroupPercentile float64             `json:"groupPercentile"`
+	Timeline        []ProgressPoint     `json:"timeline"`
+	Objectives      []ObjectiveProgress `json:"objectives"`
+}
+
+type ProgressPoint struct {
+	TestID          int     `json:"testId"`
+	TestName        string  `json:"testName"`
+	Timestamp       int     `json:"timestamp"`
+	Grade           int     `json:"grade"`
+	Points          int     `json:"points"`
+	Percentage      float64 `json:"percentage"`
+	RollingAverage  float64 `json:"rollingAverage"`
+	GroupPercentile float64 `json:"groupPercentile"`
+}
+
+type ObjectiveProgress struct {
+	ObjectiveID    int     `json:"objectiveId"`
+	TargetGrade    int     `json:"targetGrade"`
+	StartTimestamp int     `json:"startTimestamp"`
+	EndTimestamp   int     `json:"endTimestamp"`
+	Average        float64 `json:"average"`
+	Difference     float64 `json:"difference"`
+}
+
+type TestEvent struct {
+	Type         string `json:"type"`
+	TestID       int    `json:"testId"`
+	StudentID    int    `json:"studentId,omitempty"`
+	StudentEmail string `json:"studentEmail,omitempty"`
+	Grade        int    `json:"grade,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Timestamp    int    `json:"timestamp"`
+}
+
+type EmailPreferences struct {
+	Mode       string   `json:"mode"`
+	MutedTypes []string `json:"mutedTypes"`
+}
+
+// ManagedUser is a student or teacher as listed for administrators.
+type ManagedUser struct {
+	User
+	Status         string `json:"status"`
+	Specialization string `json:"specialization,omitempty"`
+	Group          int    `json:"group,omitempty"`
+	ArchivedAt     int    `json:"archivedAt,omitempty"`
+}
+
+// UserAssignment moves a student to another group or a teacher to another faculty.
+type UserAssignment struct {
+	Group   int    `json:"group"`
+	Faculty string `json:"faculty"`
+}
+
+type Impersonation struct {
+	Admin     User   `json:"admin"`
+	User      User   `json:"user"`
+	Reason    string `json:"reason"`
+	CreatedAt int    `json:"createdAt"`
+	ExpiresAt int    `json:"expiresAt"`
+}
+
+// LoginAttempt is a failed login administrators can audit. User is only set when the email belongs to an account.
+type LoginAttempt struct {
+	Email     string `json:"email"`
+	IP        string `json:"ip"`
+	Reason    string `json:"reason"`
+	Locked    bool   `json:"locked"`
+	User      *User  `json:"user,omitempty"`
+	CreatedAt int    `json:"createdAt"`
+}
+
+// AuditEntry records who did something sensitive to which test or user. Grade changes also name the
+// student whose grade changed, and Before and After hold the changed value.
+type AuditEntry struct {
+	Action     string `json:"action"`
+	Actor      User   `json:"actor"`
+	EntityType string `json:"entityType"`
+	EntityID   int    `json:"entityId"`
+	StudentID  int    `json:"studentId,omitempty"`
+	Before     string `json:"before,omitempty"`
+	After      string `json:"after,omitempty"`
+	Details    string `json:"details,omitempty"`
+	CreatedAt  int    `json:"createdAt"`
+}
+
+// AuditFilter narrows down the audit log. Zero values do not filter.
+type AuditFilter struct {
+	ActorType  string
+	ActorID    int
+	EntityType string
+	EntityID   int
+	From       int
+	To         int
+}
+
+// Invitation is what a student sees of the invitation they follow before signing up.
+type Invitation struct {
+	Email          string `json:"email"`
+	Group          int    `json:"group"`
+	Specialization string `json:"specialization"`
+	Faculty        string `json:"faculty"`
+	InvitedBy      User   `json:"invitedBy"`
+}
+
+type InvitationReport struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Group struct {
+	ID             int    `json:"id"`
+	Specialization string `json:"specialization"`
+	Faculty        string `json:"faculty"`
+}
+
+type ImportedStudent struct {
+	Row     int      `json:"row"`
+	Student Student  `json:"student"`
+	Errors  []string `json:"errors"`
+}
+
+type ImportReport struct {
+	DryRun                 bool              `json:"dryRun"`
+	NrRows                 int               `json:"nrRows"`
+	NrCreated              int               `json:"nrCreated"`
+	NrUpdated              int               `json:"nrUpdated"`
+	NrInvalid              int               `json:"nrInvalid"`
+	CreatedGroups          []int             `json:"createdGroups"`
+	CreatedSpecializations []string          `json:"createdSpecializations"`
+	Rows                   []ImportRowReport `json:"rows"`
+}
+
+type ImportRowReport struct {
+	Row    int      `json:"row"`
+	Email  string   `json:"email"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type Device struct {
+	Token        string `json:"token"`
+	Platform     string `json:"platform"`
+	RegisteredAt int    `json:"registeredAt"`
+}
+
 type Objective struct {
-	ID             int             `json:"id"`
-	Subject        string          `json:"subject"`
-	TargetGrade    int             `json:"targetGrade"`
-	StartTimestamp int             `json:"startTimestamp"`
-	EndTimestamp   int             `json:"endTimestamp"`
-	Tests          []CompletedTest `json:"tests"`
+	ID             int                 `json:"id"`
+	Subject        string              `json:"subject"`
+	TargetGrade    int                 `json:"targetGrade"`
+	StartTimestamp int                 `json:"startTimestamp"`
+	EndTimestamp   int                 `json:"endTimestamp"`
+	NrTests        int                 `json:"nrTests"`
+	State          string              `json:"state"`
+	CreatedAt      int                 `json:"createdAt"`
+	ClosedAt       int                 `json:"closedAt"`
+	Tests          []CompletedTest     `json:"tests"`
+	Evaluation     ObjectiveEvaluation `json:"evaluation"`
+	// GroupObjectiveID is set on objectives derived from a group objective set by a teacher.
+	GroupObjectiveID int `json:"groupObjectiveId,omitempty"`
+	// LegacyTarget is the grade targeted by an objective set before targets became percentages, until
+	// the student updates it.
+	LegacyTarget int `json:"legacyTarget,omitempty"`
+}
+
+type GroupObjective struct {
+	ID             int                    `json:"id"`
+	Group          int                    `json:"group"`
+	Subject        string                 `json:"subject"`
+	TargetGrade    int                    `json:"targetGrade"`
+	TargetShare    int                    `json:"targetShare"`
+	StartTimestamp int                    `json:"startTimestamp"`
+	EndTimestamp   int                    `json:"endTimestamp"`
+	NrTests        int                    `json:"nrTests"`
+	State          string                 `json:"state"`
+	CreatedAt      int                    `json:"createdAt"`
+	ClosedAt       int                    `json:"closedAt"`
+	Progress       GroupObjectiveProgress `json:"progress"`
+}
+
+type GroupObjectiveProgress struct {
+	NrStudents int                        `json:"nrStudents"`
+	NrOnTarget int                        `json:"nrOnTarget"`
+	Share      float64                    `json:"share"`
+	Average    float64                    `json:"average"`
+	Status     string                     `json:"status"`
+	Students   []StudentObjectiveProgress `json:"students"`
+}
+
+type StudentObjectiveProgress struct {
+	StudentID   int                 `json:"studentId"`
+	FirstName   string              `json:"firstName"`
+	LastName    string              `json:"lastName"`
+	ObjectiveID int                 `json:"objectiveId"`
+	Evaluation  ObjectiveEvaluation `json:"evaluation"`
+}
+
+type ObjectiveEvaluation struct {
+	Average        float64 `json:"average"`
+	NrTestsTaken   int     `json:"nrTestsTaken"`
+	RemainingTests int     `json:"remainingTests"`
+	GradeNeeded    float64 `json:"gradeNeeded"`
+	Status         string  `json:"status"`
+}
+
+type TemplateLayout struct {
+	PageWidth  float64        `json:"pageWidth"`
+	PageHeight float64        `json:"pageHeight"`
+	Header     []LayoutRegion `json:"header"`
+	Tables     []LayoutRegion `json:"tables"`
+	Cells      []LayoutCell   `json:"cells"`
+	Fiducials  []LayoutRegion `json:"fiducials"`
+}
+
+type TemplateFile struct {
+	Format     string `json:"format"`
+	Resolution int    `json:"resolution"`
+	URL        string `json:"url"`
+}
+
+type TemplateStyle struct {
+	Faculty      string        `json:"faculty"`
+	LogoURL      string        `json:"logoURL"`
+	Instructions string        `json:"instructions"`
+	Font         string        `json:"font"`
+	HeaderFields []HeaderField `json:"headerFields"`
+	HiddenFields []string      `json:"hiddenFields"`
+}
+
+type HeaderField struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+type LayoutRegion struct {
+	Name   string  `json:"name"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+type LayoutCell struct {
+	Question int     `json:"question"`
+	Option   string  `json:"option"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
 }
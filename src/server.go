@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 	"qbot_webserver/src/handlers/users"
 
+	"qbot_webserver/src/datasources"
 	"qbot_webserver/src/handlers"
 	"qbot_webserver/src/handlers/spinneritems"
 	"qbot_webserver/src/handlers/tests"
@@ -42,8 +46,8 @@ func logWith(logger *log.Logger) option {
 	}
 }
 
-func setup(logger *log.Logger, driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile string) *http.Server {
-	server := newServer(driver, s3Bucket, s3Region, s3Profile, logWith(logger))
+func setup(logger *log.Logger, driver neo4j.Driver, renderer *helpers.TemplateRenderer, dispatcher *helpers.NotificationDispatcher, accounts *helpers.AccountMailer, limiter *helpers.LoginLimiter, oidc *helpers.OIDCClient, mockOIDC *helpers.MockOIDCProvider, events *helpers.TestEventBroker, s3Bucket string, s3Region string, s3Profile string) *http.Server {
+	server := newServer(driver, renderer, dispatcher, accounts, limiter, oidc, mockOIDC, events, s3Bucket, s3Region, s3Profile, logWith(logger))
 	return &http.Server{
 		Addr:         ":8081",
 		Handler:      server,
@@ -53,7 +57,7 @@ func setup(logger *log.Logger, driver neo4j.Driver, s3Bucket string, s3Region st
 	}
 }
 
-func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile string, options ...option) *server {
+func newServer(driver neo4j.Driver, renderer *helpers.TemplateRenderer, dispatcher *helpers.NotificationDispatcher, accounts *helpers.AccountMailer, limiter *helpers.LoginLimiter, oidc *helpers.OIDCClient, mockOIDC *helpers.MockOIDCProvider, events *helpers.TestEventBroker, s3Bucket string, s3Region string, s3Profile string, options ...option) *server {
 	s := &server{logger: log.New(ioutil.Discard, "", 0)}
 
 	for _, o := range options {
@@ -67,11 +71,21 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 			spinneritems.HandleSubjects(w, r, s.logger, driver, "subjects")
 		},
 	)
+	s.mux.HandleFunc("/subjects/merge",
+		func(w http.ResponseWriter, r *http.Request) {
+			spinneritems.HandleSubjectMerge(w, r, s.logger, driver, "subjectsMerge")
+		},
+	)
 	s.mux.HandleFunc("/faculties",
 		func(w http.ResponseWriter, r *http.Request) {
 			spinneritems.HandleFaculties(w, r, s.logger, driver, "faculties")
 		},
 	)
+	s.mux.HandleFunc("/faculties/templateStyle",
+		func(w http.ResponseWriter, r *http.Request) {
+			spinneritems.HandleTemplateStyle(w, r, s.logger, driver, "facultiesTemplateStyle")
+		},
+	)
 	s.mux.HandleFunc("/specializations",
 		func(w http.ResponseWriter, r *http.Request) {
 			spinneritems.HandleSpecializations(w, r, s.logger, driver, "specializations")
@@ -89,7 +103,7 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 	)
 	s.mux.HandleFunc("/tests/errors",
 		func(w http.ResponseWriter, r *http.Request) {
-			tests.HandleTestErrors(w, r, s.logger, driver, "testErrors")
+			tests.HandleTestErrors(w, r, s.logger, driver, "testErrors", dispatcher, events)
 		},
 	)
 	s.mux.HandleFunc("/tests/feedback",
@@ -99,7 +113,32 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 	)
 	s.mux.HandleFunc("/tests/grade",
 		func(w http.ResponseWriter, r *http.Request) {
-			tests.HandleTestGrade(w, r, s.logger, driver, "testGrade", s3Bucket, s3Region, s3Profile)
+			tests.HandleTestGrade(w, r, s.logger, driver, "testGrade", s3Bucket, s3Region, s3Profile, dispatcher, events)
+		},
+	)
+	s.mux.HandleFunc("/tests/events",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestEvents(w, r, s.logger, driver, "testEvents", events)
+		},
+	)
+	s.mux.HandleFunc("/tests/publish",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestPublication(w, r, s.logger, driver, "testPublish", dispatcher)
+		},
+	)
+	s.mux.HandleFunc("/tests/stats",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestStats(w, r, s.logger, driver, "testStats")
+		},
+	)
+	s.mux.HandleFunc("/tests/export",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestExport(w, r, s.logger, driver, "testExport")
+		},
+	)
+	s.mux.HandleFunc("/tests/template",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestTemplate(w, r, s.logger, driver, "testTemplate", renderer)
 		},
 	)
 	s.mux.HandleFunc("/tests/notifications",
@@ -107,9 +146,14 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 			tests.HandleTestNotifications(w, r, s.logger, driver, "testNotifications")
 		},
 	)
+	s.mux.HandleFunc("/tests/restore",
+		func(w http.ResponseWriter, r *http.Request) {
+			tests.HandleTestRestore(w, r, s.logger, driver, "testRestore")
+		},
+	)
 	s.mux.HandleFunc("/tests",
 		func(w http.ResponseWriter, r *http.Request) {
-			tests.HandleTests(w, r, s.logger, driver, "tests", s3Bucket, s3Region, s3Profile)
+			tests.HandleTests(w, r, s.logger, driver, "tests", renderer)
 		},
 	)
 	s.mux.HandleFunc("/objectives",
@@ -117,9 +161,14 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 			handlers.HandleObjectives(w, r, s.logger, driver, "objectives")
 		},
 	)
+	s.mux.HandleFunc("/objectives/groups",
+		func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleGroupObjectives(w, r, s.logger, driver, "objectivesGroups", dispatcher)
+		},
+	)
 	s.mux.HandleFunc("/users/login",
 		func(w http.ResponseWriter, r *http.Request) {
-			users.HandleLogin(w, r, s.logger, driver, "usersLogin")
+			users.HandleLogin(w, r, s.logger, driver, "usersLogin", limiter)
 		},
 	)
 	s.mux.HandleFunc("/users/addSubjects",
@@ -132,11 +181,94 @@ func newServer(driver neo4j.Driver, s3Bucket string, s3Region string, s3Profile
 			users.HandleChangePassword(w, r, s.logger, driver, "usersChangePassword")
 		},
 	)
+	s.mux.HandleFunc("/users/devices",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleDevices(w, r, s.logger, driver, "usersDevices")
+		},
+	)
+	s.mux.HandleFunc("/users/progress",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleProgress(w, r, s.logger, driver, "usersProgress")
+		},
+	)
+	s.mux.HandleFunc("/users/import",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleStudentImport(w, r, s.logger, driver, "usersImport")
+		},
+	)
+	s.mux.HandleFunc("/users/emailPreferences",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleEmailPreferences(w, r, s.logger, driver, "usersEmailPreferences")
+		},
+	)
+	s.mux.HandleFunc("/users/verify",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleVerification(w, r, s.logger, driver, "usersVerify", accounts)
+		},
+	)
+	s.mux.HandleFunc("/users/oidc",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleOIDCLogin(w, r, s.logger, "usersOidc", oidc)
+		},
+	)
+	s.mux.HandleFunc("/users/oidc/callback",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleOIDCCallback(w, r, s.logger, driver, "usersOidcCallback", oidc)
+		},
+	)
+	s.mux.HandleFunc("/users/passwordReset",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandlePasswordReset(w, r, s.logger, driver, "usersPasswordReset", accounts)
+		},
+	)
+	s.mux.HandleFunc("/users/invitations",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleInvitations(w, r, s.logger, driver, "usersInvitations", accounts)
+		},
+	)
 	s.mux.HandleFunc("/users",
 		func(w http.ResponseWriter, r *http.Request) {
-			users.HandleUsers(w, r, s.logger, driver, "users")
+			users.HandleUsers(w, r, s.logger, driver, "users", accounts)
 		},
 	)
+	s.mux.HandleFunc("/admin/users/status",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleUserStatus(w, r, s.logger, driver, "adminUsersStatus")
+		},
+	)
+	s.mux.HandleFunc("/admin/users/password",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleUserPasswordReset(w, r, s.logger, driver, "adminUsersPassword")
+		},
+	)
+	s.mux.HandleFunc("/admin/users/impersonate",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleImpersonation(w, r, s.logger, driver, "adminUsersImpersonate")
+		},
+	)
+	s.mux.HandleFunc("/admin/users/restore",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleUserRestore(w, r, s.logger, driver, "adminUsersRestore")
+		},
+	)
+	s.mux.HandleFunc("/admin/auditLog",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleAuditLog(w, r, s.logger, driver, "adminAuditLog")
+		},
+	)
+	s.mux.HandleFunc("/admin/loginAttempts",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleLoginAttempts(w, r, s.logger, driver, "adminLoginAttempts")
+		},
+	)
+	s.mux.HandleFunc("/admin/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			users.HandleAdminUsers(w, r, s.logger, driver, "adminUsers")
+		},
+	)
+	if mockOIDC != nil {
+		s.mux.Handle("/oidc/mock/", mockOIDC)
+	}
 
 	return s
 }
@@ -147,6 +279,19 @@ func main() {
 	s3Bucket := "dissertation-qbot"
 	s3Profile := "diz"
 	s3Region := "eu-central-1"
+	pushURL := "https://fcm.googleapis.com/fcm/send"
+	pushServerKey := os.Getenv("QBOT_PUSH_SERVER_KEY")
+	smtpHost := os.Getenv("QBOT_SMTP_HOST")
+	smtpPort := 25
+	smtpFrom := "qbot@ase.ro"
+	publicURL := "http://localhost:8081"
+	digestHour := 8
+	releaseInterval := time.Minute
+	objectivesInterval := time.Hour
+	purgeInterval := time.Hour
+	archiveRetentionDays := 30
+	loginAttemptRetentionDays := 90
+	shutdownTimeout := 10 * time.Second
 
 	driver, err := helpers.ConnectNeo4j(ip, "neo4j", "mariairene")
 	if err != nil {
@@ -155,12 +300,58 @@ func main() {
 		logger.Println("connected to Neo4j")
 	}
 
-	hs := setup(logger, driver, s3Bucket, s3Region, s3Profile)
+	err = migrate(driver, os.Getenv("QBOT_ADMIN_EMAIL"), os.Getenv("QBOT_ADMIN_PASSWORD"))
+	if err != nil {
+		logger.Println(fmt.Sprintf("error migrating Neo4j data: %s", err))
+	}
+
+	renderer := helpers.NewTemplateRenderer(driver, s3Bucket, s3Region, s3Profile, logger)
+	var pushSender helpers.PushSender = &helpers.LogPushSender{Logger: logger}
+	if pushServerKey != "" {
+		pushSender = helpers.NewHTTPPushSender(pushURL, pushServerKey)
+	}
+	var mailer helpers.MailSender = &helpers.LogMailSender{Logger: logger}
+	if smtpHost != "" {
+		if port, err := strconv.Atoi(os.Getenv("QBOT_SMTP_PORT")); err == nil {
+			smtpPort = port
+		}
+		mailer = helpers.NewSMTPMailSender(smtpHost, smtpPort, os.Getenv("QBOT_SMTP_USERNAME"), os.Getenv("QBOT_SMTP_PASSWORD"), smtpFrom)
+	}
+	dispatcher := helpers.NewNotificationDispatcher(pushSender, mailer, logger)
+	if url := os.Getenv("QBOT_PUBLIC_URL"); url != "" {
+		publicURL = url
+	}
+	accounts := helpers.NewAccountMailer(mailer, os.Getenv("QBOT_LINK_SECRET"), publicURL, logger)
+	limiter := helpers.NewLoginLimiter()
+	oidc, mockOIDC := newOIDCClient(publicURL, logger)
+	digest := helpers.NewEmailDigest(driver, mailer, digestHour, logger)
+	release := helpers.NewScheduledJob(driver, "gradeRelease", releaseInterval, func(session neo4j.Session) error {
+		return datasources.ReleaseScheduledTests(session, dispatcher, logger)
+	}, logger)
+	objectives := helpers.NewScheduledJob(driver, "objectiveEvaluation", objectivesInterval, func(session neo4j.Session) error {
+		return datasources.EvaluateObjectives(session, dispatcher)
+	}, logger)
+	if days, err := strconv.Atoi(os.Getenv("QBOT_ARCHIVE_RETENTION_DAYS")); err == nil {
+		archiveRetentionDays = days
+	}
+	if days, err := strconv.Atoi(os.Getenv("QBOT_LOGIN_ATTEMPT_RETENTION_DAYS")); err == nil {
+		loginAttemptRetentionDays = days
+	}
+	purge := helpers.NewScheduledJob(driver, "archivePurge", purgeInterval, func(session neo4j.Session) error {
+		err := datasources.PurgeArchived(session, time.Duration(archiveRetentionDays)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+
+		return datasources.PurgeLoginAttempts(session, time.Duration(loginAttemptRetentionDays)*24*time.Hour)
+	}, logger)
+	events := helpers.NewTestEventBroker()
+	hs := setup(logger, driver, renderer, dispatcher, accounts, limiter, oidc, mockOIDC, events, s3Bucket, s3Region, s3Profile)
 	defer python3.Py_Finalize()
 
 	logger.Printf("Listening on http://localhost%s\n", hs.Addr)
 	go func() {
-		if err := hs.ListenAndServe(); err != nil {
+		if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Println(err)
 		}
 	}()
@@ -171,5 +362,74 @@ func main() {
 	<-signals
 
 	logger.Println("Shutting down webserver.")
+	// stop taking requests before closing the background jobs they hand work to
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := hs.Shutdown(ctx); err != nil {
+		logger.Println(fmt.Sprintf("error shutting down webserver: %s", err))
+	}
+	purge.Close()
+	objectives.Close()
+	release.Close()
+	digest.Close()
+	renderer.Close()
 	os.Exit(0)
 }
+
+// newOIDCClient configures single sign-on from the environment. With QBOT_OIDC_MOCK set the server is its
+// own identity provider, so the login flow can be tried without the one of the university.
+func newOIDCClient(publicURL string, logger *log.Logger) (*helpers.OIDCClient, *helpers.MockOIDCProvider) {
+	var mockOIDC *helpers.MockOIDCProvider
+	config := helpers.OIDCConfig{
+		Issuer:       os.Getenv("QBOT_OIDC_ISSUER"),
+		ClientID:     os.Getenv("QBOT_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("QBOT_OIDC_CLIENT_SECRET"),
+		RedirectURL:  strings.TrimSuffix(publicURL, "/") + "/users/oidc/callback",
+		RoleClaim:    os.Getenv("QBOT_OIDC_ROLE_CLAIM"),
+		StudentRoles: []string{"student"},
+		TeacherRoles: []string{"teacher"},
+	}
+	if roles := os.Getenv("QBOT_OIDC_STUDENT_ROLES"); roles != "" {
+		config.StudentRoles = strings.Split(roles, ",")
+	}
+	if roles := os.Getenv("QBOT_OIDC_TEACHER_ROLES"); roles != "" {
+		config.TeacherRoles = strings.Split(roles, ",")
+	}
+
+	if os.Getenv("QBOT_OIDC_MOCK") != "" {
+		config.Issuer = strings.TrimSuffix(publicURL, "/") + "/oidc/mock"
+		if config.ClientID == "" {
+			config.ClientID = "qbot"
+		}
+		provider, err := helpers.NewMockOIDCProvider(config.Issuer)
+		if err != nil {
+			logger.Println(fmt.Sprintf("error starting mock identity provider: %s", err))
+			return nil, nil
+		}
+		mockOIDC = provider
+	}
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, nil
+	}
+
+	return helpers.NewOIDCClient(config, os.Getenv("QBOT_LINK_SECRET"), logger), mockOIDC
+}
+
+// migrate brings the data up to date with the server and creates the administrator when one is configured.
+func migrate(driver neo4j.Driver, adminEmail string, adminPassword string) error {
+	session, err := helpers.GetNeo4jSession(driver)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	err = datasources.MigrateObjectiveRelationships(session)
+	if err != nil {
+		return err
+	}
+	if adminEmail == "" || adminPassword == "" {
+		return nil
+	}
+
+	return datasources.EnsureAdmin(session, adminEmail, adminPassword)
+}